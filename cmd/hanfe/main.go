@@ -7,7 +7,9 @@ import (
 	"syscall"
 
 	"github.com/gg582/hanfe/internal/app"
+	"github.com/gg582/hanfe/internal/backend"
 	"github.com/gg582/hanfe/internal/cli"
+	"github.com/gg582/hanfe/internal/emitter"
 	"github.com/gg582/hanfe/internal/layout"
 	"github.com/gg582/hanfe/internal/ttybridge"
 )
@@ -41,6 +43,13 @@ func run(args []string) error {
 		listLayouts()
 		return nil
 	}
+	if opts.ListOutputs {
+		listOutputs()
+		return nil
+	}
+	if opts.UserDictAction != "" {
+		return runUserDict(opts)
+	}
 
 	if opts.Daemonize {
 		spawned, derr := daemonizeIfNeeded()
@@ -63,6 +72,44 @@ func listLayouts() {
 	fmt.Println("none")
 }
 
+func listOutputs() {
+	for _, backend := range emitter.Backends() {
+		fmt.Printf("%-11s %s (%s)\n", backend.Name, backend.Description, backend.Capabilities)
+	}
+}
+
+func runUserDict(opts cli.Options) error {
+	path := opts.UserDictPath
+	if path == "" {
+		path = backend.DefaultUserDictionaryPath()
+	}
+	dict, err := backend.LoadUserDictionary(path)
+	if err != nil {
+		return err
+	}
+	switch opts.UserDictAction {
+	case "reset":
+		if err := dict.Reset(); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "hanfe: cleared learned data in %s\n", path)
+		return nil
+	default:
+		if opts.UserDictOutput == "" || opts.UserDictOutput == "-" {
+			return dict.Export(os.Stdout)
+		}
+		file, err := os.Create(opts.UserDictOutput)
+		if err != nil {
+			return err
+		}
+		if err := dict.Export(file); err != nil {
+			file.Close()
+			return err
+		}
+		return file.Close()
+	}
+}
+
 func daemonizeIfNeeded() (bool, error) {
 	if os.Getenv(daemonEnv) == "1" {
 		return false, nil
@@ -29,8 +29,10 @@ func ResolveEngineLayout(canonical, raw, keypairPath string) (*layout.Layout, st
 	switch normalized {
 	case "", "dubeolsik", "hangul", "korean":
 		normalized = "dubeolsik"
-	case "sebulshik-final", "sebulshik", "sebulsik", "sebeolsik-final":
-		normalized = "sebeolsik-390"
+	case "sebulshik-final", "sebulshik", "sebulsik", "sebeolsik-final", "3beolsik-final":
+		normalized = "sebeolsik-final"
+	case "old-hangul", "oldhangul", "yethangul", "dubeolsik-old", "2y":
+		normalized = "old-hangul"
 	case "latin", "raw", "none":
 		return nil, "", nil
 	}
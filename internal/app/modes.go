@@ -28,6 +28,56 @@ func ApplyModeOrder(cfg *config.ToggleConfig, override []string, hangulName stri
 		cfg.ModeCycle = append([]string{cfg.DefaultMode}, cfg.ModeCycle...)
 		cfg.ModeCycle = uniqueStrings(cfg.ModeCycle)
 	}
+	if len(cfg.Select) > 0 {
+		selectChords := make(map[string][]config.ToggleChord, len(cfg.Select))
+		for name, chords := range cfg.Select {
+			if name = normalizeModeName(name, hangulName, haveHangul); name != "" {
+				selectChords[name] = chords
+			}
+		}
+		cfg.Select = selectChords
+	}
+	for i := range cfg.Rules {
+		if cfg.Rules[i].Action != config.RuleBypass {
+			cfg.Rules[i].Mode = normalizeModeName(cfg.Rules[i].Mode, hangulName, haveHangul)
+		}
+	}
+	cfg.NormalizeModeOptions(func(name string) string {
+		return normalizeModeName(name, hangulName, haveHangul)
+	})
+}
+
+// DropMissingModes removes the select chords, [rules] entries and
+// [mode.<name>] sections naming a mode that is not among modes, such as
+// pinyin without a database, and returns a warning for each.
+func DropMissingModes(cfg *config.ToggleConfig, modes []engine.ModeSpec) []string {
+	built := make(map[string]bool, len(modes))
+	for _, mode := range modes {
+		built[mode.Name] = true
+	}
+	var warnings []string
+	for name := range cfg.Select {
+		if !built[name] {
+			warnings = append(warnings, fmt.Sprintf("select.%s ignored: no such mode", name))
+			delete(cfg.Select, name)
+		}
+	}
+	rules := cfg.Rules[:0]
+	for _, rule := range cfg.Rules {
+		if rule.Action != config.RuleBypass && !built[rule.Mode] {
+			warnings = append(warnings, fmt.Sprintf("rule %s:%s ignored: no such mode %s", rule.Field, rule.Pattern, rule.Mode))
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	cfg.Rules = rules
+	for name := range cfg.Modes {
+		if !built[name] {
+			warnings = append(warnings, fmt.Sprintf("[mode.%s] ignored: no such mode", name))
+			delete(cfg.Modes, name)
+		}
+	}
+	return warnings
 }
 
 func normalizeModeCycle(cycle []string, hangulName string, haveHangul bool) []string {
@@ -69,6 +119,8 @@ func normalizeModeName(value, hangulName string, haveHangul bool) string {
 		return "latin"
 	case "kana", "kana86", "hiragana", "katakana", "japanese":
 		return "kana86"
+	case "romaji", "roma", "romaji-kana":
+		return "romaji"
 	case "pinyin", "zhuyin", "ime", "database":
 		return "pinyin"
 	case "none", "off":
@@ -100,9 +152,10 @@ func uniqueStrings(values []string) []string {
 	return out
 }
 
-func BuildModes(cycle []string, hangulLayout *layout.Layout, hangulName string, database backend.Database) ([]engine.ModeSpec, error) {
+func BuildModes(cycle []string, hangulLayout *layout.Layout, hangulName string, database backend.Database, hanja backend.Database, kanji backend.Database, userDict *backend.UserDictionary) ([]engine.ModeSpec, error) {
 	available := make(map[string]engine.ModeSpec)
 	available["latin"] = engine.ModeSpec{Name: "latin", Kind: types.ModeLatin}
+	available["romaji"] = engine.ModeSpec{Name: "romaji", Kind: types.ModeRomaji, Database: kanji, UserDict: userDict}
 
 	if hangulLayout != nil {
 		layoutCopy := *hangulLayout
@@ -111,6 +164,13 @@ func BuildModes(cycle []string, hangulLayout *layout.Layout, hangulName string,
 			kind = types.ModeKana
 		}
 		spec := engine.ModeSpec{Name: hangulName, Kind: kind, Layout: &layoutCopy}
+		if kind == types.ModeHangul {
+			spec.Hanja = hanja
+			spec.UserDict = userDict
+		} else {
+			spec.Database = kanji
+			spec.UserDict = userDict
+		}
 		if hangulName != "" {
 			available[strings.ToLower(hangulName)] = spec
 		}
@@ -124,13 +184,13 @@ func BuildModes(cycle []string, hangulLayout *layout.Layout, hangulName string,
 					return nil, fmt.Errorf("load kana layout: %w", err)
 				}
 				layoutCopy := kanaLayout
-				available["kana86"] = engine.ModeSpec{Name: "kana86", Kind: types.ModeKana, Layout: &layoutCopy}
+				available["kana86"] = engine.ModeSpec{Name: "kana86", Kind: types.ModeKana, Layout: &layoutCopy, Database: kanji, UserDict: userDict}
 			}
 		}
 	}
 
 	if database.Available() {
-		available["pinyin"] = engine.ModeSpec{Name: "pinyin", Kind: types.ModeDatabase, Database: database}
+		available["pinyin"] = engine.ModeSpec{Name: "pinyin", Kind: types.ModeDatabase, Database: database, UserDict: userDict}
 	}
 
 	modes := make([]engine.ModeSpec, 0, len(cycle))
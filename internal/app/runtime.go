@@ -15,6 +15,7 @@ import (
 	"github.com/gg582/hanfe/internal/device"
 	"github.com/gg582/hanfe/internal/emitter"
 	"github.com/gg582/hanfe/internal/engine"
+	"github.com/gg582/hanfe/internal/focus"
 	"github.com/gg582/hanfe/internal/layout"
 	"github.com/gg582/hanfe/internal/ttybridge"
 	"github.com/gg582/hangul-logotype/hangul"
@@ -27,10 +28,14 @@ type Runtime struct {
 	hangulName       string
 	toggle           config.ToggleConfig
 	database         backend.Database
+	hanja            backend.Database
+	kanji            backend.Database
+	userDict         *backend.UserDictionary
 	modes            []engine.ModeSpec
 	fallback         emitter.Output
 	ttyClient        *ttybridge.Client
 	directCommit     bool
+	outputs          []string
 	deviceFD         int
 	cleanups         []func()
 }
@@ -68,6 +73,10 @@ func (rt *Runtime) Run() error {
 	if err != nil {
 		return err
 	}
+	eng.SetWarningHandler(func(err error) {
+		fmt.Fprintf(os.Stderr, "hanfe: %v\n", err)
+	})
+	rt.attachFocus(eng)
 
 	if rt.opts.SocketPath == "" {
 		rt.opts.SocketPath = common.DefaultSocketPath()
@@ -106,23 +115,112 @@ func (rt *Runtime) prepareToggle() error {
 		return err
 	}
 	ApplyModeOrder(&cfg, rt.opts.ModeOrder, rt.hangulName, rt.engineLayout != nil)
+	if cfg.Auto.Enabled && cfg.Auto.Words != "" {
+		// A missing word list only loses the extra words.
+		if file, err := os.Open(cfg.Auto.Words); err != nil {
+			fmt.Fprintf(os.Stderr, "hanfe: using the built-in English words only: %v\n", err)
+			cfg.Auto.Words = ""
+		} else {
+			file.Close()
+		}
+	}
 	rt.toggle = cfg
+
+	// --output replaces the chain from toggle.ini.
+	outputs := rt.opts.Output
+	if len(outputs) == 0 {
+		outputs = cfg.Output
+	}
+	chain, err := emitter.ParseChain(outputs)
+	if err != nil {
+		return err
+	}
+	rt.outputs = chain
 	return nil
 }
 
 func (rt *Runtime) prepareDatabase() error {
-	if rt.opts.PinyinDBPath == "" {
-		rt.database = backend.Database{}
-		return nil
+	formats, err := parseDatabaseFormats(rt.opts.DBFormat)
+	if err != nil {
+		return err
 	}
-	db, err := backend.LoadDatabase(rt.opts.PinyinDBPath)
+	db, err := loadOptionalDatabase(rt.opts.PinyinDBPath, formats["pinyin"])
 	if err != nil {
 		return err
 	}
 	rt.database = db
+
+	hanja, err := loadOptionalDatabase(rt.opts.HanjaDBPath, formats["hanja"])
+	if err != nil {
+		return err
+	}
+	rt.hanja = hanja
+
+	kanji, err := loadOptionalDatabase(rt.opts.KanjiDBPath, formats["kanji"])
+	if err != nil {
+		return err
+	}
+	rt.kanji = kanji
+
+	if !db.Available() && !hanja.Available() && !kanji.Available() {
+		return nil
+	}
+	path := rt.opts.UserDictPath
+	if path == "" {
+		path = backend.DefaultUserDictionaryPath()
+	}
+	userDict, err := backend.LoadUserDictionary(path)
+	if err != nil {
+		return err
+	}
+	userDict.SetWarningHandler(func(err error) {
+		fmt.Fprintf(os.Stderr, "hanfe: %v\n", err)
+	})
+	rt.userDict = userDict
+	rt.registerCleanup(func() {
+		if err := userDict.Close(); err != nil {
+			fmt.Fprintf(os.Stderr, "hanfe: %v\n", err)
+		}
+	})
 	return nil
 }
 
+// parseDatabaseFormats reads --db-format, a comma-separated list of
+// DB=FORMAT pairs where DB is pinyin, hanja or kanji. Databases it does
+// not name have their format detected from the file name.
+func parseDatabaseFormats(value string) (map[string]backend.Format, error) {
+	formats := make(map[string]backend.Format)
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		name, formatName, ok := strings.Cut(entry, "=")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !ok {
+			return nil, fmt.Errorf("invalid --db-format %q: expected DB=FORMAT, such as hanja=%s", entry, entry)
+		}
+		switch name {
+		case "pinyin", "hanja", "kanji":
+		default:
+			return nil, fmt.Errorf("invalid --db-format %q: unknown database %q (expected pinyin, hanja or kanji)", entry, name)
+		}
+		format, err := backend.ParseFormat(formatName)
+		if err != nil {
+			return nil, err
+		}
+		formats[name] = format
+	}
+	return formats, nil
+}
+
+func loadOptionalDatabase(path string, format backend.Format) (backend.Database, error) {
+	if path == "" {
+		return backend.Database{}, nil
+	}
+	return backend.LoadDatabaseFormat(path, format)
+}
+
 func (rt *Runtime) prepareTTY() error {
 	ttyPath := strings.TrimSpace(rt.opts.TTYPath)
 	ptyPath := strings.TrimSpace(rt.opts.PTYPath)
@@ -144,7 +242,10 @@ func (rt *Runtime) prepareTTY() error {
 		directCommit = false
 	}
 
-	if directCommit && ttyPath != "" {
+	// The default chain in direct mode ends with the TTY helper; an
+	// explicit chain only starts it when asked to.
+	needHelper := directCommit && len(rt.outputs) == 0 || rt.wantsOutput("tty")
+	if needHelper && ttyPath != "" {
 		if err := ttybridge.SpawnHelper(ttyPath); err != nil {
 			return err
 		}
@@ -160,6 +261,16 @@ func (rt *Runtime) prepareTTY() error {
 	return nil
 }
 
+// wantsOutput reports whether the configured output chain includes name.
+func (rt *Runtime) wantsOutput(name string) bool {
+	for _, output := range rt.outputs {
+		if output == name {
+			return true
+		}
+	}
+	return false
+}
+
 func (rt *Runtime) openDevice() error {
 	devicePath := strings.TrimSpace(rt.opts.DevicePath)
 	if devicePath == "" {
@@ -171,7 +282,16 @@ func (rt *Runtime) openDevice() error {
 		fmt.Fprintf(os.Stderr, "hanfe: using keyboard %s (%s)\n", detected.Path, detected.Name)
 	}
 
-	fd, err := syscall.Open(devicePath, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	// Read-write so the engine can set the keyboard LEDs. Without write
+	// access the keyboard still works; only the LED goes dark.
+	fd, err := syscall.Open(devicePath, syscall.O_RDWR|syscall.O_CLOEXEC, 0)
+	if err != nil && (errors.Is(err, syscall.EACCES) || errors.Is(err, syscall.EPERM) || errors.Is(err, syscall.EROFS)) {
+		fd, err = syscall.Open(devicePath, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		if err == nil && rt.toggle.LED != config.IndicatorNone {
+			fmt.Fprintf(os.Stderr, "hanfe: mode LED disabled: %s is not writable\n", devicePath)
+			rt.toggle.LED = config.IndicatorNone
+		}
+	}
 	if err != nil {
 		return fmt.Errorf("open %s: %w", devicePath, err)
 	}
@@ -186,25 +306,86 @@ func (rt *Runtime) openDevice() error {
 }
 
 func (rt *Runtime) buildEmitter() error {
-	hexCodes := layout.UnicodeHexKeycodes()
-	fallback, err := emitter.Open(hexCodes, rt.ttyClient, rt.opts.PTYPath, rt.directCommit)
+	chain := rt.outputs
+	explicit := len(chain) > 0
+	if !explicit {
+		chain = emitter.DefaultChain(rt.directCommit)
+	}
+	cfg := emitter.Config{
+		HexKeycodes: layout.UnicodeHexKeycodes(),
+		TTY:         rt.ttyClient,
+		PTYPath:     strings.TrimSpace(rt.opts.PTYPath),
+	}
+	out, chosen, err := emitter.OpenChain(chain, cfg, func(skipped emitter.Backend, err error) {
+		if explicit || !errors.Is(err, emitter.ErrUnavailable) {
+			fmt.Fprintf(os.Stderr, "hanfe: output %s unavailable: %v\n", skipped.Name, err)
+		}
+	})
 	if err != nil {
 		return err
 	}
-	rt.fallback = fallback
-	rt.registerCleanup(func() { _ = fallback.Close() })
+	fmt.Fprintf(os.Stderr, "hanfe: output %s (%s)\n", chosen.Name, chosen.Capabilities)
+	if chosen.Name != "tty" && rt.ttyClient != nil {
+		// Nothing writes to the helper; closing the connection ends it.
+		_ = rt.ttyClient.Close()
+		rt.ttyClient = nil
+	}
+	rt.fallback = rt.wrapPaste(out, chosen)
+	rt.registerCleanup(func() { _ = rt.fallback.Close() })
 	return nil
 }
 
+// wrapPaste adds the [paste] strategy to out. Pasting goes through an X11
+// selection and the paste keys, so it needs an X display and a backend
+// that presses keys in it.
+func (rt *Runtime) wrapPaste(out emitter.Output, chosen emitter.Backend) emitter.Output {
+	if len(rt.toggle.Paste.Apps) == 0 {
+		return out
+	}
+	if !chosen.Capabilities.Paste {
+		fmt.Fprintf(os.Stderr, "hanfe: paste disabled: output %s cannot paste\n", chosen.Name)
+		return out
+	}
+	paster, err := emitter.OpenClipboardPaster(out, rt.toggle.Paste.Primary)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hanfe: paste disabled: %v\n", err)
+		return out
+	}
+	return paster
+}
+
 func (rt *Runtime) buildModes() error {
-	modes, err := BuildModes(rt.toggle.ModeCycle, rt.engineLayout, rt.hangulName, rt.database)
+	modes, err := BuildModes(rt.toggle.ModeCycle, rt.engineLayout, rt.hangulName, rt.database, rt.hanja, rt.kanji, rt.userDict)
 	if err != nil {
 		return err
 	}
+	for _, warning := range DropMissingModes(&rt.toggle, modes) {
+		fmt.Fprintf(os.Stderr, "hanfe: %s\n", warning)
+	}
 	rt.modes = modes
 	return nil
 }
 
+// attachFocus lets the engine follow the focused window when the [auto]
+// exclude list, per-window modes, [rules] or [paste] need it. Without an X
+// display they have no effect.
+func (rt *Runtime) attachFocus(eng *engine.Engine) {
+	exclude := rt.toggle.Auto.Enabled && len(rt.toggle.Auto.Exclude) > 0
+	windowed := len(rt.toggle.Rules) > 0 || len(rt.toggle.Paste.Apps) > 0
+	if !exclude && rt.toggle.Remember == config.RememberOff && !windowed {
+		return
+	}
+	tracker, err := focus.OpenX11()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "hanfe: focus tracking disabled: %v\n", err)
+		return
+	}
+	rt.registerCleanup(func() { _ = tracker.Close() })
+	if err := eng.SetFocusProvider(tracker); err != nil {
+		fmt.Fprintf(os.Stderr, "hanfe: focus tracking disabled: %v\n", err)
+	}
+}
+
 func (rt *Runtime) runEventLoop(eng *engine.Engine, server *TranslationServer) error {
 	engineErrCh := make(chan error, 1)
 	go func() {
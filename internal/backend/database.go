@@ -3,45 +3,201 @@ package backend
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+	"sort"
 	"strings"
 )
 
+const (
+	// maxPrefixRecords bounds how many keys a plain prefix search visits.
+	maxPrefixRecords = 64
+	// maxSearchResults bounds the candidates returned by Search.
+	maxSearchResults = 100
+)
+
 type Database struct {
-	entries map[string]string
+	entries map[string][]string
+	records []record
+	abbrev  map[string][]int
 }
 
-func LoadDatabase(path string) (Database, error) {
-	file, err := os.Open(path)
-	if err != nil {
-		return Database{}, fmt.Errorf("open backend database: %w", err)
-	}
-	defer file.Close()
+// record is one dictionary key in the sorted search index.
+type record struct {
+	key       string
+	raw       string
+	syllables []string
+}
 
-	var raw map[string]string
-	if err := json.NewDecoder(file).Decode(&raw); err != nil {
-		return Database{}, fmt.Errorf("parse backend database: %w", err)
+// NewDatabase builds a database from already parsed entries. Keys are
+// normalized the same way LoadDatabase normalizes them and empty candidate
+// lists are dropped.
+func NewDatabase(raw map[string][]string) Database {
+	entries := make(map[string][]string, len(raw))
+	for key, values := range raw {
+		normalized := normalizeKey(key)
+		if normalized == "" {
+			continue
+		}
+		for _, value := range values {
+			entries[normalized] = appendCandidate(entries[normalized], value)
+		}
 	}
+	db := Database{entries: entries}
+	db.buildIndex()
+	return db
+}
 
-	entries := make(map[string]string, len(raw))
-	for key, value := range raw {
-		normalized := strings.ToLower(strings.TrimSpace(key))
-		if normalized == "" {
+// buildIndex sorts the keys for prefix search and groups pinyin keys by the
+// initials of their syllables for abbreviated lookups.
+func (db *Database) buildIndex() {
+	db.records = make([]record, 0, len(db.entries))
+	for raw, values := range db.entries {
+		if len(values) == 0 {
+			continue
+		}
+		db.records = append(db.records, record{
+			key:       strings.ReplaceAll(raw, "'", ""),
+			raw:       raw,
+			syllables: segmentPinyin(raw),
+		})
+	}
+	sort.Slice(db.records, func(i, j int) bool {
+		if db.records[i].key != db.records[j].key {
+			return db.records[i].key < db.records[j].key
+		}
+		return db.records[i].raw < db.records[j].raw
+	})
+	db.abbrev = make(map[string][]int)
+	for idx, rec := range db.records {
+		if len(rec.syllables) == 0 {
 			continue
 		}
-		entries[normalized] = value
+		abbr := abbreviation(rec.syllables)
+		db.abbrev[abbr] = append(db.abbrev[abbr], idx)
+	}
+}
+
+// LoadDatabase reads a dictionary file, choosing the loader from the file
+// name (see DetectFormat). JSON files map keys to either a single candidate
+// string or an ordered list of candidates.
+func LoadDatabase(path string) (Database, error) {
+	return LoadDatabaseFormat(path, FormatAuto)
+}
+
+func decodeCandidates(value json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(value, &single); err == nil {
+		return []string{single}, nil
+	}
+	var list []string
+	if err := json.Unmarshal(value, &list); err != nil {
+		return nil, fmt.Errorf("expected string or array of strings")
+	}
+	return list, nil
+}
+
+func appendCandidate(list []string, value string) []string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return list
+	}
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
 	}
+	return append(list, value)
+}
 
-	return Database{entries: entries}, nil
+func normalizeKey(key string) string {
+	return strings.ToLower(strings.TrimSpace(key))
 }
 
 func (db Database) Lookup(key string) (string, bool) {
-	if db.entries == nil {
+	candidates := db.Candidates(key)
+	if len(candidates) == 0 {
 		return "", false
 	}
-	normalized := strings.ToLower(strings.TrimSpace(key))
-	value, ok := db.entries[normalized]
-	return value, ok
+	return candidates[0], true
+}
+
+// Candidates returns every candidate stored for key in dictionary order.
+func (db Database) Candidates(key string) []string {
+	if db.entries == nil {
+		return nil
+	}
+	values := db.entries[normalizeKey(key)]
+	if len(values) == 0 {
+		return nil
+	}
+	out := make([]string, len(values))
+	copy(out, values)
+	return out
+}
+
+// Search returns candidates for a partially typed key: exact matches first,
+// then keys whose syllables start with the typed segments (so "zg" and
+// "zhongg" both find "zhongguo"), then other keys sharing the typed prefix.
+func (db Database) Search(query string) []string {
+	normalized := normalizeKey(query)
+	if normalized == "" || db.entries == nil {
+		return nil
+	}
+	var out []string
+	seen := make(map[string]struct{})
+	add := func(values []string) {
+		for _, value := range values {
+			if len(out) >= maxSearchResults {
+				return
+			}
+			if _, ok := seen[value]; ok {
+				continue
+			}
+			seen[value] = struct{}{}
+			out = append(out, value)
+		}
+	}
+
+	stripped := strings.ReplaceAll(normalized, "'", "")
+	add(db.entries[normalized])
+	add(db.entries[stripped])
+
+	if segments := segmentPinyin(normalized); len(segments) > 0 {
+		var matches []int
+		for _, idx := range db.abbrev[abbreviation(segments)] {
+			if syllablesMatch(db.records[idx].syllables, segments) {
+				matches = append(matches, idx)
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			return len(db.records[matches[i]].key) < len(db.records[matches[j]].key)
+		})
+		for _, idx := range matches {
+			add(db.entries[db.records[idx].raw])
+		}
+	}
+
+	start := sort.Search(len(db.records), func(i int) bool {
+		return db.records[i].key >= stripped
+	})
+	for i := start; i < len(db.records) && i-start < maxPrefixRecords; i++ {
+		if !strings.HasPrefix(db.records[i].key, stripped) {
+			break
+		}
+		add(db.entries[db.records[i].raw])
+	}
+	return out
+}
+
+func syllablesMatch(syllables, segments []string) bool {
+	if len(syllables) != len(segments) {
+		return false
+	}
+	for i, segment := range segments {
+		if !strings.HasPrefix(syllables[i], segment) {
+			return false
+		}
+	}
+	return true
 }
 
 func (db Database) Available() bool {
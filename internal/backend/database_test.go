@@ -0,0 +1,125 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadDatabaseAcceptsStringsAndLists(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.json")
+	contents := `{"Ni": "你", "hanja": ["漢字", "韓字", "漢字"], " ": "skip"}`
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp database: %v", err)
+	}
+
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatalf("LoadDatabase returned error: %v", err)
+	}
+
+	if value, ok := db.Lookup("ni"); !ok || value != "你" {
+		t.Fatalf("expected lookup of normalized key to return '你', got %q (ok=%v)", value, ok)
+	}
+
+	candidates := db.Candidates("hanja")
+	if len(candidates) != 2 || candidates[0] != "漢字" || candidates[1] != "韓字" {
+		t.Fatalf("expected deduplicated ordered candidates, got %v", candidates)
+	}
+
+	if _, ok := db.Lookup(""); ok {
+		t.Fatalf("expected blank keys to be dropped")
+	}
+}
+
+func TestLoadDatabaseRejectsInvalidValues(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "db.json")
+	if err := os.WriteFile(path, []byte(`{"ni": 3}`), 0o600); err != nil {
+		t.Fatalf("failed to write temp database: %v", err)
+	}
+
+	if _, err := LoadDatabase(path); err == nil {
+		t.Fatalf("expected error for non-string candidate")
+	}
+}
+
+func TestSearchPrefixAbbreviationAndSegmentation(t *testing.T) {
+	db := NewDatabase(map[string][]string{
+		"zhongguo": {"中国"},
+		"zhong":    {"中", "种"},
+		"xian":     {"先", "现"},
+		"xi'an":    {"西安"},
+		"한자":       {"漢字"},
+	})
+
+	if got := db.Search("zg"); len(got) == 0 || got[0] != "中国" {
+		t.Fatalf("expected abbreviation 'zg' to find '中国', got %v", got)
+	}
+	if got := db.Search("zhongg"); len(got) == 0 || got[0] != "中国" {
+		t.Fatalf("expected partial syllable to find '中国', got %v", got)
+	}
+	got := db.Search("zhon")
+	if len(got) < 3 || got[0] != "中" || got[1] != "种" || got[2] != "中国" {
+		t.Fatalf("expected shorter keys first for prefix 'zhon', got %v", got)
+	}
+	if got := db.Search("xi'an"); len(got) == 0 || got[0] != "西安" {
+		t.Fatalf("expected apostrophe to select '西安' first, got %v", got)
+	}
+	if got := db.Search("xian"); len(got) < 2 || got[0] != "先" || got[1] != "现" {
+		t.Fatalf("expected 'xian' to prefer the single syllable, got %v", got)
+	}
+	if got := db.Search("한"); len(got) != 1 || got[0] != "漢字" {
+		t.Fatalf("expected plain prefix search for non-pinyin keys, got %v", got)
+	}
+}
+
+func TestSegmentPinyin(t *testing.T) {
+	cases := map[string][]string{
+		"zhongguo": {"zhong", "guo"},
+		"xi'an":    {"xi", "an"},
+		"zg":       {"z", "g"},
+	}
+	for input, want := range cases {
+		got := segmentPinyin(input)
+		if len(got) != len(want) {
+			t.Fatalf("segmentPinyin(%q) = %v, want %v", input, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Fatalf("segmentPinyin(%q) = %v, want %v", input, got, want)
+			}
+		}
+	}
+	if segmentPinyin("한자") != nil {
+		t.Fatalf("expected non-pinyin keys to have no segmentation")
+	}
+}
+
+func largeDictionary() map[string][]string {
+	raw := make(map[string][]string, len(pinyinSyllables)*len(pinyinSyllables))
+	for i, first := range pinyinSyllables {
+		for j, second := range pinyinSyllables {
+			raw[first+second] = []string{string(rune(0x4E00 + i)), string(rune(0x4E00 + j))}
+		}
+	}
+	return raw
+}
+
+func BenchmarkNewDatabaseLarge(b *testing.B) {
+	raw := largeDictionary()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewDatabase(raw)
+	}
+}
+
+func BenchmarkSearchLarge(b *testing.B) {
+	db := NewDatabase(largeDictionary())
+	queries := []string{"zg", "zhongg", "xi'an", "shang", "n"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		db.Search(queries[i%len(queries)])
+	}
+}
@@ -0,0 +1,296 @@
+package backend
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Format names a dictionary file format understood by LoadDatabaseFormat.
+type Format string
+
+const (
+	FormatAuto      Format = ""
+	FormatJSON      Format = "json"
+	FormatRime      Format = "rime"
+	FormatSKK       Format = "skk"
+	FormatHanja     Format = "hanja"
+	FormatLibpinyin Format = "libpinyin"
+)
+
+// loadFunc parses a dictionary stream into keys and their ordered
+// candidates.
+type loadFunc func(r io.Reader) (map[string][]string, error)
+
+var loaders = map[Format]loadFunc{
+	FormatJSON:      loadJSON,
+	FormatRime:      loadRime,
+	FormatSKK:       loadSKK,
+	FormatHanja:     loadHanjaTxt,
+	FormatLibpinyin: loadLibpinyin,
+}
+
+// ParseFormat validates a user supplied format name. "auto" and the empty
+// string select detection by file name.
+func ParseFormat(name string) (Format, error) {
+	normalized := Format(strings.ToLower(strings.TrimSpace(name)))
+	switch normalized {
+	case FormatAuto, "auto":
+		return FormatAuto, nil
+	case "libhangul":
+		return FormatHanja, nil
+	case "jisyo":
+		return FormatSKK, nil
+	}
+	if _, ok := loaders[normalized]; !ok {
+		return FormatAuto, fmt.Errorf("unknown dictionary format %q", name)
+	}
+	return normalized, nil
+}
+
+// DetectFormat guesses the format of path from its file name.
+func DetectFormat(path string) Format {
+	name := strings.ToLower(filepath.Base(path))
+	switch {
+	case strings.HasSuffix(name, ".json"):
+		return FormatJSON
+	case strings.HasSuffix(name, ".yaml"), strings.HasSuffix(name, ".yml"):
+		return FormatRime
+	case strings.HasPrefix(name, "skk-jisyo"), strings.HasSuffix(name, ".jisyo"):
+		return FormatSKK
+	case strings.HasSuffix(name, ".table"):
+		return FormatLibpinyin
+	case strings.HasSuffix(name, ".txt"):
+		return FormatHanja
+	default:
+		return FormatJSON
+	}
+}
+
+// LoadDatabaseFormat loads path with the loader for format,
+// detecting the format from the file name when format is FormatAuto.
+func LoadDatabaseFormat(path string, format Format) (Database, error) {
+	if format == FormatAuto {
+		format = DetectFormat(path)
+	}
+	loader, ok := loaders[format]
+	if !ok {
+		return Database{}, fmt.Errorf("unknown dictionary format %q", format)
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return Database{}, fmt.Errorf("open backend database: %w", err)
+	}
+	defer file.Close()
+
+	raw, err := loader(file)
+	if err != nil {
+		return Database{}, fmt.Errorf("parse %s database %s: %w", format, path, err)
+	}
+	return NewDatabase(raw), nil
+}
+
+func loadJSON(r io.Reader) (map[string][]string, error) {
+	var raw map[string]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+	parsed := make(map[string][]string, len(raw))
+	for key, value := range raw {
+		candidates, err := decodeCandidates(value)
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %w", key, err)
+		}
+		parsed[key] = append(parsed[key], candidates...)
+	}
+	return parsed, nil
+}
+
+// weightedEntries collects candidates with an optional weight and orders
+// each key's candidates by descending weight, keeping file order for ties.
+type weightedEntries struct {
+	items []weightedItem
+}
+
+type weightedItem struct {
+	key       string
+	candidate string
+	weight    float64
+}
+
+func (w *weightedEntries) add(key, candidate string, weight float64) {
+	w.items = append(w.items, weightedItem{key: key, candidate: candidate, weight: weight})
+}
+
+func (w *weightedEntries) result() map[string][]string {
+	sort.SliceStable(w.items, func(i, j int) bool {
+		return w.items[i].weight > w.items[j].weight
+	})
+	out := make(map[string][]string)
+	for _, item := range w.items {
+		out[item.key] = append(out[item.key], item.candidate)
+	}
+	return out
+}
+
+func parseWeight(value string) float64 {
+	value = strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(value), "%"))
+	weight, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return 0
+	}
+	return weight
+}
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	return scanner
+}
+
+// loadRime reads a rime .dict.yaml file. The YAML header ends with "...";
+// the body has tab separated text, code and weight columns unless the
+// header's "columns" list says otherwise. Code syllables are separated by
+// spaces and are kept as apostrophe boundaries.
+func loadRime(r io.Reader) (map[string][]string, error) {
+	scanner := newLineScanner(r)
+	columns := []string{"text", "code", "weight"}
+	var headerColumns []string
+	inHeader := true
+	inColumns := false
+	var entries weightedEntries
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if inHeader {
+			trimmed := strings.TrimSpace(line)
+			switch {
+			case trimmed == "...":
+				inHeader = false
+				if len(headerColumns) > 0 {
+					columns = headerColumns
+				}
+			case strings.HasPrefix(trimmed, "columns:"):
+				inColumns = true
+			case inColumns && strings.HasPrefix(trimmed, "- "):
+				headerColumns = append(headerColumns, strings.TrimSpace(trimmed[2:]))
+			case inColumns && trimmed != "" && !strings.HasPrefix(trimmed, "#"):
+				inColumns = false
+			}
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, "\t")
+		var text, code string
+		var weight float64
+		for i, column := range columns {
+			if i >= len(fields) {
+				break
+			}
+			switch column {
+			case "text":
+				text = fields[i]
+			case "code":
+				code = strings.Join(strings.Fields(fields[i]), "'")
+			case "weight":
+				weight = parseWeight(fields[i])
+			}
+		}
+		if text == "" || code == "" {
+			continue
+		}
+		entries.add(code, text, weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if inHeader {
+		return nil, fmt.Errorf("missing '...' after the YAML header")
+	}
+	return entries.result(), nil
+}
+
+// loadSKK reads an SKK jisyo: "reading /cand1/cand2;annotation/". Only
+// UTF-8 dictionaries are supported; EUC-JP files must be converted first.
+func loadSKK(r io.Reader) (map[string][]string, error) {
+	scanner := newLineScanner(r)
+	out := make(map[string][]string)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.HasPrefix(line, ";") {
+			if strings.Contains(strings.ToLower(line), "coding: euc-jp") {
+				return nil, fmt.Errorf("EUC-JP dictionaries are not supported; convert to UTF-8")
+			}
+			continue
+		}
+		space := strings.Index(line, " /")
+		if space <= 0 {
+			continue
+		}
+		reading := line[:space]
+		for _, candidate := range strings.Split(line[space+2:], "/") {
+			if semi := strings.IndexByte(candidate, ';'); semi >= 0 {
+				candidate = candidate[:semi]
+			}
+			if candidate == "" {
+				continue
+			}
+			out[reading] = append(out[reading], candidate)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// loadHanjaTxt reads libhangul's hanja.txt: "hangul:hanja:description".
+func loadHanjaTxt(r io.Reader) (map[string][]string, error) {
+	scanner := newLineScanner(r)
+	out := make(map[string][]string)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) < 2 || fields[0] == "" || fields[1] == "" {
+			continue
+		}
+		out[fields[0]] = append(out[fields[0]], fields[1])
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// loadLibpinyin reads libpinyin table files: "pin'yin phrase [token]
+// [frequency]" separated by whitespace.
+func loadLibpinyin(r io.Reader) (map[string][]string, error) {
+	scanner := newLineScanner(r)
+	var entries weightedEntries
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		var weight float64
+		if len(fields) >= 4 {
+			weight = parseWeight(fields[3])
+		}
+		entries.add(fields[0], fields[1], weight)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return entries.result(), nil
+}
@@ -0,0 +1,134 @@
+package backend
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func writeDictionary(t *testing.T, name, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp dictionary: %v", err)
+	}
+	return path
+}
+
+func TestLoadRimeDictionaryOrdersByWeight(t *testing.T) {
+	path := writeDictionary(t, "luna_pinyin.dict.yaml", `# Rime dictionary
+---
+name: luna_pinyin
+version: "1"
+sort: by_weight
+...
+
+泥	ni	10
+你	ni	100
+西安	xi an	5
+`)
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatalf("LoadDatabase returned error: %v", err)
+	}
+	if got := db.Candidates("ni"); !reflect.DeepEqual(got, []string{"你", "泥"}) {
+		t.Fatalf("expected weight order, got %v", got)
+	}
+	if got := db.Candidates("xi'an"); !reflect.DeepEqual(got, []string{"西安"}) {
+		t.Fatalf("expected multi-syllable code to keep boundaries, got %v", got)
+	}
+}
+
+func TestLoadRimeDictionaryHonoursColumns(t *testing.T) {
+	path := writeDictionary(t, "custom.dict.yaml", `---
+name: custom
+columns:
+  - code
+  - text
+...
+ni	你
+`)
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatalf("LoadDatabase returned error: %v", err)
+	}
+	if value, ok := db.Lookup("ni"); !ok || value != "你" {
+		t.Fatalf("expected custom column order to be honoured, got %q", value)
+	}
+}
+
+func TestLoadSKKDictionary(t *testing.T) {
+	path := writeDictionary(t, "SKK-JISYO.S", `;; -*- coding: utf-8 -*-
+;; okuri-nasi entries.
+かんじ /漢字/感じ;feeling/幹事/
+にほん /日本/
+`)
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatalf("LoadDatabase returned error: %v", err)
+	}
+	if got := db.Candidates("かんじ"); !reflect.DeepEqual(got, []string{"漢字", "感じ", "幹事"}) {
+		t.Fatalf("expected annotations to be stripped, got %v", got)
+	}
+}
+
+func TestLoadSKKRejectsEUCJP(t *testing.T) {
+	path := writeDictionary(t, "SKK-JISYO.L", ";; -*- coding: euc-jp -*-\n")
+	if _, err := LoadDatabase(path); err == nil {
+		t.Fatalf("expected EUC-JP dictionary to be rejected")
+	}
+}
+
+func TestLoadLibhangulHanja(t *testing.T) {
+	path := writeDictionary(t, "hanja.txt", `# libhangul hanja dictionary
+가:家:집 가
+가:可:옳을 가
+한자:漢字:한자
+`)
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatalf("LoadDatabase returned error: %v", err)
+	}
+	if got := db.Candidates("가"); !reflect.DeepEqual(got, []string{"家", "可"}) {
+		t.Fatalf("unexpected hanja candidates %v", got)
+	}
+	if value, ok := db.Lookup("한자"); !ok || value != "漢字" {
+		t.Fatalf("expected 한자 to map to 漢字, got %q", value)
+	}
+}
+
+func TestLoadLibpinyinTable(t *testing.T) {
+	path := writeDictionary(t, "gb_char.table", "ni\t泥\t16777217\t3\nni\t你\t16777218\t900\nzhong'guo\t中国\t33554433\t50\n")
+	db, err := LoadDatabase(path)
+	if err != nil {
+		t.Fatalf("LoadDatabase returned error: %v", err)
+	}
+	if got := db.Candidates("ni"); !reflect.DeepEqual(got, []string{"你", "泥"}) {
+		t.Fatalf("expected frequency order, got %v", got)
+	}
+	if got := db.Search("zg"); len(got) == 0 || got[0] != "中国" {
+		t.Fatalf("expected table entries to be searchable, got %v", got)
+	}
+}
+
+func TestLoadDatabaseFormatOverridesDetection(t *testing.T) {
+	path := writeDictionary(t, "dictionary.dat", "가:家:집 가\n")
+	if _, err := LoadDatabase(path); err == nil {
+		t.Fatalf("expected unknown extension to be parsed as JSON and fail")
+	}
+	format, err := ParseFormat("libhangul")
+	if err != nil {
+		t.Fatalf("ParseFormat returned error: %v", err)
+	}
+	db, err := LoadDatabaseFormat(path, format)
+	if err != nil {
+		t.Fatalf("LoadDatabaseFormat returned error: %v", err)
+	}
+	if value, ok := db.Lookup("가"); !ok || value != "家" {
+		t.Fatalf("expected forced hanja format to load, got %q", value)
+	}
+	if _, err := ParseFormat("cangjie"); err == nil {
+		t.Fatalf("expected unknown format name to be rejected")
+	}
+}
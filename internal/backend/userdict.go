@@ -0,0 +1,351 @@
+package backend
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// recencyHalfLife is how long it takes for a selection to lose half of its
+// weight when ranking candidates.
+const recencyHalfLife = 30 * 24 * time.Hour
+
+// refreshInterval is how often Record and Rank look for changes another
+// process made to the file. Save always looks.
+const refreshInterval = time.Second
+
+// UserDictionary remembers which candidate the user picked for each key and
+// reorders future candidate lists accordingly. A nil *UserDictionary is valid
+// and leaves candidate order untouched.
+//
+// The file may change underneath a running daemon, for example through
+// "hanfe userdict reset". The dictionary then reloads it and applies only
+// the selections it has not saved yet, so the change is not undone.
+type UserDictionary struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]map[string]Usage
+	now     func() time.Time
+	// file is the file as last read or written; nil when there was none.
+	file os.FileInfo
+	// unsaved are the selections recorded since the last save.
+	unsaved []selection
+	timer   *time.Timer
+	// checked is when the file was last looked at.
+	checked time.Time
+	warn    func(error)
+}
+
+type selection struct {
+	key, candidate string
+	at             int64
+}
+
+// Usage records how often and how recently a candidate was chosen.
+type Usage struct {
+	Count    int   `json:"count"`
+	LastUsed int64 `json:"last_used"`
+}
+
+// DefaultUserDictionaryPath returns $XDG_DATA_HOME/hanfe/userdict.json,
+// falling back to ~/.local/share when XDG_DATA_HOME is unset.
+func DefaultUserDictionaryPath() string {
+	if dataDir := os.Getenv("XDG_DATA_HOME"); dataDir != "" {
+		return filepath.Join(dataDir, "hanfe", "userdict.json")
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" {
+		return filepath.Join(home, ".local", "share", "hanfe", "userdict.json")
+	}
+	return filepath.Join(os.TempDir(), "hanfe-userdict.json")
+}
+
+// LoadUserDictionary reads the learned data at path. A missing file yields
+// an empty dictionary that will be created on the first Save.
+func LoadUserDictionary(path string) (*UserDictionary, error) {
+	dict := &UserDictionary{path: path, entries: make(map[string]map[string]Usage), now: time.Now}
+	if err := dict.load(); err != nil {
+		return nil, err
+	}
+	dict.checked = time.Now()
+	return dict, nil
+}
+
+// load replaces the entries with the file's contents.
+func (u *UserDictionary) load() error {
+	entries := make(map[string]map[string]Usage)
+	info, err := os.Stat(u.path)
+	if errors.Is(err, os.ErrNotExist) {
+		u.entries, u.file = entries, nil
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read user dictionary: %w", err)
+	}
+	data, err := os.ReadFile(u.path)
+	if err != nil {
+		return fmt.Errorf("read user dictionary: %w", err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &entries); err != nil {
+			return fmt.Errorf("parse user dictionary %s: %w", u.path, err)
+		}
+		if entries == nil {
+			entries = make(map[string]map[string]Usage)
+		}
+	}
+	u.entries, u.file = entries, info
+	return nil
+}
+
+// refresh reloads the file if something else changed it since it was last
+// read or written, and applies the unsaved selections again. The caller
+// holds u.mu.
+func (u *UserDictionary) refresh() error {
+	u.checked = time.Now()
+	info, err := os.Stat(u.path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("read user dictionary: %w", err)
+	}
+	if err != nil {
+		info = nil
+	}
+	if sameFile(u.file, info) {
+		return nil
+	}
+	if err := u.load(); err != nil {
+		return err
+	}
+	for _, sel := range u.unsaved {
+		u.apply(sel)
+	}
+	return nil
+}
+
+// refreshThrottled is refresh for the lookups on the typing path: it
+// looks at the file at most once per refreshInterval and passes errors to
+// the warning handler. The caller holds u.mu.
+func (u *UserDictionary) refreshThrottled() {
+	if time.Since(u.checked) < refreshInterval {
+		return
+	}
+	if err := u.refresh(); err != nil && u.warn != nil {
+		u.warn(err)
+	}
+}
+
+func sameFile(a, b os.FileInfo) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+	return os.SameFile(a, b) && a.Size() == b.Size() && a.ModTime().Equal(b.ModTime())
+}
+
+// SetWarningHandler passes handler the errors Record and Rank run into
+// while reloading a file that changed. They are dropped without one.
+func (u *UserDictionary) SetWarningHandler(handler func(error)) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	u.warn = handler
+	u.mu.Unlock()
+}
+
+// Path reports where the dictionary is persisted.
+func (u *UserDictionary) Path() string {
+	if u == nil {
+		return ""
+	}
+	return u.path
+}
+
+// Record notes that candidate was chosen for key.
+func (u *UserDictionary) Record(key, candidate string) {
+	if u == nil {
+		return
+	}
+	key = normalizeKey(key)
+	if key == "" || candidate == "" {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.refreshThrottled()
+	sel := selection{key: key, candidate: candidate, at: u.now().Unix()}
+	u.apply(sel)
+	u.unsaved = append(u.unsaved, sel)
+}
+
+func (u *UserDictionary) apply(sel selection) {
+	usages := u.entries[sel.key]
+	if usages == nil {
+		usages = make(map[string]Usage)
+		u.entries[sel.key] = usages
+	}
+	usage := usages[sel.candidate]
+	usage.Count++
+	usage.LastUsed = sel.at
+	usages[sel.candidate] = usage
+}
+
+// Rank returns candidates ordered by learned score. Candidates the user has
+// never picked keep their dictionary order after the learned ones.
+func (u *UserDictionary) Rank(key string, candidates []string) []string {
+	if u == nil || len(candidates) < 2 {
+		return candidates
+	}
+	u.mu.Lock()
+	u.refreshThrottled()
+	usages := u.entries[normalizeKey(key)]
+	scores := make([]float64, len(candidates))
+	now := u.now()
+	for i, candidate := range candidates {
+		if usage, ok := usages[candidate]; ok {
+			scores[i] = usage.score(now)
+		}
+	}
+	u.mu.Unlock()
+
+	order := make([]int, len(candidates))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	ranked := make([]string, len(candidates))
+	for i, idx := range order {
+		ranked[i] = candidates[idx]
+	}
+	return ranked
+}
+
+func (usage Usage) score(now time.Time) float64 {
+	age := now.Sub(time.Unix(usage.LastUsed, 0))
+	if age < 0 {
+		age = 0
+	}
+	decay := math.Pow(0.5, float64(age)/float64(recencyHalfLife))
+	return float64(usage.Count) * decay
+}
+
+// Save atomically writes the dictionary: the data goes to a temporary file
+// in the same directory, which is synced and then renamed over the target.
+func (u *UserDictionary) Save() error {
+	if u == nil || u.path == "" {
+		return nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if err := u.refresh(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(u.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode user dictionary: %w", err)
+	}
+
+	dir := filepath.Dir(u.path)
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return fmt.Errorf("create user dictionary dir: %w", err)
+	}
+	tmp, err := os.CreateTemp(dir, ".userdict-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temporary user dictionary: %w", err)
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("write user dictionary: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("sync user dictionary: %w", err)
+	}
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return fmt.Errorf("stat user dictionary: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close user dictionary: %w", err)
+	}
+	if err := os.Rename(tmpPath, u.path); err != nil {
+		return fmt.Errorf("replace user dictionary: %w", err)
+	}
+	u.file = info
+	u.unsaved = nil
+	return nil
+}
+
+// SaveLater saves the dictionary delay after the last call, so a burst of
+// selections is written once. A failed save is passed to report.
+func (u *UserDictionary) SaveLater(delay time.Duration, report func(error)) {
+	if u == nil {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.timer != nil {
+		u.timer.Stop()
+	}
+	u.timer = time.AfterFunc(delay, func() {
+		if err := u.Save(); err != nil && report != nil {
+			report(err)
+		}
+	})
+}
+
+// Close saves the selections still waiting for SaveLater.
+func (u *UserDictionary) Close() error {
+	if u == nil {
+		return nil
+	}
+	u.mu.Lock()
+	if u.timer != nil {
+		u.timer.Stop()
+		u.timer = nil
+	}
+	unsaved := len(u.unsaved) > 0
+	u.mu.Unlock()
+	if !unsaved {
+		return nil
+	}
+	return u.Save()
+}
+
+// Export writes the learned data as indented JSON.
+func (u *UserDictionary) Export(w io.Writer) error {
+	u.mu.Lock()
+	data, err := json.MarshalIndent(u.entries, "", "  ")
+	u.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("encode user dictionary: %w", err)
+	}
+	if _, err := w.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Reset forgets everything that was learned and removes the persisted file.
+func (u *UserDictionary) Reset() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.entries = make(map[string]map[string]Usage)
+	u.unsaved = nil
+	if err := os.Remove(u.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("remove user dictionary: %w", err)
+	}
+	u.file = nil
+	return nil
+}
@@ -0,0 +1,163 @@
+package backend
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestUserDictionaryRanksByFrequencyAndRecency(t *testing.T) {
+	dict, err := LoadUserDictionary(filepath.Join(t.TempDir(), "userdict.json"))
+	if err != nil {
+		t.Fatalf("LoadUserDictionary returned error: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+	dict.now = func() time.Time { return now }
+
+	candidates := []string{"你", "尼", "泥"}
+	if got := dict.Rank("ni", candidates); got[0] != "你" || got[1] != "尼" || got[2] != "泥" {
+		t.Fatalf("expected dictionary order without history, got %v", got)
+	}
+
+	dict.Record("ni", "泥")
+	if got := dict.Rank("ni", candidates); got[0] != "泥" || got[1] != "你" || got[2] != "尼" {
+		t.Fatalf("expected picked candidate first, got %v", got)
+	}
+
+	dict.Record("ni", "泥")
+	now = now.Add(90 * 24 * time.Hour)
+	dict.Record("ni", "尼")
+	if got := dict.Rank("ni", candidates); got[0] != "尼" || got[1] != "泥" {
+		t.Fatalf("expected recent pick to outrank stale frequent pick, got %v", got)
+	}
+}
+
+func TestUserDictionarySaveLoadAndReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "userdict.json")
+	dict, err := LoadUserDictionary(path)
+	if err != nil {
+		t.Fatalf("LoadUserDictionary returned error: %v", err)
+	}
+	dict.Record("ni", "尼")
+	if err := dict.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("read dir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the dictionary file after an atomic save, got %d entries", len(entries))
+	}
+
+	reloaded, err := LoadUserDictionary(path)
+	if err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	if got := reloaded.Rank("ni", []string{"你", "尼"}); got[0] != "尼" {
+		t.Fatalf("expected learned ranking to survive reload, got %v", got)
+	}
+
+	var buf bytes.Buffer
+	if err := reloaded.Export(&buf); err != nil {
+		t.Fatalf("Export returned error: %v", err)
+	}
+	if !bytes.Contains(buf.Bytes(), []byte("尼")) {
+		t.Fatalf("expected export to contain learned candidate, got %s", buf.String())
+	}
+
+	if err := reloaded.Reset(); err != nil {
+		t.Fatalf("Reset returned error: %v", err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected reset to remove %s, stat err=%v", path, err)
+	}
+	if got := reloaded.Rank("ni", []string{"你", "尼"}); got[0] != "你" {
+		t.Fatalf("expected reset to forget rankings, got %v", got)
+	}
+}
+
+func TestNilUserDictionaryIsNoop(t *testing.T) {
+	var dict *UserDictionary
+	dict.Record("ni", "尼")
+	if got := dict.Rank("ni", []string{"你", "尼"}); got[0] != "你" {
+		t.Fatalf("expected nil dictionary to keep order, got %v", got)
+	}
+	if err := dict.Save(); err != nil {
+		t.Fatalf("expected nil save to succeed, got %v", err)
+	}
+}
+
+func TestUserDictionaryKeepsExternalReset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "userdict.json")
+	daemon, err := LoadUserDictionary(path)
+	if err != nil {
+		t.Fatalf("LoadUserDictionary returned error: %v", err)
+	}
+	daemon.Record("ni", "尼")
+	if err := daemon.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	// "hanfe userdict reset" runs while the daemon keeps learning.
+	cli, err := LoadUserDictionary(path)
+	if err != nil {
+		t.Fatalf("LoadUserDictionary returned error: %v", err)
+	}
+	if err := cli.Reset(); err != nil {
+		t.Fatalf("Reset returned error: %v", err)
+	}
+	daemon.Record("ni", "泥")
+	daemon.SaveLater(time.Hour, nil)
+	if err := daemon.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	}
+
+	reloaded, err := LoadUserDictionary(path)
+	if err != nil {
+		t.Fatalf("reload returned error: %v", err)
+	}
+	if got := reloaded.Rank("ni", []string{"你", "尼", "泥"}); got[0] != "泥" || got[1] != "你" {
+		t.Fatalf("expected only the selection made after the reset, got %v", got)
+	}
+}
+
+func TestUserDictionaryChecksFileOncePerInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "userdict.json")
+	daemon, err := LoadUserDictionary(path)
+	if err != nil {
+		t.Fatalf("LoadUserDictionary returned error: %v", err)
+	}
+	var warnings []error
+	daemon.SetWarningHandler(func(err error) { warnings = append(warnings, err) })
+
+	other, err := LoadUserDictionary(path)
+	if err != nil {
+		t.Fatalf("LoadUserDictionary returned error: %v", err)
+	}
+	other.Record("ni", "泥")
+	if err := other.Save(); err != nil {
+		t.Fatalf("Save returned error: %v", err)
+	}
+
+	candidates := []string{"你", "泥"}
+	if got := daemon.Rank("ni", candidates); got[0] != "你" {
+		t.Fatalf("expected the file not to be read again within the interval, got %v", got)
+	}
+	daemon.checked = daemon.checked.Add(-refreshInterval)
+	if got := daemon.Rank("ni", candidates); got[0] != "泥" {
+		t.Fatalf("expected the external change after the interval, got %v", got)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatalf("failed to write broken dictionary: %v", err)
+	}
+	daemon.checked = daemon.checked.Add(-refreshInterval)
+	daemon.Rank("ni", candidates)
+	if len(warnings) != 1 {
+		t.Fatalf("expected the broken file to be reported once, got %v", warnings)
+	}
+}
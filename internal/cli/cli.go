@@ -8,6 +8,7 @@ import (
 type Options struct {
 	ShowHelp         bool
 	ListLayouts      bool
+	ListOutputs      bool
 	DevicePath       string
 	LayoutName       string
 	ToggleConfigPath string
@@ -16,12 +17,22 @@ type Options struct {
 	PTYPath          string
 	Daemonize        bool
 	SuppressHex      bool
+	Output           []string
 	ModeOrder        []string
 	KeypairPath      string
 	PinyinDBPath     string
+	HanjaDBPath      string
+	KanjiDBPath      string
+	DBFormat         string
+	UserDictPath     string
+	UserDictAction   string
+	UserDictOutput   string
 }
 
 func Parse(args []string) (Options, error) {
+	if len(args) > 1 && args[1] == "userdict" {
+		return parseUserDictCommand(args[2:])
+	}
 	opts := Options{Daemonize: true}
 	for i := 1; i < len(args); i++ {
 		arg := args[i]
@@ -30,6 +41,8 @@ func Parse(args []string) (Options, error) {
 			opts.ShowHelp = true
 		case arg == "--list-layouts":
 			opts.ListLayouts = true
+		case arg == "--list-outputs":
+			opts.ListOutputs = true
 		case arg == "--daemon":
 			opts.Daemonize = true
 		case arg == "--no-daemon" || arg == "--foreground":
@@ -62,6 +75,13 @@ func Parse(args []string) (Options, error) {
 			}
 			opts.ModeOrder = splitList(value)
 			i = next
+		case strings.HasPrefix(arg, "--output"):
+			value, next, err := extractValue(arg, i, args)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.Output = splitList(value)
+			i = next
 		case strings.HasPrefix(arg, "--toggle-config"):
 			value, next, err := extractValue(arg, i, args)
 			if err != nil {
@@ -83,6 +103,34 @@ func Parse(args []string) (Options, error) {
 			}
 			opts.PinyinDBPath = value
 			i = next
+		case strings.HasPrefix(arg, "--hanja-db"):
+			value, next, err := extractValue(arg, i, args)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.HanjaDBPath = value
+			i = next
+		case strings.HasPrefix(arg, "--kanji-db"):
+			value, next, err := extractValue(arg, i, args)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.KanjiDBPath = value
+			i = next
+		case strings.HasPrefix(arg, "--db-format"):
+			value, next, err := extractValue(arg, i, args)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.DBFormat = value
+			i = next
+		case strings.HasPrefix(arg, "--user-dict"):
+			value, next, err := extractValue(arg, i, args)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.UserDictPath = value
+			i = next
 		case strings.HasPrefix(arg, "--tty"):
 			value, next, err := extractValue(arg, i, args)
 			if err != nil {
@@ -106,6 +154,37 @@ func Parse(args []string) (Options, error) {
 	return opts, nil
 }
 
+// parseUserDictCommand handles "hanfe userdict export [--user-dict PATH]
+// [OUTPUT]" and "hanfe userdict reset [--user-dict PATH]".
+func parseUserDictCommand(args []string) (Options, error) {
+	if len(args) == 0 {
+		return Options{}, fmt.Errorf("userdict requires an action (export or reset)")
+	}
+	opts := Options{UserDictAction: args[0]}
+	switch opts.UserDictAction {
+	case "export", "reset":
+	default:
+		return Options{}, fmt.Errorf("unknown userdict action: %s", args[0])
+	}
+	for i := 1; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.HasPrefix(arg, "--user-dict"):
+			value, next, err := extractValue(arg, i, args)
+			if err != nil {
+				return Options{}, err
+			}
+			opts.UserDictPath = value
+			i = next
+		case opts.UserDictAction == "export" && opts.UserDictOutput == "" && !strings.HasPrefix(arg, "-"):
+			opts.UserDictOutput = arg
+		default:
+			return Options{}, fmt.Errorf("unknown userdict option: %s", arg)
+		}
+	}
+	return opts, nil
+}
+
 func extractValue(current string, index int, args []string) (string, int, error) {
 	if eq := strings.IndexRune(current, '='); eq >= 0 {
 		return current[eq+1:], index, nil
@@ -134,6 +213,8 @@ func splitList(value string) []string {
 func Usage() string {
 	return `hanfe - Hangul IME interceptor
 Usage: hanfe [--device /dev/input/eventX] [options]
+       hanfe userdict export [--user-dict PATH] [OUTPUT]
+       hanfe userdict reset [--user-dict PATH]
 
 Options:
   --device PATH           Path to the evdev keyboard device (auto-detected if omitted)
@@ -142,12 +223,19 @@ Options:
   --mode-order LIST       Comma-separated input mode cycle (overrides toggle.ini)
   --toggle-config PATH    Path to toggle.ini (default: ./toggle.ini if present)
   --keypairs PATH         JSON file describing custom keypairs to merge into the layout
-  --pinyin-db PATH        JSON database for database-backed input (e.g. Pinyin)
+  --pinyin-db PATH        Dictionary mapping keys to ordered candidate lists (e.g. Pinyin)
+  --hanja-db PATH         Hangul-to-Hanja dictionary used by the Hanja key
+  --kanji-db PATH         Kana-to-kanji dictionary used by the kana and romaji modes
+  --db-format LIST        Dictionary formats as DB=FORMAT pairs, e.g. pinyin=rime,hanja=hanja
+                          (formats: auto, json, rime, skk, hanja, libpinyin; default: auto)
+  --user-dict PATH        Learned candidate frequencies (default: $XDG_DATA_HOME/hanfe/userdict.json)
   --tty PATH              TTY to mirror text output to (defaults to controlling TTY)
   --pty PATH              Optional PTY to mirror committed text without raw hex
   --no-hex                Skip Unicode hex injection and rely on direct TTY/PTY mirroring
+  --output LIST           Comma-separated output backends to try in order (overrides toggle.ini)
   --daemon                Run in the background (default)
   --no-daemon             Stay in the foreground
   --list-layouts          List available layouts
+  --list-outputs          List output backends and their capabilities
   -h, --help              Show this help message`
 }
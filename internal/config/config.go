@@ -5,20 +5,208 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/gg582/hanfe/internal/hangul"
 	"github.com/gg582/hanfe/internal/linux"
 )
 
 type ToggleChord struct {
 	Key            uint16
 	ModifierGroups [][]uint16
+	Trigger        ChordTrigger
 }
 
+// ChordTrigger selects when a chord fires.
+type ChordTrigger int
+
+const (
+	// TriggerPress fires when the key goes down.
+	TriggerPress ChordTrigger = iota
+	// TriggerTap fires on release when no other key was pressed in
+	// between and the key was held for less than the tap timeout.
+	TriggerTap
+	// TriggerDoubleTap fires on the second of two taps within the tap
+	// timeout.
+	TriggerDoubleTap
+	// TriggerHold fires once the key has been held, alone, for the hold
+	// timeout.
+	TriggerHold
+)
+
 type ToggleConfig struct {
 	Chords      []ToggleChord
 	DefaultMode string
 	ModeCycle   []string
+	// Reconvert chords retype the current word in the other script.
+	Reconvert []ToggleChord
+	// Select maps a mode name to the chords that switch straight to it.
+	Select map[string][]ToggleChord
+	// Previous chords return to the mode that was active before the
+	// current one.
+	Previous []ToggleChord
+	// Modes holds the [mode.<name>] sections keyed by lower-case mode name.
+	Modes map[string]ModeOptions
+	Auto  AutoConfig
+	// TapTimeout and HoldTimeout tune tap, double-tap and hold chords.
+	// Zero selects the engine defaults.
+	TapTimeout  time.Duration
+	HoldTimeout time.Duration
+	// LED lights while a non-Latin mode is active.
+	LED Indicator
+	// Remember keeps a separate input mode for each window or WM_CLASS.
+	Remember RememberMode
+	// Rules is the [rules] section in file order; the first match wins.
+	Rules []Rule
+	// Output lists output backends to try in order; empty selects the
+	// default chain.
+	Output []string
+	Paste  PasteConfig
+}
+
+// DefaultPasteThreshold is the shortest commit pasted when [paste] sets
+// no threshold.
+const DefaultPasteThreshold = 16
+
+// PasteConfig is the [paste] section: in the listed applications, long
+// commits are pasted through an X11 selection instead of typed.
+type PasteConfig struct {
+	// Threshold is the shortest commit, in characters, that is pasted.
+	Threshold int
+	// Primary pastes from the PRIMARY selection instead of CLIPBOARD.
+	Primary bool
+	// Apps lists where to paste, in file order; the first match wins.
+	Apps []PasteRule
+}
+
+// PasteRule enables pasting in windows whose Field matches Pattern.
+type PasteRule struct {
+	Field   string
+	Pattern string
+	// ShiftInsert pastes with Shift+Insert instead of Ctrl+V, as most
+	// terminals expect.
+	ShiftInsert bool
+}
+
+// Matches reports whether value, the rule's Field of a window, matches.
+func (r PasteRule) Matches(value string) bool {
+	return matchPattern(r.Pattern, value)
+}
+
+// RuleAction is what a [rules] entry does to a matching window.
+type RuleAction string
+
+const (
+	// RuleForce keeps the window in Mode and ignores mode switching keys.
+	RuleForce RuleAction = "force"
+	// RuleDefault selects Mode when the window has no remembered mode.
+	RuleDefault RuleAction = "default"
+	// RuleBypass forwards every key unchanged.
+	RuleBypass RuleAction = "bypass"
+)
+
+// Rule applies an action to windows whose Field matches Pattern.
+type Rule struct {
+	// Field is "class", "instance", "process" or "title".
+	Field string
+	// Pattern is a case-insensitive shell pattern.
+	Pattern string
+	Action  RuleAction
+	Mode    string
+}
+
+// Matches reports whether value, the rule's Field of a window, matches.
+func (r Rule) Matches(value string) bool {
+	return matchPattern(r.Pattern, value)
+}
+
+func matchPattern(pattern, value string) bool {
+	ok, err := path.Match(strings.ToLower(pattern), strings.ToLower(value))
+	return err == nil && ok
+}
+
+// RememberMode selects what the input mode is remembered for.
+type RememberMode string
+
+const (
+	RememberOff    RememberMode = ""
+	RememberWindow RememberMode = "window"
+	RememberClass  RememberMode = "class"
+)
+
+// Indicator names the keyboard LED that shows the input mode.
+type Indicator int
+
+const (
+	IndicatorNone Indicator = iota
+	IndicatorCaps
+	IndicatorScroll
+	IndicatorKana
+	IndicatorCompose
+)
+
+// AutoConfig is the [auto] section: automatic switching between Latin and
+// Hangul at word boundaries.
+type AutoConfig struct {
+	Enabled bool
+	// Undo chords revert the last automatic switch. The engine uses
+	// Backspace when none are configured.
+	Undo []ToggleChord
+	// Exclude lists WM_CLASS names where automatic switching is disabled.
+	Exclude []string
+	// Words is an optional file of extra English words, one per line.
+	Words string
+}
+
+// ModeOptions are per-mode composer settings.
+type ModeOptions struct {
+	// Moachigi accepts the jamo of a syllable in any order.
+	Moachigi bool
+	// Normalization rewrites committed and preedit text before output.
+	Normalization hangul.Normalization
+	// Backspace selects the composer's backspace policy.
+	Backspace hangul.BackspacePolicy
+}
+
+// ModeOptions returns the options configured for the named mode.
+func (c ToggleConfig) ModeOptions(name string) ModeOptions {
+	return c.Modes[strings.ToLower(strings.TrimSpace(name))]
+}
+
+// NormalizeModeOptions re-keys the [mode.<name>] sections by normalize,
+// so that an alias such as [mode.hangul] reaches the mode it stands for.
+// A section naming the mode directly wins over an alias, the first alias
+// in sorted order wins over the others, and sections that normalize to ""
+// are dropped.
+func (c *ToggleConfig) NormalizeModeOptions(normalize func(string) string) {
+	if len(c.Modes) == 0 {
+		return
+	}
+	names := make([]string, 0, len(c.Modes))
+	for name := range c.Modes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	modes := make(map[string]ModeOptions, len(c.Modes))
+	for _, name := range names {
+		target := normalize(name)
+		if target == "" {
+			continue
+		}
+		if _, taken := modes[target]; taken {
+			continue
+		}
+		if _, direct := c.Modes[target]; direct && target != name {
+			continue
+		}
+		modes[target] = c.Modes[name]
+	}
+	c.Modes = modes
 }
 
 type ConfigError struct {
@@ -47,10 +235,26 @@ func LoadToggleConfig(path string) (ToggleConfig, error) {
 
 	scanner := bufio.NewScanner(file)
 	inToggle := false
+	inAuto := false
+	inRules := false
+	inPaste := false
+	paste := PasteConfig{Threshold: DefaultPasteThreshold}
+	var rules []Rule
+	var modeSection string
+	var auto AutoConfig
+	var undoLine string
+	modes := make(map[string]ModeOptions)
 	var keyLine string
 	var keysLine string
 	var modeLine string
 	var cycleLine string
+	var reconvertLine string
+	var previousLine string
+	var tapTimeout, holdTimeout time.Duration
+	var ledLine string
+	var remember RememberMode
+	var output []string
+	selectLines := make(map[string]string)
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -60,9 +264,16 @@ func LoadToggleConfig(path string) (ToggleConfig, error) {
 		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
 			section := strings.TrimSpace(line[1 : len(line)-1])
 			inToggle = strings.EqualFold(section, "toggle")
+			inAuto = strings.EqualFold(section, "auto")
+			inRules = strings.EqualFold(section, "rules")
+			inPaste = strings.EqualFold(section, "paste")
+			modeSection = ""
+			if len(section) > len("mode.") && strings.EqualFold(section[:len("mode.")], "mode.") {
+				modeSection = strings.ToLower(strings.TrimSpace(section[len("mode."):]))
+			}
 			continue
 		}
-		if !inToggle {
+		if !inToggle && !inAuto && !inRules && !inPaste && modeSection == "" {
 			continue
 		}
 		parts := strings.SplitN(line, "=", 2)
@@ -71,6 +282,45 @@ func LoadToggleConfig(path string) (ToggleConfig, error) {
 		}
 		key := strings.TrimSpace(parts[0])
 		value := strings.TrimSpace(parts[1])
+		if modeSection != "" {
+			options := modes[modeSection]
+			if err := parseModeOption(&options, key, value); err != nil {
+				return ToggleConfig{}, err
+			}
+			modes[modeSection] = options
+			continue
+		}
+		if inRules {
+			rule, err := parseRule(key, value)
+			if err != nil {
+				return ToggleConfig{}, err
+			}
+			rules = append(rules, rule)
+			continue
+		}
+		if inPaste {
+			if err := parsePasteOption(&paste, key, value); err != nil {
+				return ToggleConfig{}, err
+			}
+			continue
+		}
+		if inAuto {
+			switch key {
+			case "enabled":
+				enabled, err := parseBool(value)
+				if err != nil {
+					return ToggleConfig{}, err
+				}
+				auto.Enabled = enabled
+			case "undo":
+				undoLine = value
+			case "exclude":
+				auto.Exclude = splitComma(value)
+			case "words":
+				auto.Words = expandHome(value)
+			}
+			continue
+		}
 		switch key {
 		case "key":
 			keyLine = value
@@ -80,6 +330,37 @@ func LoadToggleConfig(path string) (ToggleConfig, error) {
 			modeLine = value
 		case "mode_cycle":
 			cycleLine = value
+		case "reconvert":
+			reconvertLine = value
+		case "previous":
+			previousLine = value
+		case "tap_timeout":
+			timeout, err := parseMillis(key, value)
+			if err != nil {
+				return ToggleConfig{}, err
+			}
+			tapTimeout = timeout
+		case "hold_timeout":
+			timeout, err := parseMillis(key, value)
+			if err != nil {
+				return ToggleConfig{}, err
+			}
+			holdTimeout = timeout
+		case "led":
+			ledLine = value
+		case "remember":
+			parsed, err := parseRemember(value)
+			if err != nil {
+				return ToggleConfig{}, err
+			}
+			remember = parsed
+		case "output":
+			output = splitComma(value)
+		default:
+			if len(key) > len("select.") && strings.EqualFold(key[:len("select.")], "select.") {
+				// Mode names are resolved once the layouts are known.
+				selectLines[strings.ToLower(strings.TrimSpace(key[len("select."):]))] = value
+			}
 		}
 	}
 
@@ -105,7 +386,39 @@ func LoadToggleConfig(path string) (ToggleConfig, error) {
 		chords = append(chords, chord)
 	}
 
-	cfg := ToggleConfig{Chords: chords, DefaultMode: "dubeolsik"}
+	reconvert, err := parseChordList(reconvertLine)
+	if err != nil {
+		return ToggleConfig{}, err
+	}
+	if auto.Undo, err = parseChordList(undoLine); err != nil {
+		return ToggleConfig{}, err
+	}
+	previous, err := parseChordList(previousLine)
+	if err != nil {
+		return ToggleConfig{}, err
+	}
+	selects := make(map[string][]ToggleChord, len(selectLines))
+	for mode, line := range selectLines {
+		if selects[mode], err = parseChordList(line); err != nil {
+			return ToggleConfig{}, err
+		}
+	}
+
+	cfg := ToggleConfig{Chords: chords, DefaultMode: "dubeolsik", Modes: modes, Reconvert: reconvert, Select: selects, Previous: previous, Auto: auto}
+	cfg.TapTimeout = tapTimeout
+	cfg.HoldTimeout = holdTimeout
+	cfg.Remember = remember
+	cfg.Rules = rules
+	cfg.Output = output
+	cfg.Paste = paste
+	if ledLine != "" {
+		if cfg.LED, err = parseIndicator(ledLine); err != nil {
+			return ToggleConfig{}, err
+		}
+	} else if togglesOnKey(chords, uint16(linux.KeyCapsLock)) {
+		// Caps Lock no longer lights its own LED; let it show the mode.
+		cfg.LED = IndicatorCaps
+	}
 	if modeLine != "" {
 		cfg.DefaultMode = normalizeModeName(modeLine)
 	}
@@ -127,6 +440,49 @@ func LoadToggleConfig(path string) (ToggleConfig, error) {
 	return cfg, nil
 }
 
+func parseModeOption(options *ModeOptions, key, value string) error {
+	switch key {
+	case "moachigi":
+		enabled, err := parseBool(value)
+		if err != nil {
+			return err
+		}
+		options.Moachigi = enabled
+	case "normalization":
+		form, err := hangul.ParseNormalization(value)
+		if err != nil {
+			return ConfigError{msg: err.Error()}
+		}
+		options.Normalization = form
+	case "backspace":
+		policy, err := hangul.ParseBackspacePolicy(value)
+		if err != nil {
+			return ConfigError{msg: err.Error()}
+		}
+		options.Backspace = policy
+	}
+	return nil
+}
+
+func parseBool(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "1", "true", "yes", "on":
+		return true, nil
+	case "0", "false", "no", "off":
+		return false, nil
+	}
+	return false, ConfigError{msg: fmt.Sprintf("invalid boolean '%s'", value)}
+}
+
+// parseMillis parses a positive duration in milliseconds.
+func parseMillis(key, value string) (time.Duration, error) {
+	ms, err := strconv.Atoi(value)
+	if err != nil || ms <= 0 {
+		return 0, ConfigError{msg: fmt.Sprintf("invalid %s '%s': expected milliseconds", key, value)}
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
 func splitComma(value string) []string {
 	parts := strings.Split(value, ",")
 	out := make([]string, 0, len(parts))
@@ -139,13 +495,34 @@ func splitComma(value string) []string {
 	return out
 }
 
+// parseChordList parses a comma separated list of chords.
+func parseChordList(line string) ([]ToggleChord, error) {
+	var chords []ToggleChord
+	for _, token := range splitComma(line) {
+		chord, err := parseToggleExpression(token)
+		if err != nil {
+			return nil, err
+		}
+		chords = append(chords, chord)
+	}
+	return chords, nil
+}
+
 func parseToggleExpression(expr string) (ToggleChord, error) {
+	chord := ToggleChord{}
+	if prefix, rest, ok := strings.Cut(expr, ":"); ok {
+		trigger, err := parseTrigger(prefix)
+		if err != nil {
+			return ToggleChord{}, err
+		}
+		chord.Trigger = trigger
+		expr = rest
+	}
 	segments := strings.Split(expr, "+")
 	if len(segments) == 0 {
 		return ToggleChord{}, ConfigError{msg: fmt.Sprintf("invalid toggle expression '%s'", expr)}
 	}
 
-	chord := ToggleChord{}
 	for i, segment := range segments {
 		codes, err := parseKeyToken(segment)
 		if err != nil {
@@ -166,6 +543,157 @@ func parseToggleExpression(expr string) (ToggleChord, error) {
 	return chord, nil
 }
 
+func parseIndicator(name string) (Indicator, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "none", "off":
+		return IndicatorNone, nil
+	case "caps", "capslock":
+		return IndicatorCaps, nil
+	case "scroll", "scrolllock":
+		return IndicatorScroll, nil
+	case "kana":
+		return IndicatorKana, nil
+	case "compose":
+		return IndicatorCompose, nil
+	}
+	return IndicatorNone, ConfigError{msg: fmt.Sprintf("unknown led '%s'", name)}
+}
+
+// parseRule parses "[field:]pattern = action [mode]". The field defaults
+// to the WM_CLASS class.
+func parseRule(key, value string) (Rule, error) {
+	rule := Rule{}
+	var err error
+	if rule.Field, rule.Pattern, err = parseWindowPattern(key); err != nil {
+		return Rule{}, err
+	}
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return Rule{}, ConfigError{msg: fmt.Sprintf("missing action for rule '%s'", key)}
+	}
+	rule.Action = RuleAction(strings.ToLower(fields[0]))
+	switch rule.Action {
+	case RuleBypass:
+		if len(fields) != 1 {
+			return Rule{}, ConfigError{msg: fmt.Sprintf("bypass rule '%s' takes no mode", key)}
+		}
+	case RuleForce, RuleDefault:
+		if len(fields) != 2 {
+			return Rule{}, ConfigError{msg: fmt.Sprintf("%s rule '%s' needs exactly one mode", rule.Action, key)}
+		}
+		// Resolved against the built modes by the caller.
+		rule.Mode = strings.ToLower(fields[1])
+	default:
+		return Rule{}, ConfigError{msg: fmt.Sprintf("unknown rule action '%s'", fields[0])}
+	}
+	return rule, nil
+}
+
+// parseWindowPattern splits a "[field:]pattern" key of [rules] and
+// [paste]; the field defaults to class.
+func parseWindowPattern(key string) (string, string, error) {
+	field, pattern := "class", key
+	if f, p, ok := strings.Cut(key, ":"); ok {
+		field = strings.ToLower(strings.TrimSpace(f))
+		pattern = strings.TrimSpace(p)
+	}
+	switch field {
+	case "class", "instance", "process", "title":
+	default:
+		return "", "", ConfigError{msg: fmt.Sprintf("unknown rule field '%s'", field)}
+	}
+	if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+		return "", "", ConfigError{msg: fmt.Sprintf("invalid rule pattern '%s'", pattern)}
+	}
+	return field, pattern, nil
+}
+
+// parsePasteOption handles one line of [paste]: the threshold, the
+// selection, or an application and its paste keys.
+func parsePasteOption(paste *PasteConfig, key, value string) error {
+	switch strings.ToLower(key) {
+	case "threshold":
+		threshold, err := strconv.Atoi(value)
+		if err != nil || threshold < 1 {
+			return ConfigError{msg: fmt.Sprintf("invalid paste threshold '%s'", value)}
+		}
+		paste.Threshold = threshold
+		return nil
+	case "selection":
+		switch strings.ToLower(value) {
+		case "clipboard":
+			paste.Primary = false
+		case "primary":
+			paste.Primary = true
+		default:
+			return ConfigError{msg: fmt.Sprintf("invalid paste selection '%s': expected clipboard or primary", value)}
+		}
+		return nil
+	}
+	rule := PasteRule{}
+	var err error
+	if rule.Field, rule.Pattern, err = parseWindowPattern(key); err != nil {
+		return err
+	}
+	switch strings.ToLower(strings.ReplaceAll(value, " ", "")) {
+	case "ctrl+v":
+	case "shift+insert":
+		rule.ShiftInsert = true
+	default:
+		return ConfigError{msg: fmt.Sprintf("invalid paste keys '%s' for '%s': expected ctrl+v or shift+insert", value, key)}
+	}
+	paste.Apps = append(paste.Apps, rule)
+	return nil
+}
+
+// expandHome replaces a leading "~/" with the user's home directory.
+func expandHome(name string) string {
+	rest, ok := strings.CutPrefix(name, "~/")
+	if !ok {
+		return name
+	}
+	home, err := os.UserHomeDir()
+	if err != nil || home == "" {
+		return name
+	}
+	return filepath.Join(home, rest)
+}
+
+func parseRemember(value string) (RememberMode, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "off", "none", "global":
+		return RememberOff, nil
+	case "window":
+		return RememberWindow, nil
+	case "class", "app", "application":
+		return RememberClass, nil
+	}
+	return RememberOff, ConfigError{msg: fmt.Sprintf("invalid remember '%s': expected window, class or off", value)}
+}
+
+func togglesOnKey(chords []ToggleChord, code uint16) bool {
+	for _, chord := range chords {
+		if chord.Key == code {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTrigger(name string) (ChordTrigger, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "press":
+		return TriggerPress, nil
+	case "tap":
+		return TriggerTap, nil
+	case "doubletap", "double_tap", "double-tap":
+		return TriggerDoubleTap, nil
+	case "hold", "longpress", "long_press":
+		return TriggerHold, nil
+	}
+	return TriggerPress, ConfigError{msg: fmt.Sprintf("unknown chord trigger '%s'", name)}
+}
+
 func parseKeyToken(name string) ([]uint16, error) {
 	normalized := strings.ToUpper(strings.TrimSpace(name))
 	if normalized == "" {
@@ -223,15 +751,46 @@ func modifierAlias() map[string][]uint16 {
 }
 
 func keycodeTable() map[string]uint16 {
+	// Evdev codes follow the physical QWERTY rows, so letters and digits
+	// are listed explicitly rather than derived from KEY_A and KEY_0.
 	table := map[string]uint16{}
-	for ch := 'A'; ch <= 'Z'; ch++ {
-		table[fmt.Sprintf("KEY_%c", ch)] = uint16(linux.KeyA + int(ch-'A'))
-	}
-	for ch := '0'; ch <= '9'; ch++ {
-		table[fmt.Sprintf("KEY_%c", ch)] = uint16(linux.Key0 + int(ch-'0'))
-	}
-
 	additional := map[string]int{
+		"KEY_A":          linux.KeyA,
+		"KEY_B":          linux.KeyB,
+		"KEY_C":          linux.KeyC,
+		"KEY_D":          linux.KeyD,
+		"KEY_E":          linux.KeyE,
+		"KEY_F":          linux.KeyF,
+		"KEY_G":          linux.KeyG,
+		"KEY_H":          linux.KeyH,
+		"KEY_I":          linux.KeyI,
+		"KEY_J":          linux.KeyJ,
+		"KEY_K":          linux.KeyK,
+		"KEY_L":          linux.KeyL,
+		"KEY_M":          linux.KeyM,
+		"KEY_N":          linux.KeyN,
+		"KEY_O":          linux.KeyO,
+		"KEY_P":          linux.KeyP,
+		"KEY_Q":          linux.KeyQ,
+		"KEY_R":          linux.KeyR,
+		"KEY_S":          linux.KeyS,
+		"KEY_T":          linux.KeyT,
+		"KEY_U":          linux.KeyU,
+		"KEY_V":          linux.KeyV,
+		"KEY_W":          linux.KeyW,
+		"KEY_X":          linux.KeyX,
+		"KEY_Y":          linux.KeyY,
+		"KEY_Z":          linux.KeyZ,
+		"KEY_0":          linux.Key0,
+		"KEY_1":          linux.Key1,
+		"KEY_2":          linux.Key2,
+		"KEY_3":          linux.Key3,
+		"KEY_4":          linux.Key4,
+		"KEY_5":          linux.Key5,
+		"KEY_6":          linux.Key6,
+		"KEY_7":          linux.Key7,
+		"KEY_8":          linux.Key8,
+		"KEY_9":          linux.Key9,
 		"KEY_MINUS":      linux.KeyMinus,
 		"KEY_EQUAL":      linux.KeyEqual,
 		"KEY_LEFTBRACE":  linux.KeyLeftBrace,
@@ -4,7 +4,9 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/gg582/hanfe/internal/hangul"
 	"github.com/gg582/hanfe/internal/linux"
 )
 
@@ -96,3 +98,396 @@ func containsCode(list []uint16, value uint16) bool {
 	}
 	return false
 }
+
+func TestLoadToggleConfigModeSections(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	contents := "[toggle]\nkeys = hangul\n\n[mode.Sebeolsik-Final]\nmoachigi = yes\n\n[mode.dubeolsik]\nmoachigi = off\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	if !cfg.ModeOptions("sebeolsik-final").Moachigi {
+		t.Fatalf("expected moachigi to be enabled for sebeolsik-final")
+	}
+	if cfg.ModeOptions("dubeolsik").Moachigi {
+		t.Fatalf("expected moachigi to be disabled for dubeolsik")
+	}
+	if len(cfg.Chords) != 1 {
+		t.Fatalf("expected mode sections not to affect toggle keys, got %d chords", len(cfg.Chords))
+	}
+
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n[mode.dubeolsik]\nmoachigi = maybe\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	if _, err := LoadToggleConfig(path); err == nil {
+		t.Fatalf("expected invalid boolean to be rejected")
+	}
+}
+
+func TestLoadToggleConfigModeSectionAlias(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	contents := "[toggle]\nkeys = hangul\n[mode.hangul]\nmoachigi = yes\nbackspace = reopen\n[mode.Korean]\nmoachigi = no\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	cfg.NormalizeModeOptions(func(name string) string {
+		if name == "hangul" {
+			return "sebeolsik-final"
+		}
+		return ""
+	})
+	options := cfg.ModeOptions("sebeolsik-final")
+	if !options.Moachigi || options.Backspace != hangul.BackspaceReopen {
+		t.Fatalf("expected [mode.hangul] to apply to sebeolsik-final, got %+v", options)
+	}
+	if len(cfg.Modes) != 1 {
+		t.Fatalf("expected sections normalizing to nothing to be dropped, got %v", cfg.Modes)
+	}
+}
+
+func TestLoadToggleConfigNormalization(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n[mode.dubeolsik]\nnormalization = NFD\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	if got := cfg.ModeOptions("dubeolsik").Normalization; got != hangul.NormalizeNFD {
+		t.Fatalf("expected nfd normalization, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n[mode.dubeolsik]\nnormalization = nfkc\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	if _, err := LoadToggleConfig(path); err == nil {
+		t.Fatalf("expected unknown normalization to be rejected")
+	}
+}
+
+func TestLoadToggleConfigBackspacePolicy(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n[mode.dubeolsik]\nbackspace = syllable\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	if got := cfg.ModeOptions("dubeolsik").Backspace; got != hangul.BackspaceSyllable {
+		t.Fatalf("expected syllable backspace, got %q", got)
+	}
+
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n[mode.dubeolsik]\nbackspace = word\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	if _, err := LoadToggleConfig(path); err == nil {
+		t.Fatalf("expected unknown backspace policy to be rejected")
+	}
+}
+
+func TestLoadToggleConfigReconvert(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\nreconvert = ctrl+r, f12\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	if len(cfg.Reconvert) != 2 {
+		t.Fatalf("expected 2 reconvert chords, got %d", len(cfg.Reconvert))
+	}
+	if cfg.Reconvert[0].Key != uint16(linux.KeyR) || len(cfg.Reconvert[0].ModifierGroups) != 1 {
+		t.Fatalf("expected ctrl+r, got %+v", cfg.Reconvert[0])
+	}
+	if cfg.Reconvert[1].Key != uint16(linux.KeyF12) {
+		t.Fatalf("expected f12, got %+v", cfg.Reconvert[1])
+	}
+}
+
+func TestKeycodeTableFollowsEvdevCodes(t *testing.T) {
+	table := keycodeTable()
+	// Evdev numbers the keys row by row, so neither letters nor digits
+	// are contiguous from KEY_A and KEY_0.
+	checks := map[string]int{
+		"KEY_A": linux.KeyA, "KEY_B": linux.KeyB, "KEY_Q": linux.KeyQ, "KEY_R": linux.KeyR,
+		"KEY_Z": linux.KeyZ, "KEY_0": linux.Key0, "KEY_1": linux.Key1, "KEY_9": linux.Key9,
+	}
+	for name, code := range checks {
+		if table[name] != uint16(code) {
+			t.Fatalf("%s resolved to %d, want %d", name, table[name], code)
+		}
+	}
+}
+
+func TestLoadToggleConfigAutoSection(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	contents := "[toggle]\nkeys = hangul\n[auto]\nenabled = true\nundo = ctrl+backspace\nexclude = Firefox, code\nwords = /tmp/words.txt\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	auto := cfg.Auto
+	if !auto.Enabled || auto.Words != "/tmp/words.txt" {
+		t.Fatalf("unexpected auto config %+v", auto)
+	}
+	if len(auto.Exclude) != 2 || auto.Exclude[0] != "Firefox" || auto.Exclude[1] != "code" {
+		t.Fatalf("unexpected exclude list %v", auto.Exclude)
+	}
+	if len(auto.Undo) != 1 || auto.Undo[0].Key != uint16(linux.KeyBackspace) {
+		t.Fatalf("expected ctrl+backspace undo, got %+v", auto.Undo)
+	}
+
+	t.Setenv("HOME", dir)
+	contents = "[toggle]\nkeys = hangul\n[auto]\nenabled = true\nwords = ~/words.txt\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	if cfg, err = LoadToggleConfig(path); err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	if want := filepath.Join(dir, "words.txt"); cfg.Auto.Words != want {
+		t.Fatalf("expected ~ to expand to %q, got %q", want, cfg.Auto.Words)
+	}
+	if DefaultToggleConfig().Auto.Enabled {
+		t.Fatalf("expected automatic switching to be off by default")
+	}
+}
+
+func TestLoadToggleConfigSelectChords(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	contents := "[toggle]\nkeys = hangul\nselect.latin = ctrl+shift+1\nselect.Kana86 = ctrl+shift+2\nselect.hangul = f1\nprevious = ctrl+shift+grave\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	if len(cfg.Select) != 3 {
+		t.Fatalf("expected three select entries, got %v", cfg.Select)
+	}
+	latin := cfg.Select["latin"]
+	if len(latin) != 1 || latin[0].Key != uint16(linux.Key1) || len(latin[0].ModifierGroups) != 2 {
+		t.Fatalf("unexpected select.latin chord %+v", latin)
+	}
+	if kana := cfg.Select["kana86"]; len(kana) != 1 || kana[0].Key != uint16(linux.Key2) {
+		t.Fatalf("expected select.kana86 to be keyed by the lower-case mode name, got %+v", cfg.Select)
+	}
+	if hangulChords := cfg.Select["hangul"]; len(hangulChords) != 1 || hangulChords[0].Key != uint16(linux.KeyF1) {
+		t.Fatalf("expected select.hangul to be kept as named, got %+v", cfg.Select)
+	}
+	if len(cfg.Previous) != 1 || cfg.Previous[0].Key != uint16(linux.KeyGrave) {
+		t.Fatalf("unexpected previous chord %+v", cfg.Previous)
+	}
+}
+
+func TestLoadToggleConfigChordTriggers(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	contents := "[toggle]\nkeys = tap:shift_l, doubletap:ctrl_r, hold:capslock, hangul\ntap_timeout = 200\nhold_timeout = 600\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	want := []ToggleChord{
+		{Key: uint16(linux.KeyLeftShift), Trigger: TriggerTap},
+		{Key: uint16(linux.KeyRightCtrl), Trigger: TriggerDoubleTap},
+		{Key: uint16(linux.KeyCapsLock), Trigger: TriggerHold},
+		{Key: uint16(linux.KeyHangeul), Trigger: TriggerPress},
+	}
+	if len(cfg.Chords) != len(want) {
+		t.Fatalf("expected %d chords, got %+v", len(want), cfg.Chords)
+	}
+	for i, chord := range cfg.Chords {
+		if chord.Key != want[i].Key || chord.Trigger != want[i].Trigger {
+			t.Fatalf("chord %d: expected %+v, got %+v", i, want[i], chord)
+		}
+	}
+	if cfg.TapTimeout != 200*time.Millisecond || cfg.HoldTimeout != 600*time.Millisecond {
+		t.Fatalf("unexpected timeouts %v and %v", cfg.TapTimeout, cfg.HoldTimeout)
+	}
+
+	for _, bad := range []string{"keys = flick:shift_l\n", "keys = hangul\ntap_timeout = soon\n"} {
+		if err := os.WriteFile(path, []byte("[toggle]\n"+bad), 0o600); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		if _, err := LoadToggleConfig(path); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
+
+func TestLoadToggleConfigLED(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	cases := []struct {
+		contents string
+		want     Indicator
+	}{
+		{"[toggle]\nkeys = hangul\n", IndicatorNone},
+		{"[toggle]\nkeys = capslock\n", IndicatorCaps},
+		{"[toggle]\nkeys = capslock\nled = none\n", IndicatorNone},
+		{"[toggle]\nkeys = hangul\nled = scroll\n", IndicatorScroll},
+		{"[toggle]\nkeys = hangul\nled = Kana\n", IndicatorKana},
+		{"[toggle]\nkeys = hangul\nled = compose\n", IndicatorCompose},
+	}
+	for _, tc := range cases {
+		if err := os.WriteFile(path, []byte(tc.contents), 0o600); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		cfg, err := LoadToggleConfig(path)
+		if err != nil {
+			t.Fatalf("LoadToggleConfig(%q) returned error: %v", tc.contents, err)
+		}
+		if cfg.LED != tc.want {
+			t.Fatalf("%q: expected LED %v, got %v", tc.contents, tc.want, cfg.LED)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\nled = num\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	if _, err := LoadToggleConfig(path); err == nil {
+		t.Fatalf("expected an error for an unknown LED")
+	}
+}
+
+func TestLoadToggleConfigRemember(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	cases := map[string]RememberMode{
+		"":                    RememberOff,
+		"remember = off\n":    RememberOff,
+		"remember = window\n": RememberWindow,
+		"remember = Class\n":  RememberClass,
+	}
+	for line, want := range cases {
+		if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n"+line), 0o600); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		cfg, err := LoadToggleConfig(path)
+		if err != nil {
+			t.Fatalf("LoadToggleConfig(%q) returned error: %v", line, err)
+		}
+		if cfg.Remember != want {
+			t.Fatalf("%q: expected %q, got %q", line, want, cfg.Remember)
+		}
+	}
+	if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\nremember = tab\n"), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	if _, err := LoadToggleConfig(path); err == nil {
+		t.Fatalf("expected an error for an unknown remember value")
+	}
+}
+
+func TestLoadToggleConfigRules(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	contents := "[toggle]\nkeys = hangul\n[rules]\ntitle:*VIM* = force latin\nprocess:steam_app_* = bypass\nFirefox = default hangul\n"
+	if err := os.WriteFile(path, []byte(contents), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	want := []Rule{
+		{Field: "title", Pattern: "*VIM*", Action: RuleForce, Mode: "latin"},
+		{Field: "process", Pattern: "steam_app_*", Action: RuleBypass},
+		{Field: "class", Pattern: "Firefox", Action: RuleDefault, Mode: "hangul"},
+	}
+	if len(cfg.Rules) != len(want) {
+		t.Fatalf("expected %d rules, got %+v", len(want), cfg.Rules)
+	}
+	for i, rule := range cfg.Rules {
+		if rule != want[i] {
+			t.Fatalf("rule %d: expected %+v, got %+v", i, want[i], rule)
+		}
+	}
+	if !cfg.Rules[0].Matches("main.go - VIM") || !cfg.Rules[2].Matches("firefox") || cfg.Rules[1].Matches("steam") {
+		t.Fatalf("unexpected rule matching")
+	}
+
+	for _, bad := range []string{"pid:1 = bypass", "xterm = force", "xterm = bypass latin", "xterm = ignore", "[a = bypass"} {
+		if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n[rules]\n"+bad+"\n"), 0o600); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		if _, err := LoadToggleConfig(path); err == nil {
+			t.Fatalf("expected an error for rule %q", bad)
+		}
+	}
+}
+
+func TestLoadToggleConfigOutput(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	content := "[toggle]\nkeys = hangul\noutput = xtest, uinput-hex\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	if len(cfg.Output) != 2 || cfg.Output[0] != "xtest" || cfg.Output[1] != "uinput-hex" {
+		t.Fatalf("expected the output chain in order, got %v", cfg.Output)
+	}
+}
+
+func TestLoadToggleConfigPaste(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "toggle.ini")
+	content := "[toggle]\nkeys = hangul\n[paste]\nthreshold = 8\nselection = primary\nGedit = ctrl+v\nclass:*term* = Shift+Insert\n"
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write temp config: %v", err)
+	}
+	cfg, err := LoadToggleConfig(path)
+	if err != nil {
+		t.Fatalf("LoadToggleConfig returned error: %v", err)
+	}
+	paste := cfg.Paste
+	if paste.Threshold != 8 || !paste.Primary || len(paste.Apps) != 2 {
+		t.Fatalf("unexpected paste config %+v", paste)
+	}
+	if paste.Apps[0].ShiftInsert || !paste.Apps[0].Matches("gedit") {
+		t.Fatalf("expected Gedit to paste with ctrl+v, got %+v", paste.Apps[0])
+	}
+	if !paste.Apps[1].ShiftInsert || !paste.Apps[1].Matches("XTerm") {
+		t.Fatalf("expected terminals to paste with shift+insert, got %+v", paste.Apps[1])
+	}
+
+	for _, bad := range []string{"threshold = 0", "selection = secondary", "Gedit = ctrl+c"} {
+		if err := os.WriteFile(path, []byte("[toggle]\nkeys = hangul\n[paste]\n"+bad+"\n"), 0o600); err != nil {
+			t.Fatalf("failed to write temp config: %v", err)
+		}
+		if _, err := LoadToggleConfig(path); err == nil {
+			t.Fatalf("expected an error for %q", bad)
+		}
+	}
+}
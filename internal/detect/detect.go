@@ -0,0 +1,127 @@
+// Package detect guesses whether a word typed on a Latin keyboard was meant
+// as English or as Hangul.
+package detect
+
+import (
+	"bufio"
+	_ "embed"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//go:embed english.txt
+var englishWords string
+
+//go:embed korean.txt
+var koreanWords string
+
+// Language is the outcome of Classify.
+type Language int
+
+const (
+	Unknown Language = iota
+	English
+	Hangul
+)
+
+// minWordLength keeps short words, which are ambiguous in both scripts,
+// from switching modes.
+const minWordLength = 3
+
+// Dictionary is a set of lower-case words.
+type Dictionary struct {
+	words map[string]struct{}
+}
+
+// NewEnglishDictionary returns the built-in list of common English words.
+func NewEnglishDictionary() *Dictionary {
+	d := &Dictionary{words: make(map[string]struct{})}
+	d.Add(strings.Fields(englishWords)...)
+	return d
+}
+
+// NewKoreanDictionary returns the built-in list of common Korean words.
+func NewKoreanDictionary() *Dictionary {
+	d := &Dictionary{words: make(map[string]struct{})}
+	d.Add(strings.Fields(koreanWords)...)
+	return d
+}
+
+func (d *Dictionary) Add(words ...string) {
+	for _, word := range words {
+		if word = strings.ToLower(strings.TrimSpace(word)); word != "" {
+			d.words[word] = struct{}{}
+		}
+	}
+}
+
+// LoadFile adds the words of a plain text file, one per line; lines
+// starting with '#' are ignored.
+func (d *Dictionary) LoadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("open word list: %w", err)
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		d.Add(line)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read word list %s: %w", path, err)
+	}
+	return nil
+}
+
+func (d *Dictionary) Contains(word string) bool {
+	_, ok := d.words[strings.ToLower(word)]
+	return ok
+}
+
+// CompleteHangul reports whether text consists only of precomposed Hangul
+// syllables. Keys that break the syllable structure (three consonants in a
+// row, a vowel without an initial) leave bare jamo behind and fail the test.
+func CompleteHangul(text string) bool {
+	if text == "" {
+		return false
+	}
+	for _, r := range text {
+		if r < 0xAC00 || r > 0xD7A3 {
+			return false
+		}
+	}
+	return true
+}
+
+// Classify decides which language a word belongs to from the letters typed
+// and their Hangul rendering. Each answer needs a dictionary hit: English
+// is an English word that is not valid Hangul, and Hangul is a Korean word
+// that is not English. A word missing from both lists is left alone.
+func Classify(latin, hangul string, english, korean *Dictionary) Language {
+	if len(latin) < minWordLength || !isLetters(latin) {
+		return Unknown
+	}
+	known := english.Contains(latin)
+	valid := CompleteHangul(hangul)
+	switch {
+	case known && !valid:
+		return English
+	case !known && valid && korean.Contains(hangul):
+		return Hangul
+	}
+	return Unknown
+}
+
+func isLetters(word string) bool {
+	for _, r := range word {
+		if (r < 'a' || r > 'z') && (r < 'A' || r > 'Z') {
+			return false
+		}
+	}
+	return true
+}
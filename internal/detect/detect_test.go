@@ -0,0 +1,57 @@
+package detect
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	english, korean := NewEnglishDictionary(), NewKoreanDictionary()
+	cases := []struct {
+		latin  string
+		hangul string
+		want   Language
+	}{
+		{"gksrmf", "한글", Hangul},
+		{"dkssud", "안녕", Hangul},
+		{"hello", "ㅗ디ㅣㅐ", English},
+		{"rst", "ㄱㄴㅅ", Unknown},    // neither a word nor valid Hangul
+		{"the", "솓", Unknown},      // both: leave it alone
+		{"rk", "가", Unknown},       // too short
+		{"gk1", "하1", Unknown},     // not only letters
+		{"Hello", "ㅗ디ㅣㅐ", English}, // case-insensitive
+		// Valid Hangul alone is no evidence: English words missing from
+		// the list stay as typed.
+		{"sudo", "녀애", Unknown},
+		{"fork", "래가", Unknown},
+		{"risk", "갸나", Unknown},
+		{"sofa", "낾", Unknown},
+		{"duty", "여쇼", Unknown},
+	}
+	for _, tc := range cases {
+		if got := Classify(tc.latin, tc.hangul, english, korean); got != tc.want {
+			t.Errorf("Classify(%q, %q) = %v, want %v", tc.latin, tc.hangul, got, tc.want)
+		}
+	}
+}
+
+func TestDictionaryLoadFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "words.txt")
+	if err := os.WriteFile(path, []byte("# extra words\nHanfe\n\n"), 0o600); err != nil {
+		t.Fatalf("write word list: %v", err)
+	}
+	d := NewEnglishDictionary()
+	if d.Contains("hanfe") {
+		t.Fatalf("unexpected built-in word")
+	}
+	if err := d.LoadFile(path); err != nil {
+		t.Fatalf("LoadFile: %v", err)
+	}
+	if !d.Contains("hanfe") || d.Contains("# extra words") {
+		t.Fatalf("expected words from the file to be added")
+	}
+	if err := d.LoadFile(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Fatalf("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,346 @@
+package emitter
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/gg582/hanfe/internal/linux"
+)
+
+const (
+	// pasteTimeout is how long the pasted text is served when no
+	// application asks for it.
+	pasteTimeout = time.Second
+	// pasteLinger is how long the pasted text is still served after the
+	// last request for it. A clipboard manager may fetch it before the
+	// application does.
+	pasteLinger = 500 * time.Millisecond
+	// selectionFetchTimeout bounds the time spent saving what the
+	// previous selection owner offers.
+	selectionFetchTimeout = 200 * time.Millisecond
+	// maxSelectionBytes caps what is saved for a single target.
+	maxSelectionBytes = 1 << 20
+)
+
+// selectionData is what the selection offers for one target.
+type selectionData struct {
+	typ    xproto.Atom
+	format byte
+	data   []byte
+}
+
+// ClipboardPaster inserts text by putting it on an X11 selection and
+// pressing the paste keys on the wrapped Output, which handles everything
+// else. What the selection offered before, in every target the previous
+// owner offered, is served again once requests for the pasted text stop.
+type ClipboardPaster struct {
+	Output
+	conn      *xgb.Conn
+	window    xproto.Window
+	selection xproto.Atom
+	targets   xproto.Atom
+	utf8      xproto.Atom
+	text      xproto.Atom
+	property  xproto.Atom
+	incr      xproto.Atom
+	// skip lists targets that are requests rather than data, such as
+	// MULTIPLE and TIMESTAMP.
+	skip map[xproto.Atom]bool
+
+	mu      sync.Mutex
+	content map[xproto.Atom]selectionData
+	owned   bool
+	// previous is served again when the paste is over; nil when the
+	// selection had no owner.
+	previous map[xproto.Atom]selectionData
+	pasting  bool
+	restore  *time.Timer
+	notify   chan xproto.SelectionNotifyEvent
+}
+
+var _ PasteOutput = (*ClipboardPaster)(nil)
+
+// OpenClipboardPaster wraps out. With primary, text goes through the
+// PRIMARY selection instead of CLIPBOARD.
+func OpenClipboardPaster(out Output, primary bool) (*ClipboardPaster, error) {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return nil, fmt.Errorf("DISPLAY not set")
+	}
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	p := &ClipboardPaster{
+		Output:    out,
+		conn:      conn,
+		selection: xproto.AtomPrimary,
+		skip:      make(map[xproto.Atom]bool),
+		notify:    make(chan xproto.SelectionNotifyEvent, 1),
+	}
+	names := []string{"TARGETS", "UTF8_STRING", "TEXT", "HANFE_SELECTION", "INCR",
+		"MULTIPLE", "TIMESTAMP", "SAVE_TARGETS", "DELETE"}
+	if !primary {
+		names = append(names, "CLIPBOARD")
+	}
+	atoms := make([]xproto.Atom, len(names))
+	for i, name := range names {
+		reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("intern %s: %w", name, err)
+		}
+		atoms[i] = reply.Atom
+	}
+	p.targets, p.utf8, p.text, p.property, p.incr = atoms[0], atoms[1], atoms[2], atoms[3], atoms[4]
+	p.skip[p.targets] = true
+	for _, atom := range atoms[5:9] {
+		p.skip[atom] = true
+	}
+	if !primary {
+		p.selection = atoms[9]
+	}
+
+	if p.window, err = xproto.NewWindowId(conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	err = xproto.CreateWindowChecked(conn, 0, p.window, root, -1, -1, 1, 1, 0,
+		xproto.WindowClassInputOnly, 0, 0, nil).Check()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("create selection window: %w", err)
+	}
+	go p.serve()
+	return p, nil
+}
+
+func (p *ClipboardPaster) serve() {
+	for {
+		ev, err := p.conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+		switch e := ev.(type) {
+		case xproto.SelectionRequestEvent:
+			p.answer(e)
+		case xproto.SelectionClearEvent:
+			// Something else was copied; it replaces what a paste
+			// would have put back.
+			p.mu.Lock()
+			p.owned = false
+			p.previous = nil
+			p.mu.Unlock()
+		case xproto.SelectionNotifyEvent:
+			select {
+			case p.notify <- e:
+			default:
+			}
+		}
+	}
+}
+
+// answer hands the selection to an application that asked for it. While
+// a paste is in progress, each request for it postpones the restore.
+func (p *ClipboardPaster) answer(e xproto.SelectionRequestEvent) {
+	property := e.Property
+	if property == xproto.AtomNone {
+		// Obsolete clients name no property; use the target.
+		property = e.Target
+	}
+	p.mu.Lock()
+	content, owned := p.content, p.owned
+	if owned && p.pasting {
+		p.restore.Reset(pasteLinger)
+	}
+	p.mu.Unlock()
+
+	ok := owned && e.Selection == p.selection
+	if ok {
+		if e.Target == p.targets {
+			supported := []xproto.Atom{p.targets}
+			for atom := range content {
+				supported = append(supported, atom)
+			}
+			data := make([]byte, 4*len(supported))
+			for i, atom := range supported {
+				xgb.Put32(data[4*i:], uint32(atom))
+			}
+			xproto.ChangeProperty(p.conn, xproto.PropModeReplace, e.Requestor, property, xproto.AtomAtom, 32, uint32(len(supported)), data)
+		} else if value, found := content[e.Target]; found {
+			units := uint32(len(value.data)) / uint32(value.format/8)
+			xproto.ChangeProperty(p.conn, xproto.PropModeReplace, e.Requestor, property, value.typ, value.format, units, value.data)
+		} else {
+			ok = false
+		}
+	}
+	if !ok {
+		property = xproto.AtomNone
+	}
+	notify := xproto.SelectionNotifyEvent{
+		Time:      e.Time,
+		Requestor: e.Requestor,
+		Selection: e.Selection,
+		Target:    e.Target,
+		Property:  property,
+	}
+	xproto.SendEvent(p.conn, false, e.Requestor, 0, string(notify.Bytes()))
+}
+
+// PasteText puts text on the selection and presses the paste keys. It
+// does not wait for the application: the previous content is put back
+// in the background once requests for the text stop. It fails without
+// pasting when the previous content cannot be saved.
+func (p *ClipboardPaster) PasteText(text string, shiftInsert bool) error {
+	p.mu.Lock()
+	pasting := p.pasting
+	p.mu.Unlock()
+	if !pasting {
+		// A paste in progress already saved what came before it.
+		previous, err := p.saveSelection()
+		if err != nil {
+			return err
+		}
+		p.mu.Lock()
+		p.previous = previous
+		p.mu.Unlock()
+	}
+	value := selectionData{typ: p.utf8, format: 8, data: []byte(text)}
+	p.mu.Lock()
+	p.content = map[xproto.Atom]selectionData{p.utf8: value, p.text: value}
+	p.owned = true
+	p.pasting = true
+	if p.restore == nil {
+		p.restore = time.AfterFunc(pasteTimeout, p.restoreSelection)
+	} else {
+		p.restore.Reset(pasteTimeout)
+	}
+	p.mu.Unlock()
+
+	if err := xproto.SetSelectionOwnerChecked(p.conn, p.window, p.selection, xproto.TimeCurrentTime).Check(); err != nil {
+		p.restoreSelection()
+		return fmt.Errorf("own selection: %w", err)
+	}
+	return p.pressPaste(shiftInsert)
+}
+
+// saveSelection returns every target the selection offers, or nil when
+// it has no owner.
+func (p *ClipboardPaster) saveSelection() (map[xproto.Atom]selectionData, error) {
+	owner, err := xproto.GetSelectionOwner(p.conn, p.selection).Reply()
+	if err != nil {
+		return nil, err
+	}
+	switch owner.Owner {
+	case xproto.WindowNone:
+		return nil, nil
+	case p.window:
+		p.mu.Lock()
+		defer p.mu.Unlock()
+		return p.content, nil
+	}
+	deadline := time.Now().Add(selectionFetchTimeout)
+	list, err := p.fetch(p.targets, deadline)
+	if err != nil {
+		return nil, err
+	}
+	if list.typ != xproto.AtomAtom || list.format != 32 {
+		return nil, fmt.Errorf("selection owner lists no targets")
+	}
+	saved := make(map[xproto.Atom]selectionData)
+	for i := 0; i+4 <= len(list.data); i += 4 {
+		target := xproto.Atom(xgb.Get32(list.data[i:]))
+		if p.skip[target] {
+			continue
+		}
+		value, err := p.fetch(target, deadline)
+		if err != nil {
+			return nil, err
+		}
+		if value.format != 0 {
+			saved[target] = value
+		}
+	}
+	if len(saved) == 0 {
+		return nil, fmt.Errorf("selection content cannot be saved")
+	}
+	return saved, nil
+}
+
+// fetch converts the selection to target. A target the owner refuses
+// comes back with format 0.
+func (p *ClipboardPaster) fetch(target xproto.Atom, deadline time.Time) (selectionData, error) {
+	select {
+	case <-p.notify:
+	default:
+	}
+	xproto.ConvertSelection(p.conn, p.window, p.selection, target, p.property, xproto.TimeCurrentTime)
+	select {
+	case ev := <-p.notify:
+		if ev.Property == xproto.AtomNone {
+			return selectionData{}, nil
+		}
+	case <-time.After(time.Until(deadline)):
+		return selectionData{}, fmt.Errorf("selection owner did not answer")
+	}
+	reply, err := xproto.GetProperty(p.conn, true, p.window, p.property, xproto.GetPropertyTypeAny, 0, maxSelectionBytes/4).Reply()
+	if err != nil {
+		return selectionData{}, err
+	}
+	if reply.Type == p.incr || reply.BytesAfter > 0 {
+		return selectionData{}, fmt.Errorf("selection content is too large to save")
+	}
+	return selectionData{typ: reply.Type, format: reply.Format, data: reply.Value}, nil
+}
+
+// restoreSelection serves the previous content again, or gives the
+// selection up when there was none. A selection something else took in
+// the meantime is left alone.
+func (p *ClipboardPaster) restoreSelection() {
+	p.mu.Lock()
+	if !p.pasting {
+		p.mu.Unlock()
+		return
+	}
+	p.pasting = false
+	p.content = p.previous
+	p.previous = nil
+	release := p.owned && p.content == nil
+	if release {
+		p.owned = false
+	}
+	p.mu.Unlock()
+	if release {
+		xproto.SetSelectionOwner(p.conn, xproto.WindowNone, p.selection, xproto.TimeCurrentTime)
+	}
+}
+
+func (p *ClipboardPaster) pressPaste(shiftInsert bool) error {
+	modifier, key := uint16(linux.KeyLeftCtrl), uint16(linux.KeyV)
+	if shiftInsert {
+		modifier, key = uint16(linux.KeyLeftShift), uint16(linux.KeyInsert)
+	}
+	if err := p.SendKeyState(modifier, true); err != nil {
+		return err
+	}
+	if err := p.TapKey(key); err != nil {
+		_ = p.SendKeyState(modifier, false)
+		return err
+	}
+	return p.SendKeyState(modifier, false)
+}
+
+func (p *ClipboardPaster) Close() error {
+	p.mu.Lock()
+	if p.restore != nil {
+		p.restore.Stop()
+	}
+	p.mu.Unlock()
+	p.conn.Close()
+	return p.Output.Close()
+}
@@ -21,6 +21,7 @@ type FallbackEmitter struct {
 	inputBuffer  strings.Builder
 	directCommit bool
 	x11          *x11Injector
+	remap        *x11Remapper
 }
 
 const (
@@ -44,8 +45,8 @@ type uinputUserDev struct {
 	Absflat      [absCnt]int32
 }
 
-func Open(hexMap map[rune]uint16, ttyClient *ttybridge.Client, ptyPath string, directCommit bool) (*FallbackEmitter, error) {
-	emitter := &FallbackEmitter{uinputFD: -1, ttyClient: nil, ptyFD: -1, directCommit: directCommit}
+func newFallbackEmitter(hexMap map[rune]uint16) *FallbackEmitter {
+	emitter := &FallbackEmitter{uinputFD: -1, ptyFD: -1}
 	for i := range emitter.hexKeycodes {
 		emitter.hexKeycodes[i] = -1
 	}
@@ -55,38 +56,78 @@ func Open(hexMap map[rune]uint16, ttyClient *ttybridge.Client, ptyPath string, d
 			emitter.hexKeycodes[idx] = int(code)
 		}
 	}
+	return emitter
+}
 
-	if directCommit {
-		emitter.ttyClient = ttyClient
-	} else {
-		if ttyClient != nil {
-			_ = ttyClient.Close()
-		}
-		fd, err := syscall.Open("/dev/uinput", syscall.O_WRONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+// uinputText selects how a uinput backend types text.
+type uinputText int
+
+const (
+	// textHex types Ctrl+Shift+U hex sequences.
+	textHex uinputText = iota
+	// textXTest types through the X11 XTEST extension.
+	textXTest
+	// textRemap presses spare keys remapped to the characters.
+	textRemap
+)
+
+// openUinput creates the virtual keyboard. The X11 text modes fail to
+// open when no X server is reachable.
+func openUinput(hexMap map[rune]uint16, text uinputText) (*FallbackEmitter, error) {
+	emitter := newFallbackEmitter(hexMap)
+	switch text {
+	case textXTest:
+		injector, err := newX11Injector()
 		if err != nil {
-			return nil, fmt.Errorf("open /dev/uinput: %w", err)
+			return nil, err
 		}
-		emitter.uinputFD = fd
-
-		if err := configureUinput(fd); err != nil {
-			syscall.Close(fd)
+		emitter.x11 = injector
+	case textRemap:
+		remap, err := newX11Remapper()
+		if err != nil {
 			return nil, err
 		}
+		emitter.remap = remap
 	}
+	fd, err := syscall.Open("/dev/uinput", syscall.O_WRONLY|syscall.O_NONBLOCK|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		emitter.Close()
+		return nil, fmt.Errorf("open /dev/uinput: %w", err)
+	}
+	emitter.uinputFD = fd
+
+	if err := configureUinput(fd); err != nil {
+		emitter.Close()
+		return nil, err
+	}
+	return emitter, nil
+}
 
-	if directCommit && ptyPath != "" {
+// openTTY mirrors text into the terminal served by the TTY helper, and
+// into the PTY at ptyPath as well when one is given.
+func openTTY(client *ttybridge.Client, ptyPath string) (*FallbackEmitter, error) {
+	emitter := newFallbackEmitter(nil)
+	emitter.directCommit = true
+	if ptyPath != "" {
 		ptyFD, err := syscall.Open(ptyPath, syscall.O_WRONLY|syscall.O_CLOEXEC, 0)
 		if err != nil {
-			emitter.Close()
 			return nil, fmt.Errorf("open pty %s: %w", ptyPath, err)
 		}
 		emitter.ptyFD = ptyFD
-	} else if !directCommit {
-		if injector, err := newX11Injector(); err == nil {
-			emitter.x11 = injector
-		}
 	}
+	emitter.ttyClient = client
+	return emitter, nil
+}
 
+// openPTY mirrors text into the PTY at path.
+func openPTY(path string) (*FallbackEmitter, error) {
+	emitter := newFallbackEmitter(nil)
+	emitter.directCommit = true
+	ptyFD, err := syscall.Open(path, syscall.O_WRONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("open pty %s: %w", path, err)
+	}
+	emitter.ptyFD = ptyFD
 	return emitter, nil
 }
 
@@ -143,6 +184,10 @@ func (e *FallbackEmitter) Close() error {
 		_ = e.x11.Close()
 		e.x11 = nil
 	}
+	if e.remap != nil {
+		_ = e.remap.Close()
+		e.remap = nil
+	}
 	return nil
 }
 
@@ -225,6 +270,11 @@ func (e *FallbackEmitter) SendText(text string) error {
 		e.inputBuffer.Reset()
 		return nil
 	}
+	if e.remap != nil {
+		err := e.typeRemapped(text)
+		e.inputBuffer.Reset()
+		return err
+	}
 	remaining := text
 	for len(remaining) > 0 {
 		r, size := utf8.DecodeRuneInString(remaining)
@@ -309,6 +359,34 @@ func (e *FallbackEmitter) flushBuffer() error {
 	return e.mirrorWrite(data)
 }
 
+// typeRemapped presses, for each character, a spare key remapped to it.
+func (e *FallbackEmitter) typeRemapped(text string) error {
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("invalid utf-8 sequence")
+	}
+	for _, r := range text {
+		var code uint16
+		switch r {
+		case '\r':
+			continue
+		case '\n':
+			code = uint16(linux.KeyEnter)
+		case '\t':
+			code = uint16(linux.KeyTab)
+		default:
+			key, err := e.remap.KeyFor(r)
+			if err != nil {
+				return err
+			}
+			code = key
+		}
+		if err := e.TapKey(code); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (e *FallbackEmitter) typeUnicode(r rune) error {
 	if e.uinputFD < 0 {
 		return nil
@@ -379,5 +457,5 @@ func (e *FallbackEmitter) SupportsPreedit() bool {
 	if e.directCommit {
 		return true
 	}
-	return e.x11 != nil
+	return e.x11 != nil || e.remap != nil
 }
@@ -15,4 +15,22 @@ type Output interface {
 	SupportsPreedit() bool
 }
 
+// PreeditOutput is an Output that can also show a preedit natively, in
+// the focused text field, instead of typing it and erasing it again.
+type PreeditOutput interface {
+	Output
+	// NativePreedit reports whether SetPreedit can show a preedit now.
+	NativePreedit() bool
+	// SetPreedit replaces the native preedit.
+	SetPreedit(text string) error
+}
+
+// PasteOutput is an Output that can also insert text by pasting it.
+type PasteOutput interface {
+	Output
+	// PasteText inserts text with Ctrl+V, or Shift+Insert when
+	// shiftInsert is set.
+	PasteText(text string, shiftInsert bool) error
+}
+
 var _ Output = (*FallbackEmitter)(nil)
@@ -0,0 +1,200 @@
+package emitter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/gg582/hanfe/internal/ttybridge"
+)
+
+// ErrUnavailable is wrapped by backends that cannot work in the current
+// session at all, such as an X11 backend without DISPLAY. Such backends
+// are skipped quietly when they are only part of the default chain.
+var ErrUnavailable = errors.New("not available in this session")
+
+// Capabilities describes what a backend can do.
+type Capabilities struct {
+	// Preedit: text can be shown while composing and replaced later.
+	Preedit bool
+	// Unicode: any character can be typed, not only what the keyboard
+	// layout of the session produces.
+	Unicode bool
+	// Backspace: characters the backend typed can be erased again.
+	Backspace bool
+	// Paste: the keys it presses reach X11 applications, so [paste] can
+	// insert text through an X11 selection.
+	Paste bool
+}
+
+func (c Capabilities) String() string {
+	var names []string
+	if c.Preedit {
+		names = append(names, "preedit")
+	}
+	if c.Unicode {
+		names = append(names, "unicode")
+	}
+	if c.Backspace {
+		names = append(names, "backspace")
+	}
+	if c.Paste {
+		names = append(names, "paste")
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	return strings.Join(names, ", ")
+}
+
+// Config holds what the backends may need to open.
+type Config struct {
+	// HexKeycodes maps hex digits to keycodes for Unicode hex input.
+	HexKeycodes map[rune]uint16
+	// TTY is the connection to the TTY helper, if one was started.
+	TTY *ttybridge.Client
+	// PTYPath is the PTY to mirror text into.
+	PTYPath string
+}
+
+// Backend is one way of delivering output.
+type Backend struct {
+	Name         string
+	Description  string
+	Capabilities Capabilities
+	Open         func(Config) (Output, error)
+}
+
+var backends = []Backend{
+	{
+		Name:         "wayland",
+		Description:  "Wayland input method with a virtual keyboard fallback",
+		Capabilities: Capabilities{Preedit: true, Unicode: true, Backspace: true},
+		Open: func(Config) (Output, error) {
+			if os.Getenv("WAYLAND_DISPLAY") == "" {
+				return nil, fmt.Errorf("WAYLAND_DISPLAY not set: %w", ErrUnavailable)
+			}
+			return OpenWayland()
+		},
+	},
+	{
+		Name:         "xtest",
+		Description:  "uinput keyboard, with text typed through the X11 XTEST extension",
+		Capabilities: Capabilities{Preedit: true, Unicode: true, Backspace: true, Paste: true},
+		Open: func(cfg Config) (Output, error) {
+			if os.Getenv("DISPLAY") == "" {
+				return nil, fmt.Errorf("DISPLAY not set: %w", ErrUnavailable)
+			}
+			return openUinput(cfg.HexKeycodes, textXTest)
+		},
+	},
+	{
+		Name:         "uinput-remap",
+		Description:  "uinput keyboard, with text typed on spare keys remapped through X11",
+		Capabilities: Capabilities{Preedit: true, Unicode: true, Backspace: true, Paste: true},
+		Open: func(cfg Config) (Output, error) {
+			if os.Getenv("DISPLAY") == "" {
+				return nil, fmt.Errorf("DISPLAY not set: %w", ErrUnavailable)
+			}
+			return openUinput(cfg.HexKeycodes, textRemap)
+		},
+	},
+	{
+		Name:         "uinput-hex",
+		Description:  "uinput keyboard, with text typed as Ctrl+Shift+U hex sequences",
+		Capabilities: Capabilities{Unicode: true, Backspace: true, Paste: true},
+		Open: func(cfg Config) (Output, error) {
+			return openUinput(cfg.HexKeycodes, textHex)
+		},
+	},
+	{
+		Name:         "pty",
+		Description:  "text written into the PTY given with --pty",
+		Capabilities: Capabilities{Preedit: true, Unicode: true, Backspace: true},
+		Open: func(cfg Config) (Output, error) {
+			if cfg.PTYPath == "" {
+				return nil, fmt.Errorf("no --pty path: %w", ErrUnavailable)
+			}
+			return openPTY(cfg.PTYPath)
+		},
+	},
+	{
+		Name:         "tty",
+		Description:  "text injected into the controlling terminal by the TTY helper, and mirrored into --pty",
+		Capabilities: Capabilities{Preedit: true, Unicode: true, Backspace: true},
+		Open: func(cfg Config) (Output, error) {
+			if cfg.TTY == nil {
+				return nil, fmt.Errorf("no terminal: %w", ErrUnavailable)
+			}
+			return openTTY(cfg.TTY, cfg.PTYPath)
+		},
+	},
+}
+
+// Backends returns every backend in the order of the default chain.
+func Backends() []Backend {
+	return append([]Backend(nil), backends...)
+}
+
+// Lookup returns the backend called name.
+func Lookup(name string) (Backend, bool) {
+	for _, backend := range backends {
+		if backend.Name == name {
+			return backend, true
+		}
+	}
+	return Backend{}, false
+}
+
+// ParseChain checks a list of backend names, such as the value of
+// --output.
+func ParseChain(names []string) ([]string, error) {
+	chain := make([]string, 0, len(names))
+	for _, name := range names {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if _, ok := Lookup(name); !ok {
+			return nil, fmt.Errorf("unknown output backend %q (available: %s)", name, strings.Join(backendNames(), ", "))
+		}
+		chain = append(chain, name)
+	}
+	return chain, nil
+}
+
+// DefaultChain is used when no chain is configured. Direct mode writes to
+// the terminal only, through the TTY helper (which also fills --pty) or
+// the PTY alone; otherwise the desktop backends are tried before plain
+// uinput.
+func DefaultChain(direct bool) []string {
+	if direct {
+		return []string{"tty", "pty"}
+	}
+	return []string{"wayland", "xtest", "uinput-remap", "uinput-hex"}
+}
+
+// OpenChain opens the first backend in chain that works. skipped, if
+// not nil, is told about each backend that failed on the way.
+func OpenChain(chain []string, cfg Config, skipped func(Backend, error)) (Output, Backend, error) {
+	for _, name := range chain {
+		backend, ok := Lookup(name)
+		if !ok {
+			return nil, Backend{}, fmt.Errorf("unknown output backend %q", name)
+		}
+		out, err := backend.Open(cfg)
+		if err == nil {
+			return out, backend, nil
+		}
+		if skipped != nil {
+			skipped(backend, err)
+		}
+	}
+	return nil, Backend{}, fmt.Errorf("no usable output backend in %s", strings.Join(chain, ", "))
+}
+
+func backendNames() []string {
+	names := make([]string, len(backends))
+	for i, backend := range backends {
+		names[i] = backend.Name
+	}
+	return names
+}
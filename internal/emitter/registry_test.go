@@ -0,0 +1,63 @@
+package emitter
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseChain(t *testing.T) {
+	chain, err := ParseChain([]string{"XTest", " uinput-hex "})
+	if err != nil {
+		t.Fatalf("ParseChain: %v", err)
+	}
+	if len(chain) != 2 || chain[0] != "xtest" || chain[1] != "uinput-hex" {
+		t.Fatalf("expected normalized names, got %v", chain)
+	}
+	if _, err := ParseChain([]string{"xtest", "carrier-pigeon"}); err == nil {
+		t.Fatalf("expected an error for an unknown backend")
+	}
+	for _, direct := range []bool{false, true} {
+		if _, err := ParseChain(DefaultChain(direct)); err != nil {
+			t.Fatalf("default chain (direct %v) names an unknown backend: %v", direct, err)
+		}
+	}
+}
+
+func TestOpenChainSkipsUnavailableBackends(t *testing.T) {
+	t.Setenv("WAYLAND_DISPLAY", "")
+	ptyPath := filepath.Join(t.TempDir(), "pty")
+	if err := os.WriteFile(ptyPath, nil, 0o600); err != nil {
+		t.Fatalf("create pty stand-in: %v", err)
+	}
+
+	var skipped []string
+	out, backend, err := OpenChain([]string{"wayland", "tty", "pty"}, Config{PTYPath: ptyPath}, func(b Backend, err error) {
+		if !errors.Is(err, ErrUnavailable) {
+			t.Errorf("%s: expected ErrUnavailable, got %v", b.Name, err)
+		}
+		skipped = append(skipped, b.Name)
+	})
+	if err != nil {
+		t.Fatalf("OpenChain: %v", err)
+	}
+	defer out.Close()
+	if backend.Name != "pty" || len(skipped) != 2 {
+		t.Fatalf("expected pty after skipping wayland and tty, got %s (skipped %v)", backend.Name, skipped)
+	}
+	if !out.SupportsPreedit() || !backend.Capabilities.Preedit {
+		t.Fatalf("expected the pty backend to support preedit")
+	}
+	if err := out.SendText("한"); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	data, err := os.ReadFile(ptyPath)
+	if err != nil || string(data) != "한" {
+		t.Fatalf("expected the text in the pty, got %q (%v)", data, err)
+	}
+
+	if _, _, err := OpenChain([]string{"tty"}, Config{}, nil); err == nil {
+		t.Fatalf("expected an error when no backend opens")
+	}
+}
@@ -0,0 +1,515 @@
+package emitter
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/util"
+	"github.com/gg582/hanfe/internal/wayland"
+	"golang.org/x/sys/unix"
+)
+
+// Protocol opcodes used by WaylandEmitter.
+const (
+	imManagerGetInputMethod = 0
+
+	imCommitString          = 0
+	imSetPreeditString      = 1
+	imDeleteSurroundingText = 2
+	imCommit                = 3
+	imDestroy               = 6
+
+	imEventActivate    = 0
+	imEventDeactivate  = 1
+	imEventDone        = 5
+	imEventUnavailable = 6
+
+	vkManagerCreate = 0
+
+	vkKeymap    = 0
+	vkKey       = 1
+	vkModifiers = 2
+	vkDestroy   = 3
+
+	keymapFormatXKBV1 = 1
+)
+
+// Modifier masks of the real modifiers in the generated keymap.
+const (
+	modShift   = 1 << 0
+	modControl = 1 << 2
+	modAlt     = 1 << 3
+	modSuper   = 1 << 6
+)
+
+// spareKeys are the evdev codes (F13-F24) the generated keymap rebinds to
+// the characters being typed through the virtual keyboard.
+var spareKeys = []uint16{183, 184, 185, 186, 187, 188, 189, 190, 191, 192, 193, 194}
+
+// maxHistory bounds the text remembered for delete_surrounding_text.
+const maxHistory = 256
+
+// maxCommitBytes keeps a commit_string request under the 4 KiB Wayland
+// message limit; compositors disconnect clients that exceed it.
+const maxCommitBytes = 4000
+
+// WaylandEmitter sends output through the compositor. Text goes through
+// zwp_input_method_v2 while a text field is active, with a real preedit;
+// otherwise, and for forwarded keys, it goes through
+// zwp_virtual_keyboard_v1 with a generated keymap.
+type WaylandEmitter struct {
+	client *wayland.Client
+	seat   uint32
+	vk     uint32
+	im     uint32
+	start  time.Time
+	// symbols is the XKB layout the generated keymap starts from.
+	symbols string
+
+	mu            sync.Mutex
+	imAvailable   bool
+	active        bool
+	pendingActive bool
+	serial        uint32
+
+	// history is the text committed through the input method since the
+	// last activation or forwarded key, so backspaces can be turned into
+	// byte counts.
+	history   []rune
+	keymap    []rune
+	modifiers uint32
+	closed    bool
+}
+
+var _ PreeditOutput = (*WaylandEmitter)(nil)
+
+// OpenWayland connects to the compositor named by $WAYLAND_DISPLAY.
+func OpenWayland() (*WaylandEmitter, error) {
+	path, err := wayland.SocketPath()
+	if err != nil {
+		return nil, err
+	}
+	return OpenWaylandSocket(path)
+}
+
+// OpenWaylandSocket connects to the compositor listening at path. The
+// compositor must offer zwp_virtual_keyboard_manager_v1;
+// zwp_input_method_manager_v2 is used when present.
+func OpenWaylandSocket(path string) (*WaylandEmitter, error) {
+	client, err := wayland.Dial(path)
+	if err != nil {
+		return nil, err
+	}
+	symbols := xkbSymbols(os.Getenv("XKB_DEFAULT_LAYOUT"), os.Getenv("XKB_DEFAULT_VARIANT"))
+	w := &WaylandEmitter{client: client, start: time.Now(), symbols: symbols}
+	if err := w.setup(); err != nil {
+		client.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *WaylandEmitter) setup() error {
+	seat, ok := w.client.Global("wl_seat")
+	if !ok {
+		return fmt.Errorf("compositor has no wl_seat")
+	}
+	vkManager, ok := w.client.Global("zwp_virtual_keyboard_manager_v1")
+	if !ok {
+		return fmt.Errorf("compositor does not support zwp_virtual_keyboard_manager_v1")
+	}
+	var err error
+	if w.seat, err = w.client.Bind(seat, 1, nil); err != nil {
+		return err
+	}
+	manager, err := w.client.Bind(vkManager, 1, nil)
+	if err != nil {
+		return err
+	}
+	w.vk = w.client.NewObject(nil)
+	if err := w.client.Send(wayland.NewMessage(manager, vkManagerCreate).PutUint(w.seat).PutUint(w.vk)); err != nil {
+		return err
+	}
+	if err := w.uploadKeymap(nil); err != nil {
+		return err
+	}
+
+	if imManager, ok := w.client.Global("zwp_input_method_manager_v2"); ok {
+		manager, err := w.client.Bind(imManager, 1, nil)
+		if err != nil {
+			return err
+		}
+		w.imAvailable = true
+		w.im = w.client.NewObject(w.handleInputMethod)
+		if err := w.client.Send(wayland.NewMessage(manager, imManagerGetInputMethod).PutUint(w.seat).PutUint(w.im)); err != nil {
+			return err
+		}
+	}
+	return w.client.Roundtrip()
+}
+
+// handleInputMethod tracks activation. Changes are double-buffered and
+// take effect on done, whose count is the serial for commit requests.
+func (w *WaylandEmitter) handleInputMethod(m *wayland.Message) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	switch m.Opcode {
+	case imEventActivate:
+		w.pendingActive = true
+	case imEventDeactivate:
+		w.pendingActive = false
+	case imEventDone:
+		w.serial++
+		if w.active != w.pendingActive {
+			w.history = nil
+		}
+		w.active = w.pendingActive
+	case imEventUnavailable:
+		// Another input method owns the seat.
+		w.imAvailable = false
+		w.active = false
+	}
+}
+
+func (w *WaylandEmitter) imActive() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.imAvailable && w.active
+}
+
+func (w *WaylandEmitter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	im := w.im
+	w.mu.Unlock()
+	if im != 0 {
+		_ = w.client.Send(wayland.NewMessage(im, imDestroy))
+	}
+	_ = w.client.Send(wayland.NewMessage(w.vk, vkDestroy))
+	_ = w.client.Roundtrip()
+	return w.client.Close()
+}
+
+// ForwardEvent passes key presses and releases to the virtual keyboard.
+// The compositor's clients repeat keys themselves, so repeats are dropped.
+func (w *WaylandEmitter) ForwardEvent(ev *util.InputEvent) error {
+	if ev == nil || ev.Type != linux.EvKey || ev.Value == 2 {
+		return nil
+	}
+	return w.SendKeyState(ev.Code, ev.Value == 1)
+}
+
+func (w *WaylandEmitter) SendKeyState(code uint16, pressed bool) error {
+	state := uint32(0)
+	if pressed {
+		state = 1
+	}
+	w.mu.Lock()
+	mask, isModifier := modifierMask(code)
+	if pressed && !isModifier {
+		// The cursor may move or text change; committed text is no longer
+		// known to precede it.
+		w.history = nil
+	}
+	mods := w.modifiers
+	if isModifier {
+		if pressed {
+			w.modifiers |= mask
+		} else {
+			w.modifiers &^= mask
+		}
+		mods = w.modifiers
+	}
+	w.mu.Unlock()
+
+	if err := w.client.Send(wayland.NewMessage(w.vk, vkKey).PutUint(w.timestamp()).PutUint(uint32(code)).PutUint(state)); err != nil {
+		return err
+	}
+	if isModifier {
+		return w.sendModifiers(mods)
+	}
+	return nil
+}
+
+func (w *WaylandEmitter) TapKey(code uint16) error {
+	if err := w.SendKeyState(code, true); err != nil {
+		return err
+	}
+	return w.SendKeyState(code, false)
+}
+
+// SendBackspace removes count characters before the cursor. Text this
+// emitter committed through the input method is deleted with
+// delete_surrounding_text; anything else gets Backspace key taps.
+func (w *WaylandEmitter) SendBackspace(count int) error {
+	if count <= 0 {
+		return nil
+	}
+	w.mu.Lock()
+	if w.imAvailable && w.active && count <= len(w.history) {
+		removed := w.history[len(w.history)-count:]
+		w.history = w.history[:len(w.history)-count]
+		bytes := len(string(removed))
+		serial := w.serial
+		w.mu.Unlock()
+		if err := w.client.Send(wayland.NewMessage(w.im, imDeleteSurroundingText).PutUint(uint32(bytes)).PutUint(0)); err != nil {
+			return err
+		}
+		return w.client.Send(wayland.NewMessage(w.im, imCommit).PutUint(serial))
+	}
+	w.mu.Unlock()
+	for i := 0; i < count; i++ {
+		if err := w.TapKey(uint16(linux.KeyBackspace)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (w *WaylandEmitter) SendText(text string) error {
+	if text == "" {
+		return nil
+	}
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("invalid utf-8 sequence")
+	}
+	w.mu.Lock()
+	if w.imAvailable && w.active {
+		w.history = append(w.history, []rune(text)...)
+		if len(w.history) > maxHistory {
+			w.history = append([]rune(nil), w.history[len(w.history)-maxHistory:]...)
+		}
+		serial := w.serial
+		w.mu.Unlock()
+		for _, chunk := range splitUTF8(text, maxCommitBytes) {
+			if err := w.client.Send(wayland.NewMessage(w.im, imCommitString).PutString(chunk)); err != nil {
+				return err
+			}
+			if err := w.client.Send(wayland.NewMessage(w.im, imCommit).PutUint(serial)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	w.mu.Unlock()
+	return w.typeText(text)
+}
+
+// splitUTF8 cuts text into pieces of at most max bytes without splitting
+// a character.
+func splitUTF8(text string, max int) []string {
+	var chunks []string
+	for len(text) > max {
+		cut := max
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+		chunks = append(chunks, text[:cut])
+		text = text[cut:]
+	}
+	return append(chunks, text)
+}
+
+// NativePreedit reports whether a text field is active, so SetPreedit
+// shows a real preedit.
+func (w *WaylandEmitter) NativePreedit() bool {
+	return w.imActive()
+}
+
+// SetPreedit replaces the input method preedit, with the cursor after it.
+// Without an active text field it does nothing.
+func (w *WaylandEmitter) SetPreedit(text string) error {
+	w.mu.Lock()
+	if !w.imAvailable || !w.active {
+		w.mu.Unlock()
+		return nil
+	}
+	serial := w.serial
+	w.mu.Unlock()
+	cursor := int32(len(text))
+	m := wayland.NewMessage(w.im, imSetPreeditString).PutString(text).PutInt(cursor).PutInt(cursor)
+	if err := w.client.Send(m); err != nil {
+		return err
+	}
+	return w.client.Send(wayland.NewMessage(w.im, imCommit).PutUint(serial))
+}
+
+func (w *WaylandEmitter) SupportsPreedit() bool {
+	return true
+}
+
+// typeText types text on the virtual keyboard. Characters are bound to the
+// spare keys a batch at a time; the rest of the keymap stays the user's
+// layout, so forwarded keys keep working between batches.
+func (w *WaylandEmitter) typeText(text string) error {
+	runes := []rune(text)
+	for len(runes) > 0 {
+		var batch []rune
+		n := 0
+		for ; n < len(runes); n++ {
+			r := runes[n]
+			if r == '\n' || r == '\t' || indexRune(batch, r) >= 0 {
+				continue
+			}
+			if len(batch) == len(spareKeys) {
+				break
+			}
+			batch = append(batch, r)
+		}
+		if err := w.ensureKeymap(batch); err != nil {
+			return err
+		}
+		for _, r := range runes[:n] {
+			if err := w.typeRune(r); err != nil {
+				return err
+			}
+		}
+		runes = runes[n:]
+	}
+	return nil
+}
+
+func (w *WaylandEmitter) typeRune(r rune) error {
+	switch r {
+	case '\n':
+		return w.TapKey(uint16(linux.KeyEnter))
+	case '\t':
+		return w.TapKey(uint16(linux.KeyTab))
+	}
+	w.mu.Lock()
+	idx := indexRune(w.keymap, r)
+	w.mu.Unlock()
+	if idx < 0 {
+		return fmt.Errorf("character %q is not in the keymap", r)
+	}
+	return w.TapKey(spareKeys[idx])
+}
+
+// ensureKeymap uploads a keymap binding chars unless the current one
+// already has all of them.
+func (w *WaylandEmitter) ensureKeymap(chars []rune) error {
+	w.mu.Lock()
+	missing := false
+	for _, r := range chars {
+		if indexRune(w.keymap, r) < 0 {
+			missing = true
+			break
+		}
+	}
+	w.mu.Unlock()
+	if !missing {
+		return nil
+	}
+	return w.uploadKeymap(chars)
+}
+
+func (w *WaylandEmitter) uploadKeymap(chars []rune) error {
+	text := waylandKeymap(w.symbols, chars)
+	fd, err := unix.MemfdCreate("hanfe-keymap", unix.MFD_CLOEXEC)
+	if err != nil {
+		return fmt.Errorf("create keymap file: %w", err)
+	}
+	defer syscall.Close(fd)
+	data := append([]byte(text), 0)
+	if _, err := syscall.Write(fd, data); err != nil {
+		return fmt.Errorf("write keymap: %w", err)
+	}
+	m := wayland.NewMessage(w.vk, vkKeymap).PutUint(keymapFormatXKBV1).PutFD(fd).PutUint(uint32(len(data)))
+	if err := w.client.Send(m); err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.keymap = append([]rune(nil), chars...)
+	mods := w.modifiers
+	w.mu.Unlock()
+	// A new keymap resets the modifier state.
+	return w.sendModifiers(mods)
+}
+
+func (w *WaylandEmitter) sendModifiers(depressed uint32) error {
+	return w.client.Send(wayland.NewMessage(w.vk, vkModifiers).PutUint(depressed).PutUint(0).PutUint(0).PutUint(0))
+}
+
+func (w *WaylandEmitter) timestamp() uint32 {
+	return uint32(time.Since(w.start) / time.Millisecond)
+}
+
+// xkbSymbols returns the XKB symbols of the layouts and variants named
+// like $XKB_DEFAULT_LAYOUT and $XKB_DEFAULT_VARIANT, comma-separated, or of
+// a US layout when none is named.
+func xkbSymbols(layouts, variants string) string {
+	names := strings.Split(layouts, ",")
+	kinds := strings.Split(variants, ",")
+	var b strings.Builder
+	b.WriteString("pc")
+	group := 0
+	for i, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		group++
+		b.WriteString("+" + name)
+		if i < len(kinds) && strings.TrimSpace(kinds[i]) != "" {
+			b.WriteString("(" + strings.TrimSpace(kinds[i]) + ")")
+		}
+		if group > 1 {
+			fmt.Fprintf(&b, ":%d", group)
+		}
+	}
+	if group == 0 {
+		b.WriteString("+us")
+	}
+	b.WriteString("+inet(evdev)")
+	return b.String()
+}
+
+// waylandKeymap returns a keymap with symbols and chars bound to the spare
+// keys.
+func waylandKeymap(symbols string, chars []rune) string {
+	var b strings.Builder
+	b.WriteString("xkb_keymap {\n")
+	b.WriteString("\txkb_keycodes \"hanfe\" { include \"evdev+aliases(qwerty)\" };\n")
+	b.WriteString("\txkb_types \"hanfe\" { include \"complete\" };\n")
+	b.WriteString("\txkb_compatibility \"hanfe\" { include \"complete\" };\n")
+	b.WriteString("\txkb_symbols \"hanfe\" {\n")
+	fmt.Fprintf(&b, "\t\tinclude \"%s\"\n", symbols)
+	for i, r := range chars {
+		fmt.Fprintf(&b, "\t\tkey <FK%d> { [ U%04X ] };\n", 13+i, r)
+	}
+	b.WriteString("\t};\n};\n")
+	return b.String()
+}
+
+func modifierMask(code uint16) (uint32, bool) {
+	switch int(code) {
+	case linux.KeyLeftShift, linux.KeyRightShift:
+		return modShift, true
+	case linux.KeyLeftCtrl, linux.KeyRightCtrl:
+		return modControl, true
+	case linux.KeyLeftAlt, linux.KeyRightAlt:
+		return modAlt, true
+	case linux.KeyLeftMeta, linux.KeyRightMeta:
+		return modSuper, true
+	}
+	return 0, false
+}
+
+func indexRune(runes []rune, r rune) int {
+	for i, candidate := range runes {
+		if candidate == r {
+			return i
+		}
+	}
+	return -1
+}
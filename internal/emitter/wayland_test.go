@@ -0,0 +1,330 @@
+package emitter
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/util"
+	"github.com/gg582/hanfe/internal/wayland"
+)
+
+// stubCompositor is a minimal Wayland server offering the globals the
+// emitter needs. It records the requests it receives as short strings.
+type stubCompositor struct {
+	t           *testing.T
+	path        string
+	listener    *net.UnixListener
+	inputMethod bool
+
+	mu      sync.Mutex
+	conn    *wayland.Conn
+	objects map[uint32]string
+	im      uint32
+	keymaps []string
+	log     []string
+}
+
+func newStubCompositor(t *testing.T, inputMethod bool) *stubCompositor {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "wayland-0")
+	listener, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	s := &stubCompositor{t: t, path: path, listener: listener, inputMethod: inputMethod, objects: make(map[uint32]string)}
+	go s.serve()
+	t.Cleanup(func() { listener.Close() })
+	return s
+}
+
+func (s *stubCompositor) serve() {
+	raw, err := s.listener.AcceptUnix()
+	if err != nil {
+		return
+	}
+	conn := wayland.NewConn(raw)
+	s.mu.Lock()
+	s.conn = conn
+	s.mu.Unlock()
+	defer conn.Close()
+	for {
+		m, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		if err := s.handle(conn, m); err != nil {
+			s.t.Errorf("stub compositor: %v", err)
+			return
+		}
+	}
+}
+
+func (s *stubCompositor) handle(conn *wayland.Conn, m *wayland.Message) error {
+	d := m.Decode()
+	if m.Object == wayland.DisplayID {
+		id := d.Uint()
+		switch m.Opcode {
+		case 0: // sync
+			if err := conn.WriteMessage(wayland.NewMessage(id, 0).PutUint(0)); err != nil {
+				return err
+			}
+			return conn.WriteMessage(wayland.NewMessage(wayland.DisplayID, 1).PutUint(id))
+		case 1: // get_registry
+			s.setObject(id, "wl_registry")
+			globals := []string{"wl_seat", "zwp_virtual_keyboard_manager_v1"}
+			if s.inputMethod {
+				globals = append(globals, "zwp_input_method_manager_v2")
+			}
+			for i, iface := range globals {
+				if err := conn.WriteMessage(wayland.NewMessage(id, 0).PutUint(uint32(i + 1)).PutString(iface).PutUint(1)); err != nil {
+					return err
+				}
+			}
+		}
+		return d.Err()
+	}
+
+	s.mu.Lock()
+	iface := s.objects[m.Object]
+	s.mu.Unlock()
+	switch iface {
+	case "wl_registry":
+		d.Uint()
+		name := d.String()
+		d.Uint()
+		s.setObject(d.Uint(), name)
+	case "zwp_virtual_keyboard_manager_v1":
+		d.Uint()
+		s.setObject(d.Uint(), "zwp_virtual_keyboard_v1")
+	case "zwp_input_method_manager_v2":
+		d.Uint()
+		id := d.Uint()
+		s.setObject(id, "zwp_input_method_v2")
+		s.mu.Lock()
+		s.im = id
+		s.mu.Unlock()
+	case "zwp_virtual_keyboard_v1":
+		switch m.Opcode {
+		case vkKeymap:
+			d.Uint()
+			fd := d.FD()
+			size := d.Uint()
+			if d.Err() != nil {
+				return d.Err()
+			}
+			file := os.NewFile(uintptr(fd), "keymap")
+			data := make([]byte, size)
+			_, err := file.ReadAt(data, 0)
+			file.Close()
+			if err != nil {
+				return fmt.Errorf("read keymap: %w", err)
+			}
+			s.mu.Lock()
+			s.keymaps = append(s.keymaps, strings.TrimRight(string(data), "\x00"))
+			s.mu.Unlock()
+		case vkKey:
+			d.Uint()
+			key, state := d.Uint(), d.Uint()
+			s.record("key %d %d", key, state)
+		case vkModifiers:
+			s.record("modifiers %d", d.Uint())
+		}
+	case "zwp_input_method_v2":
+		switch m.Opcode {
+		case imCommitString:
+			s.record("commit_string %s", d.String())
+		case imSetPreeditString:
+			text := d.String()
+			s.record("preedit %s %d", text, d.Int())
+		case imDeleteSurroundingText:
+			s.record("delete %d %d", d.Uint(), d.Uint())
+		case imCommit:
+			s.record("commit %d", d.Uint())
+		}
+	}
+	return d.Err()
+}
+
+func (s *stubCompositor) setObject(id uint32, iface string) {
+	s.mu.Lock()
+	s.objects[id] = iface
+	s.mu.Unlock()
+}
+
+func (s *stubCompositor) record(format string, args ...any) {
+	s.mu.Lock()
+	s.log = append(s.log, fmt.Sprintf(format, args...))
+	s.mu.Unlock()
+}
+
+// activate focuses a text field for the input method.
+func (s *stubCompositor) activate() {
+	s.mu.Lock()
+	conn, im := s.conn, s.im
+	s.mu.Unlock()
+	if err := conn.WriteMessage(wayland.NewMessage(im, imEventActivate)); err != nil {
+		s.t.Fatalf("send activate: %v", err)
+	}
+	if err := conn.WriteMessage(wayland.NewMessage(im, imEventDone)); err != nil {
+		s.t.Fatalf("send done: %v", err)
+	}
+}
+
+// take returns and clears the requests recorded so far, ignoring
+// modifier updates.
+func (s *stubCompositor) take(t *testing.T, w *WaylandEmitter) []string {
+	t.Helper()
+	if err := w.client.Roundtrip(); err != nil {
+		t.Fatalf("roundtrip: %v", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var out []string
+	for _, entry := range s.log {
+		if !strings.HasPrefix(entry, "modifiers") {
+			out = append(out, entry)
+		}
+	}
+	s.log = nil
+	return out
+}
+
+func openStubEmitter(t *testing.T, inputMethod bool) (*stubCompositor, *WaylandEmitter) {
+	t.Helper()
+	stub := newStubCompositor(t, inputMethod)
+	w, err := OpenWaylandSocket(stub.path)
+	if err != nil {
+		t.Fatalf("OpenWaylandSocket: %v", err)
+	}
+	t.Cleanup(func() { w.Close() })
+	stub.take(t, w)
+	return stub, w
+}
+
+func TestWaylandVirtualKeyboard(t *testing.T) {
+	stub, w := openStubEmitter(t, false)
+	if w.NativePreedit() {
+		t.Fatalf("expected no native preedit without an input method")
+	}
+
+	if err := w.SendText("한글"); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	want := []string{"key 183 1", "key 183 0", "key 184 1", "key 184 0"}
+	if got := stub.take(t, w); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	stub.mu.Lock()
+	keymap := stub.keymaps[len(stub.keymaps)-1]
+	stub.mu.Unlock()
+	for _, entry := range []string{"key <FK13> { [ UD55C ] };", "key <FK14> { [ UAE00 ] };"} {
+		if !strings.Contains(keymap, entry) {
+			t.Fatalf("expected the keymap to contain %q, got:\n%s", entry, keymap)
+		}
+	}
+
+	// Characters already in the keymap do not upload a new one.
+	if err := w.SendText("글"); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	stub.take(t, w)
+	stub.mu.Lock()
+	uploads := len(stub.keymaps)
+	stub.mu.Unlock()
+	if uploads != 2 {
+		t.Fatalf("expected the base keymap and one character keymap, got %d uploads", uploads)
+	}
+
+	if err := w.SendBackspace(1); err != nil {
+		t.Fatalf("SendBackspace: %v", err)
+	}
+	repeat := util.InputEvent{Type: linux.EvKey, Code: uint16(linux.KeyA), Value: 2}
+	if err := w.ForwardEvent(&repeat); err != nil {
+		t.Fatalf("ForwardEvent: %v", err)
+	}
+	want = []string{fmt.Sprintf("key %d 1", linux.KeyBackspace), fmt.Sprintf("key %d 0", linux.KeyBackspace)}
+	if got := stub.take(t, w); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestWaylandInputMethod(t *testing.T) {
+	stub, w := openStubEmitter(t, true)
+	stub.activate()
+	stub.take(t, w)
+	if !w.NativePreedit() {
+		t.Fatalf("expected a native preedit once a text field is active")
+	}
+
+	if err := w.SetPreedit("하"); err != nil {
+		t.Fatalf("SetPreedit: %v", err)
+	}
+	if err := w.SendText("한"); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	if err := w.SendBackspace(1); err != nil {
+		t.Fatalf("SendBackspace: %v", err)
+	}
+	want := []string{"preedit 하 3", "commit 1", "commit_string 한", "commit 1", "delete 3 0", "commit 1"}
+	if got := stub.take(t, w); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	// Text the emitter did not commit is erased with key taps.
+	if err := w.SendBackspace(1); err != nil {
+		t.Fatalf("SendBackspace: %v", err)
+	}
+	want = []string{fmt.Sprintf("key %d 1", linux.KeyBackspace), fmt.Sprintf("key %d 0", linux.KeyBackspace)}
+	if got := stub.take(t, w); !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestWaylandSplitsLongCommits(t *testing.T) {
+	stub, w := openStubEmitter(t, true)
+	stub.activate()
+	stub.take(t, w)
+
+	// 3000 three-byte syllables must not be cut inside a character.
+	text := strings.Repeat("한", 3000)
+	if err := w.SendText(text); err != nil {
+		t.Fatalf("SendText: %v", err)
+	}
+	var got strings.Builder
+	commits := 0
+	for _, entry := range stub.take(t, w) {
+		if chunk, ok := strings.CutPrefix(entry, "commit_string "); ok {
+			if len(chunk) > maxCommitBytes || !utf8.ValidString(chunk) {
+				t.Fatalf("expected chunks of whole characters under %d bytes, got %d bytes", maxCommitBytes, len(chunk))
+			}
+			got.WriteString(chunk)
+			commits++
+		}
+	}
+	if commits != 3 || got.String() != text {
+		t.Fatalf("expected the text in 3 commits, got %d commits of %d bytes", commits, got.Len())
+	}
+}
+
+func TestXKBSymbols(t *testing.T) {
+	cases := []struct {
+		layouts, variants, want string
+	}{
+		{"", "", "pc+us+inet(evdev)"},
+		{"de", "", "pc+de+inet(evdev)"},
+		{"us,de", ",nodeadkeys", "pc+us+de(nodeadkeys):2+inet(evdev)"},
+	}
+	for _, c := range cases {
+		if got := xkbSymbols(c.layouts, c.variants); got != c.want {
+			t.Fatalf("xkbSymbols(%q, %q) = %q, want %q", c.layouts, c.variants, got, c.want)
+		}
+	}
+}
@@ -3,7 +3,9 @@ package emitter
 import (
 	"fmt"
 	"os"
+	"sort"
 	"sync"
+	"time"
 	"unicode/utf8"
 
 	"github.com/BurntSushi/xgb"
@@ -16,12 +18,20 @@ const (
 	keysymTab    = 0xff09
 )
 
+// x11Injector types text through XTEST on a pool of spare keycodes. The
+// server handles the requests of one connection in order, so a key press
+// always sees the mapping sent before it: requests go out unchecked and a
+// single round trip at the end reports whether the server kept up.
+// Clients still translate the presses later with a mapping they fetch on
+// their own, so a keycode is not remapped until its last press settled.
 type x11Injector struct {
 	conn     *xgb.Conn
-	keycode  byte
 	width    int
-	original []xproto.Keysym
-	mu       sync.Mutex
+	original map[xproto.Keycode][]xproto.Keysym
+	pool     *keycodePool
+	// pending collects the mapping changes of a batch until they are sent.
+	pending map[xproto.Keycode]xproto.Keysym
+	mu      sync.Mutex
 }
 
 func newX11Injector() (*x11Injector, error) {
@@ -37,110 +47,131 @@ func newX11Injector() (*x11Injector, error) {
 		conn.Close()
 		return nil, err
 	}
-	setup := xproto.Setup(conn)
-	min := byte(setup.MinKeycode)
-	max := byte(setup.MaxKeycode)
-	count := int(max - min + 1)
-	reply, err := xproto.GetKeyboardMapping(conn, xproto.Keycode(min), byte(count)).Reply()
+	mapping, err := getKeyboardMapping(conn)
 	if err != nil {
 		conn.Close()
 		return nil, err
 	}
-	width := int(reply.KeysymsPerKeycode)
-	if width <= 0 {
-		conn.Close()
-		return nil, fmt.Errorf("invalid keysyms width")
-	}
-	var chosen byte
-	keysyms := reply.Keysyms
-	for i := 0; i < count; i++ {
-		kc := byte(int(min) + i)
-		slice := keysyms[i*width : (i+1)*width]
-		empty := true
-		for _, sym := range slice {
-			if sym != 0 {
-				empty = false
-				break
-			}
-		}
-		if empty {
-			chosen = kc
-			break
-		}
-	}
-	if chosen == 0 {
-		chosen = max
-	}
-	idx := int(int(chosen)-int(min)) * width
-	original := append([]xproto.Keysym(nil), keysyms[idx:idx+width]...)
-	inj := &x11Injector{conn: conn, keycode: chosen, width: width, original: original}
-	if err := inj.updateMapping(0); err != nil {
+	keycodes := reserveKeycodes(mapping, mapping.min)
+	x := &x11Injector{
+		conn:     conn,
+		width:    mapping.width,
+		original: make(map[xproto.Keycode][]xproto.Keysym),
+		pending:  make(map[xproto.Keycode]xproto.Keysym),
+	}
+	for _, kc := range keycodes {
+		x.original[kc] = append([]xproto.Keysym(nil), mapping.row(kc)...)
+		x.pending[kc] = 0
+	}
+	x.pool = newKeycodePool(keycodes, remapSettle, x.queueMapping)
+	go discardEvents(conn)
+	x.flushMapping()
+	if err := x.sync(); err != nil {
 		conn.Close()
 		return nil, err
 	}
-	return inj, nil
+	return x, nil
 }
 
-func (x *x11Injector) updateMapping(sym xproto.Keysym) error {
-	keysyms := make([]xproto.Keysym, x.width)
-	if sym != 0 {
-		keysyms[0] = sym
-	}
-	return xproto.ChangeKeyboardMappingChecked(x.conn, byte(x.width), xproto.Keycode(x.keycode), 1, keysyms).Check()
+func (x *x11Injector) queueMapping(keycode xproto.Keycode, sym xproto.Keysym) error {
+	x.pending[keycode] = sym
+	return nil
 }
 
-func (x *x11Injector) typeRune(r rune) error {
-	if r == '\n' {
-		return x.typeKeySym(xproto.Keysym(keysymReturn))
-	}
-	if r == '\r' {
-		return nil
-	}
-	if r == '\t' {
-		return x.typeKeySym(xproto.Keysym(keysymTab))
-	}
-	if r < 0 {
-		return fmt.Errorf("invalid rune")
+// flushMapping sends the queued mapping changes, one request for each run
+// of consecutive keycodes.
+func (x *x11Injector) flushMapping() {
+	keycodes := make([]xproto.Keycode, 0, len(x.pending))
+	for kc := range x.pending {
+		keycodes = append(keycodes, kc)
+	}
+	sort.Slice(keycodes, func(i, j int) bool { return keycodes[i] < keycodes[j] })
+	for _, run := range keycodeRuns(keycodes) {
+		keysyms := make([]xproto.Keysym, 0, len(run)*x.width)
+		for _, kc := range run {
+			keysyms = append(keysyms, keysymRow(x.width, x.pending[kc])...)
+		}
+		xproto.ChangeKeyboardMapping(x.conn, byte(len(run)), run[0], byte(x.width), keysyms)
 	}
-	keysym := xproto.Keysym(0x01000000 | uint32(r))
-	return x.typeKeySym(keysym)
+	clear(x.pending)
 }
 
-func (x *x11Injector) typeKeySym(sym xproto.Keysym) error {
-	x.mu.Lock()
-	defer x.mu.Unlock()
-	if err := x.updateMapping(sym); err != nil {
-		return err
-	}
-	if err := xtest.FakeInputChecked(x.conn, xproto.KeyPress, x.keycode, 0, xproto.Window(0), 0, 0, 0).Check(); err != nil {
-		return err
+// keycodeRuns splits sorted keycodes into runs of consecutive ones.
+func keycodeRuns(keycodes []xproto.Keycode) [][]xproto.Keycode {
+	var runs [][]xproto.Keycode
+	for i, kc := range keycodes {
+		if i > 0 && kc == keycodes[i-1]+1 {
+			runs[len(runs)-1] = append(runs[len(runs)-1], kc)
+			continue
+		}
+		runs = append(runs, []xproto.Keycode{kc})
 	}
-	if err := xtest.FakeInputChecked(x.conn, xproto.KeyRelease, x.keycode, 0, xproto.Window(0), 0, 0, 0).Check(); err != nil {
-		return err
+	return runs
+}
+
+// batchLength returns how many of runes can be typed with one mapping of
+// size keys.
+func batchLength(runes []rune, size int) int {
+	seen := make(map[rune]struct{}, size)
+	for i, r := range runes {
+		if _, ok := seen[r]; ok || r == '\r' {
+			continue
+		}
+		if len(seen) == size {
+			return i
+		}
+		seen[r] = struct{}{}
 	}
-	x.conn.Sync()
-	return nil
+	return len(runes)
+}
+
+// sync waits for the server to handle every request sent so far.
+func (x *x11Injector) sync() error {
+	_, err := xproto.GetInputFocus(x.conn).Reply()
+	return err
 }
 
 func (x *x11Injector) TypeText(text string) error {
-	for len(text) > 0 {
-		r, size := utf8.DecodeRuneInString(text)
-		if r == utf8.RuneError && size == 1 {
-			return fmt.Errorf("invalid utf-8")
+	if !utf8.ValidString(text) {
+		return fmt.Errorf("invalid utf-8")
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	runes := []rune(text)
+	for len(runes) > 0 {
+		n := batchLength(runes, len(x.pool.slots))
+		keycodes := make([]xproto.Keycode, 0, n)
+		for _, r := range runes[:n] {
+			if r == '\r' {
+				continue
+			}
+			kc, err := x.pool.acquire(runeKeysym(r))
+			if err != nil {
+				return err
+			}
+			keycodes = append(keycodes, kc)
 		}
-		if err := x.typeRune(r); err != nil {
-			return err
+		x.flushMapping()
+		for _, kc := range keycodes {
+			xtest.FakeInput(x.conn, xproto.KeyPress, byte(kc), 0, xproto.Window(0), 0, 0, 0)
+			xtest.FakeInput(x.conn, xproto.KeyRelease, byte(kc), 0, xproto.Window(0), 0, 0, 0)
 		}
-		text = text[size:]
+		runes = runes[n:]
 	}
-	return nil
+	return x.sync()
 }
 
 func (x *x11Injector) Close() error {
 	x.mu.Lock()
 	defer x.mu.Unlock()
 	defer x.conn.Close()
-	_ = xproto.ChangeKeyboardMappingChecked(x.conn, byte(x.width), xproto.Keycode(x.keycode), 1, x.original).Check()
+	// Let clients read the last presses before their symbols go.
+	if wait := remapSettle - time.Since(x.pool.lastUse()); wait > 0 {
+		time.Sleep(wait)
+	}
+	for kc, keysyms := range x.original {
+		_ = xproto.ChangeKeyboardMappingChecked(x.conn, 1, kc, byte(x.width), keysyms).Check()
+	}
 	x.conn.Sync()
 	return nil
 }
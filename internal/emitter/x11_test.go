@@ -0,0 +1,92 @@
+package emitter
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/xgb/xproto"
+	"github.com/BurntSushi/xgb/xtest"
+)
+
+func TestKeycodeRuns(t *testing.T) {
+	runs := keycodeRuns([]xproto.Keycode{93, 94, 95, 97, 120, 121})
+	if len(runs) != 3 || len(runs[0]) != 3 || len(runs[1]) != 1 || len(runs[2]) != 2 || runs[2][0] != 120 {
+		t.Fatalf("unexpected runs %v", runs)
+	}
+	if runs := keycodeRuns(nil); len(runs) != 0 {
+		t.Fatalf("expected no runs, got %v", runs)
+	}
+}
+
+func TestBatchLength(t *testing.T) {
+	cases := []struct {
+		text string
+		size int
+		want int
+	}{
+		{"한글", 8, 2},
+		{"가나다라", 2, 2},
+		{"가가나가다", 2, 4},
+		{"가\r나\r다", 2, 4},
+	}
+	for _, tc := range cases {
+		if got := batchLength([]rune(tc.text), tc.size); got != tc.want {
+			t.Errorf("batchLength(%q, %d) = %d, want %d", tc.text, tc.size, got, tc.want)
+		}
+	}
+}
+
+// The benchmarks type into whatever window has the focus, so they only
+// run against the display named by HANFE_XTEST_DISPLAY, such as an Xvfb:
+//
+//	Xvfb :99 & HANFE_XTEST_DISPLAY=:99 go test -run - -bench X11 ./internal/emitter
+func openBenchInjector(b *testing.B) *x11Injector {
+	b.Helper()
+	display := os.Getenv("HANFE_XTEST_DISPLAY")
+	if display == "" {
+		b.Skip("HANFE_XTEST_DISPLAY not set")
+	}
+	b.Setenv("DISPLAY", display)
+	x, err := newX11Injector()
+	if err != nil {
+		b.Skipf("open X display: %v", err)
+	}
+	b.Cleanup(func() { x.Close() })
+	return x
+}
+
+var benchText = strings.Repeat("천지현황우주홍황일월영측진숙열장", 4)
+
+func BenchmarkX11InjectorBatched(b *testing.B) {
+	x := openBenchInjector(b)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := x.TypeText(benchText); err != nil {
+			b.Fatalf("TypeText: %v", err)
+		}
+	}
+}
+
+// BenchmarkX11InjectorPerRune is the previous design: one keycode,
+// remapped for every character with checked requests and a sync.
+func BenchmarkX11InjectorPerRune(b *testing.B) {
+	x := openBenchInjector(b)
+	kc := x.pool.slots[0].keycode
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for _, r := range benchText {
+			keysyms := keysymRow(x.width, runeKeysym(r))
+			if err := xproto.ChangeKeyboardMappingChecked(x.conn, 1, kc, byte(x.width), keysyms).Check(); err != nil {
+				b.Fatalf("ChangeKeyboardMapping: %v", err)
+			}
+			if err := xtest.FakeInputChecked(x.conn, xproto.KeyPress, byte(kc), 0, xproto.Window(0), 0, 0, 0).Check(); err != nil {
+				b.Fatalf("FakeInput: %v", err)
+			}
+			if err := xtest.FakeInputChecked(x.conn, xproto.KeyRelease, byte(kc), 0, xproto.Window(0), 0, 0, 0).Check(); err != nil {
+				b.Fatalf("FakeInput: %v", err)
+			}
+			x.conn.Sync()
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package emitter
+
+import (
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+const (
+	// remapPoolSize is how many spare keycodes the remap backend uses.
+	remapPoolSize = 8
+	// remapSettle is how long a pressed key stays mapped. Presses through
+	// uinput reach the server on their own schedule, and clients look up
+	// the symbol of a press with a mapping they fetch again after each
+	// MappingNotify, so remapping the keycode sooner could change the
+	// symbol of a press that is still being handled. It is a heuristic,
+	// not a guarantee.
+	remapSettle = 50 * time.Millisecond
+	// evdevOffset is the difference between X and evdev keycodes.
+	evdevOffset = 8
+)
+
+// keyboardMapping is the core keyboard mapping of an X display.
+type keyboardMapping struct {
+	min     xproto.Keycode
+	max     xproto.Keycode
+	width   int
+	keysyms []xproto.Keysym
+}
+
+func getKeyboardMapping(conn *xgb.Conn) (keyboardMapping, error) {
+	setup := xproto.Setup(conn)
+	min, max := setup.MinKeycode, setup.MaxKeycode
+	reply, err := xproto.GetKeyboardMapping(conn, min, byte(max-min+1)).Reply()
+	if err != nil {
+		return keyboardMapping{}, err
+	}
+	width := int(reply.KeysymsPerKeycode)
+	if width <= 0 {
+		return keyboardMapping{}, fmt.Errorf("invalid keysyms width")
+	}
+	return keyboardMapping{min: min, max: max, width: width, keysyms: reply.Keysyms}, nil
+}
+
+// discardEvents reads and drops the events of conn until it is closed.
+// Every mapping change sends a MappingNotify to all clients, and xgb
+// stops reading replies once its event queue is full.
+func discardEvents(conn *xgb.Conn) {
+	for {
+		ev, err := conn.WaitForEvent()
+		if ev == nil && err == nil {
+			return
+		}
+	}
+}
+
+// row returns the keysyms of keycode.
+func (m keyboardMapping) row(keycode xproto.Keycode) []xproto.Keysym {
+	idx := int(keycode-m.min) * m.width
+	return m.keysyms[idx : idx+m.width]
+}
+
+// spare returns the keycodes without any keysym, in ascending order.
+func (m keyboardMapping) spare() []xproto.Keycode {
+	var out []xproto.Keycode
+	for kc := int(m.min); kc <= int(m.max); kc++ {
+		empty := true
+		for _, sym := range m.row(xproto.Keycode(kc)) {
+			if sym != 0 {
+				empty = false
+				break
+			}
+		}
+		if empty {
+			out = append(out, xproto.Keycode(kc))
+		}
+	}
+	return out
+}
+
+// keycodePool lends keycodes mapped to the keysyms being typed. A keysym
+// that is still mapped is reused as is; otherwise the least recently
+// used keycode is remapped, once it has settled.
+type keycodePool struct {
+	slots []poolSlot
+	tick  uint64
+	// settle is how long a used keycode is left alone before it is
+	// remapped.
+	settle time.Duration
+	remap  func(xproto.Keycode, xproto.Keysym) error
+	now    func() time.Time
+	sleep  func(time.Duration)
+}
+
+type poolSlot struct {
+	keycode xproto.Keycode
+	sym     xproto.Keysym
+	// seq orders the slots by last use; used is when that was.
+	seq  uint64
+	used time.Time
+}
+
+func newKeycodePool(keycodes []xproto.Keycode, settle time.Duration, remap func(xproto.Keycode, xproto.Keysym) error) *keycodePool {
+	slots := make([]poolSlot, len(keycodes))
+	for i, kc := range keycodes {
+		slots[i].keycode = kc
+	}
+	return &keycodePool{slots: slots, settle: settle, remap: remap, now: time.Now, sleep: time.Sleep}
+}
+
+// acquire returns a keycode that produces sym and marks it used. The
+// keycodes of the last len(slots) distinct keysyms are never taken back.
+func (p *keycodePool) acquire(sym xproto.Keysym) (xproto.Keycode, error) {
+	p.tick++
+	oldest := 0
+	for i := range p.slots {
+		if p.slots[i].seq != 0 && p.slots[i].sym == sym {
+			p.slots[i].seq = p.tick
+			p.slots[i].used = p.now()
+			return p.slots[i].keycode, nil
+		}
+		if p.slots[i].seq < p.slots[oldest].seq {
+			oldest = i
+		}
+	}
+	slot := &p.slots[oldest]
+	if slot.seq != 0 {
+		if wait := p.settle - p.now().Sub(slot.used); wait > 0 {
+			p.sleep(wait)
+		}
+	}
+	if err := p.remap(slot.keycode, sym); err != nil {
+		return 0, err
+	}
+	slot.sym = sym
+	slot.seq = p.tick
+	slot.used = p.now()
+	return slot.keycode, nil
+}
+
+// lastUse returns when a key of the pool was last used.
+func (p *keycodePool) lastUse() time.Time {
+	var last time.Time
+	for _, slot := range p.slots {
+		if slot.used.After(last) {
+			last = slot.used
+		}
+	}
+	return last
+}
+
+// reserveKeycodes picks up to remapPoolSize unused keycodes from
+// minimum up, or falls back to the highest keycode when none is unused.
+func reserveKeycodes(mapping keyboardMapping, minimum xproto.Keycode) []xproto.Keycode {
+	var keycodes []xproto.Keycode
+	for _, kc := range mapping.spare() {
+		if kc < minimum {
+			continue
+		}
+		keycodes = append(keycodes, kc)
+		if len(keycodes) == remapPoolSize {
+			break
+		}
+	}
+	if len(keycodes) == 0 && mapping.max >= minimum {
+		keycodes = append(keycodes, mapping.max)
+	}
+	return keycodes
+}
+
+// keysymRow is the mapping of a remapped key: sym on both shift levels.
+func keysymRow(width int, sym xproto.Keysym) []xproto.Keysym {
+	keysyms := make([]xproto.Keysym, width)
+	for i := 0; i < len(keysyms) && i < 2; i++ {
+		keysyms[i] = sym
+	}
+	return keysyms
+}
+
+// runeKeysym returns the keysym that types r.
+func runeKeysym(r rune) xproto.Keysym {
+	switch r {
+	case '\n':
+		return keysymReturn
+	case '\t':
+		return keysymTab
+	}
+	return xproto.Keysym(0x01000000 | uint32(r))
+}
+
+// x11Remapper maps spare keycodes to the characters a uinput keyboard
+// types. The server's XKB keymap follows core mapping changes, so every
+// client sees the new symbols.
+type x11Remapper struct {
+	conn     *xgb.Conn
+	width    int
+	original map[xproto.Keycode][]xproto.Keysym
+	pool     *keycodePool
+	mu       sync.Mutex
+}
+
+func newX11Remapper() (*x11Remapper, error) {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return nil, fmt.Errorf("DISPLAY not set")
+	}
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, err
+	}
+	mapping, err := getKeyboardMapping(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// uinput can only press keys that have an evdev code.
+	keycodes := reserveKeycodes(mapping, evdevOffset+1)
+	if len(keycodes) == 0 {
+		conn.Close()
+		return nil, fmt.Errorf("no keycodes to remap")
+	}
+	r := &x11Remapper{conn: conn, width: mapping.width, original: make(map[xproto.Keycode][]xproto.Keysym)}
+	for _, kc := range keycodes {
+		r.original[kc] = append([]xproto.Keysym(nil), mapping.row(kc)...)
+	}
+	r.pool = newKeycodePool(keycodes, remapSettle, r.remap)
+	go discardEvents(conn)
+	return r, nil
+}
+
+// remap binds sym to keycode on both shift levels and waits for the
+// server to apply it, so a key press sent next through the kernel finds
+// the new symbol.
+func (r *x11Remapper) remap(keycode xproto.Keycode, sym xproto.Keysym) error {
+	return xproto.ChangeKeyboardMappingChecked(r.conn, 1, keycode, byte(r.width), keysymRow(r.width, sym)).Check()
+}
+
+// KeyFor returns the evdev code of a key that types ch.
+func (r *x11Remapper) KeyFor(ch rune) (uint16, error) {
+	if ch < 0 {
+		return 0, fmt.Errorf("invalid rune")
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keycode, err := r.pool.acquire(runeKeysym(ch))
+	if err != nil {
+		return 0, err
+	}
+	return uint16(keycode) - evdevOffset, nil
+}
+
+func (r *x11Remapper) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer r.conn.Close()
+	// Let the last presses reach the server before their symbols go.
+	if wait := remapSettle - time.Since(r.pool.lastUse()); wait > 0 {
+		time.Sleep(wait)
+	}
+	for kc, keysyms := range r.original {
+		_ = xproto.ChangeKeyboardMappingChecked(r.conn, 1, kc, byte(r.width), keysyms).Check()
+	}
+	r.conn.Sync()
+	return nil
+}
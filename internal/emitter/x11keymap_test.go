@@ -0,0 +1,71 @@
+package emitter
+
+import (
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+func TestKeyboardMappingSpare(t *testing.T) {
+	mapping := keyboardMapping{min: 8, max: 11, width: 2, keysyms: []xproto.Keysym{
+		0, 0,
+		'a', 'A',
+		0, 0,
+		0, '1',
+	}}
+	spare := mapping.spare()
+	if len(spare) != 2 || spare[0] != 8 || spare[1] != 10 {
+		t.Fatalf("expected keycodes 8 and 10, got %v", spare)
+	}
+	if row := mapping.row(9); row[0] != 'a' || row[1] != 'A' {
+		t.Fatalf("unexpected row for keycode 9: %v", row)
+	}
+}
+
+func TestKeycodePool(t *testing.T) {
+	clock := time.Unix(0, 0)
+	var slept time.Duration
+	var remaps []xproto.Keycode
+	pool := newKeycodePool([]xproto.Keycode{100, 101}, remapSettle, func(kc xproto.Keycode, sym xproto.Keysym) error {
+		remaps = append(remaps, kc)
+		return nil
+	})
+	pool.now = func() time.Time { return clock }
+	pool.sleep = func(d time.Duration) {
+		slept += d
+		clock = clock.Add(d)
+	}
+	acquire := func(sym xproto.Keysym) xproto.Keycode {
+		t.Helper()
+		kc, err := pool.acquire(sym)
+		if err != nil {
+			t.Fatalf("acquire: %v", err)
+		}
+		clock = clock.Add(time.Millisecond)
+		return kc
+	}
+
+	first, second := acquire('가'), acquire('나')
+	if first == second || len(remaps) != 2 {
+		t.Fatalf("expected two keycodes for two characters, got %d and %d (%d remaps)", first, second, len(remaps))
+	}
+	// A character that is still mapped reuses its keycode.
+	if kc := acquire('가'); kc != first || len(remaps) != 2 {
+		t.Fatalf("expected 가 to reuse keycode %d without remapping, got %d", first, kc)
+	}
+	// A new character takes the least recently used keycode, after it
+	// has settled.
+	if kc := acquire('다'); kc != second {
+		t.Fatalf("expected the least recently used keycode %d, got %d", second, kc)
+	}
+	if slept != remapSettle-2*time.Millisecond {
+		t.Fatalf("expected to wait for the keycode to settle, slept %v", slept)
+	}
+	slept = 0
+	clock = clock.Add(time.Second)
+	acquire('라')
+	if slept != 0 {
+		t.Fatalf("expected no wait for a settled keycode, slept %v", slept)
+	}
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/detect"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// autoSwitch remembers the last automatic conversion so it can be undone.
+type autoSwitch struct {
+	from     int
+	keys     []keyStroke
+	boundary uint16
+}
+
+func isWordBoundary(code uint16) bool {
+	switch int(code) {
+	case linux.KeySpace, linux.KeyEnter, linux.KeyTab:
+		return true
+	}
+	return false
+}
+
+// handleAutoKey runs before a key press is recorded. It undoes the last
+// automatic switch when the undo key follows it directly, and classifies
+// the finished word at a word boundary. It reports whether the key was
+// consumed.
+func (e *Engine) handleAutoKey(event *util.InputEvent) (bool, error) {
+	if !isKeyPress(event) || contains(modifierKeys, event.Code) {
+		return false, nil
+	}
+	if e.autoUndo != nil {
+		if e.chordPressed(e.autoUndoChords(), event.Code) {
+			return true, e.undoAutoSwitch()
+		}
+		e.autoUndo = nil
+	}
+	if isWordBoundary(event.Code) {
+		return false, e.autoSwitchWord(event.Code)
+	}
+	return false, nil
+}
+
+func (e *Engine) autoUndoChords() []config.ToggleChord {
+	if len(e.toggle.Auto.Undo) > 0 {
+		return e.toggle.Auto.Undo
+	}
+	return []config.ToggleChord{{Key: uint16(linux.KeyBackspace)}}
+}
+
+// autoSwitchWord converts the word that ends at boundary when it clearly
+// belongs to the other language, and switches to that language's mode.
+func (e *Engine) autoSwitchWord(boundary uint16) error {
+	kind := e.currentModeKind()
+	if len(e.wordKeys) == 0 || (kind != types.ModeLatin && kind != types.ModeHangul) ||
+		e.modifiersActive(alwaysForward) || e.autoExcluded() {
+		return nil
+	}
+	hangulIdx := e.modeOfKind(types.ModeHangul)
+	latinIdx := e.modeOfKind(types.ModeLatin)
+	if hangulIdx < 0 || latinIdx < 0 {
+		return nil
+	}
+	hangulMode := e.modes[hangulIdx]
+	latin, _ := e.renderKeys(e.modes[latinIdx], nil, e.wordKeys)
+	commit, preedit := e.renderKeys(hangulMode, e.newHangulComposer(hangulMode), e.wordKeys)
+
+	var target int
+	switch detect.Classify(latin, commit+preedit, e.english, e.korean) {
+	case detect.Hangul:
+		target = hangulIdx
+	case detect.English:
+		target = latinIdx
+	default:
+		return nil
+	}
+	if target == e.modeIndex {
+		return nil
+	}
+	undo := &autoSwitch{from: e.modeIndex, keys: e.wordKeys, boundary: boundary}
+	if err := e.reconvertTo(target); err != nil {
+		return err
+	}
+	e.autoUndo = undo
+	return nil
+}
+
+// undoAutoSwitch restores the word as typed, in the mode it was typed in,
+// followed by the boundary key.
+func (e *Engine) undoAutoSwitch() error {
+	undo := e.autoUndo
+	e.autoUndo = nil
+	if err := e.eraseRunes(1); err != nil {
+		return err
+	}
+	e.wordKeys = undo.keys
+	if err := e.reconvertTo(undo.from); err != nil {
+		return err
+	}
+	if err := e.commitPreedit(); err != nil {
+		return err
+	}
+	e.wordKeys = nil
+	return e.emitter.TapKey(undo.boundary)
+}
+
+func (e *Engine) autoExcluded() bool {
+	app := e.focusCtx.Class
+	if app == "" {
+		return false
+	}
+	for _, name := range e.toggle.Auto.Exclude {
+		if strings.EqualFold(name, app) {
+			return true
+		}
+	}
+	return false
+}
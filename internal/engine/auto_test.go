@@ -0,0 +1,76 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/focus"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+)
+
+// withAuto turns automatic switching on, starting in defaultMode and
+// excluding the given applications.
+func withAuto(defaultMode string, exclude ...string) func(*testSetup) {
+	return func(s *testSetup) {
+		s.toggle.DefaultMode = defaultMode
+		s.toggle.Auto = config.AutoConfig{Enabled: true, Exclude: exclude}
+	}
+}
+
+func TestEngineAutoSwitchToHangulAndUndo(t *testing.T) {
+	eng, out := newTestEngine(t, withAuto("latin"))
+
+	typeKeys(t, eng, linux.KeyG, linux.KeyK, linux.KeyS, linux.KeyR, linux.KeyM, linux.KeyF)
+	out.buffer = []rune("gksrmf")
+	pressKey(t, eng, linux.KeySpace)
+	if got := out.String(); got != "한글" || eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected the word to switch to Hangul, got %q (mode %v)", got, eng.currentModeKind())
+	}
+
+	// The forwarded space, then Backspace right away undoes the switch.
+	out.buffer = append(out.buffer, ' ')
+	pressKey(t, eng, linux.KeyBackspace)
+	if got := out.String(); got != "gksrmf" || eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected undo to restore the Latin word, got %q (mode %v)", got, eng.currentModeKind())
+	}
+}
+
+func TestEngineAutoSwitchToLatin(t *testing.T) {
+	eng, out := newTestEngine(t, withAuto("dubeolsik"))
+
+	typeKeys(t, eng, linux.KeyH, linux.KeyE, linux.KeyL, linux.KeyL, linux.KeyO)
+	pressKey(t, eng, linux.KeySpace)
+	if got := out.String(); got != "hello" || eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected an English word to switch to Latin, got %q (mode %v)", got, eng.currentModeKind())
+	}
+
+	// Any other key makes the switch final.
+	pressKey(t, eng, linux.KeyA)
+	if eng.autoUndo != nil {
+		t.Fatalf("expected the undo to expire after another key")
+	}
+}
+
+func TestEngineAutoSwitchKeepsAmbiguousWords(t *testing.T) {
+	eng, out := newTestEngine(t, withAuto("dubeolsik"))
+
+	// "the" is both an English word and the syllable 솓.
+	typeKeys(t, eng, linux.KeyT, linux.KeyH, linux.KeyE)
+	pressKey(t, eng, linux.KeySpace)
+	if got := out.String(); got != "솓" || eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected an ambiguous word to stay, got %q (mode %v)", got, eng.currentModeKind())
+	}
+}
+
+func TestEngineAutoSwitchExcludedApplication(t *testing.T) {
+	eng, out := newTestEngine(t, withAuto("latin", "firefox"))
+	eng.setFocus(focus.Context{Window: 1, Class: "Firefox"})
+
+	typeKeys(t, eng, linux.KeyG, linux.KeyK, linux.KeyS, linux.KeyR, linux.KeyM, linux.KeyF)
+	out.buffer = []rune("gksrmf")
+	pressKey(t, eng, linux.KeySpace)
+	if got := out.String(); got != "gksrmf" || eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected no switch in an excluded application, got %q (mode %v)", got, eng.currentModeKind())
+	}
+}
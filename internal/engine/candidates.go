@@ -0,0 +1,95 @@
+package engine
+
+import (
+	"fmt"
+	"strings"
+)
+
+// candidatePageSize is the number of candidates shown, and selectable with
+// the digit keys, at once.
+const candidatePageSize = 5
+
+type candidateList struct {
+	candidates []string
+	index      int
+}
+
+func newCandidateList(candidates []string) *candidateList {
+	if len(candidates) == 0 {
+		return nil
+	}
+	return &candidateList{candidates: candidates}
+}
+
+func (c *candidateList) current() string {
+	return c.candidates[c.index]
+}
+
+func (c *candidateList) page() int {
+	return c.index / candidatePageSize
+}
+
+func (c *candidateList) pageCount() int {
+	return (len(c.candidates) + candidatePageSize - 1) / candidatePageSize
+}
+
+// move shifts the highlighted candidate by step, wrapping around the list.
+func (c *candidateList) move(step int) {
+	count := len(c.candidates)
+	c.index = ((c.index+step)%count + count) % count
+}
+
+// movePage moves the highlight to the first candidate of a neighbouring
+// page. It reports whether the page changed.
+func (c *candidateList) movePage(step int) bool {
+	page := c.page() + step
+	if page < 0 || page >= c.pageCount() {
+		return false
+	}
+	c.index = page * candidatePageSize
+	return true
+}
+
+// pick returns the candidate labelled number (1-based) on the current page.
+func (c *candidateList) pick(number int) (string, bool) {
+	if number < 1 || number > candidatePageSize {
+		return "", false
+	}
+	idx := c.page()*candidatePageSize + number - 1
+	if idx >= len(c.candidates) {
+		return "", false
+	}
+	return c.candidates[idx], true
+}
+
+// choose highlights the candidate labelled number on the current page.
+func (c *candidateList) choose(number int) bool {
+	if _, ok := c.pick(number); !ok {
+		return false
+	}
+	c.index = c.page()*candidatePageSize + number - 1
+	return true
+}
+
+// render formats the current page as "1.你 [2.尼] 3.泥 (1/2)" with the
+// highlighted candidate in brackets and the page indicator only when the
+// list spans several pages.
+func (c *candidateList) render() string {
+	start := c.page() * candidatePageSize
+	end := start + candidatePageSize
+	if end > len(c.candidates) {
+		end = len(c.candidates)
+	}
+	parts := make([]string, 0, end-start+1)
+	for i := start; i < end; i++ {
+		label := fmt.Sprintf("%d.%s", i-start+1, c.candidates[i])
+		if i == c.index {
+			label = "[" + label + "]"
+		}
+		parts = append(parts, label)
+	}
+	if pages := c.pageCount(); pages > 1 {
+		parts = append(parts, fmt.Sprintf("(%d/%d)", c.page()+1, pages))
+	}
+	return strings.Join(parts, " ")
+}
@@ -3,12 +3,18 @@ package engine
 import (
 	"fmt"
 	"strings"
+	"sync"
 	"syscall"
+	"time"
+	"unicode"
 
 	"github.com/gg582/hanfe/internal/backend"
 	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/detect"
 	"github.com/gg582/hanfe/internal/emitter"
+	"github.com/gg582/hanfe/internal/focus"
 	"github.com/gg582/hanfe/internal/hangul"
+	"github.com/gg582/hanfe/internal/kana"
 	"github.com/gg582/hanfe/internal/layout"
 	"github.com/gg582/hanfe/internal/linux"
 	"github.com/gg582/hanfe/internal/types"
@@ -21,20 +27,52 @@ type ModeSpec struct {
 	Kind     types.InputMode
 	Layout   *layout.Layout
 	Database backend.Database
+	Hanja    backend.Database
+	UserDict *backend.UserDictionary
 }
 
 type Engine struct {
 	deviceFD           int
 	modes              []ModeSpec
 	modeIndex          int
-	toggleChords       []config.ToggleChord
+	previousIndex      int
+	selectChords       map[int][]config.ToggleChord
+	tapBindings        []chordBinding
+	tap                tapState
+	swallowedKeys      map[uint16]struct{}
+	writeLED           func(code uint16, on bool) error
+	warn               func(error)
+	defaultIndex       int
+	mu                 sync.Mutex
+	focusErr           error
+	focusCtx           focus.Context
+	focusSeen          bool
+	focusKey           string
+	windowModes        map[string]int
+	nativePreedit      bool
+	rules              []modeRule
+	rule               *modeRule
+	paste              *config.PasteRule
+	toggle             config.ToggleConfig
 	emitter            emitter.Output
 	hangulComposers    map[int]*hangul.HangulComposer
+	romajiComposers    map[int]*kana.RomajiComposer
+	voicingComposers   map[int]*kana.VoicingComposer
 	modifierState      map[uint16]bool
 	forwardedModifiers map[uint16]bool
 	forwardedKeys      map[uint16]struct{}
 	preedit            string
+	preeditShown       string
 	pinyinBuffer       string
+	pinyinCandidates   *candidateList
+	recentHangul       []rune
+	hanja              *hanjaState
+	kanaBuffer         string
+	kanji              *kanjiState
+	wordKeys           []keyStroke
+	english            *detect.Dictionary
+	korean             *detect.Dictionary
+	autoUndo           *autoSwitch
 }
 
 var (
@@ -64,18 +102,26 @@ func NewEngine(deviceFD int, modes []ModeSpec, toggle config.ToggleConfig, emitt
 	eng := &Engine{
 		deviceFD:           deviceFD,
 		modes:              modes,
-		toggleChords:       toggle.Chords,
+		toggle:             toggle,
 		emitter:            emitter,
 		hangulComposers:    make(map[int]*hangul.HangulComposer),
+		romajiComposers:    make(map[int]*kana.RomajiComposer),
+		voicingComposers:   make(map[int]*kana.VoicingComposer),
 		modifierState:      make(map[uint16]bool),
 		forwardedModifiers: make(map[uint16]bool),
 		forwardedKeys:      make(map[uint16]struct{}),
+		swallowedKeys:      make(map[uint16]struct{}),
 	}
 	for _, code := range modifierKeys {
 		eng.modifierState[code] = false
 		eng.forwardedModifiers[code] = false
 	}
-	for _, chord := range toggle.Chords {
+	chords := append(append([]config.ToggleChord(nil), toggle.Chords...), toggle.Reconvert...)
+	chords = append(chords, toggle.Previous...)
+	for _, selected := range toggle.Select {
+		chords = append(chords, selected...)
+	}
+	for _, chord := range append(chords, toggle.Auto.Undo...) {
 		for _, group := range chord.ModifierGroups {
 			for _, code := range group {
 				if _, ok := eng.modifierState[code]; !ok {
@@ -86,30 +132,103 @@ func NewEngine(deviceFD int, modes []ModeSpec, toggle config.ToggleConfig, emitt
 		}
 	}
 	defaultIndex := 0
-	if toggle.DefaultMode != "" {
-		for idx, mode := range modes {
-			if strings.EqualFold(mode.Name, toggle.DefaultMode) {
-				defaultIndex = idx
-				break
+	if idx := modeNamed(modes, toggle.DefaultMode); idx >= 0 {
+		defaultIndex = idx
+	}
+	eng.modeIndex = defaultIndex
+	eng.previousIndex = defaultIndex
+	eng.defaultIndex = defaultIndex
+
+	if len(toggle.Select) > 0 {
+		eng.selectChords = make(map[int][]config.ToggleChord, len(toggle.Select))
+		for name, selected := range toggle.Select {
+			idx := modeNamed(modes, name)
+			if idx < 0 {
+				return nil, fmt.Errorf("select chord for unknown mode %q", name)
+			}
+			eng.selectChords[idx] = selected
+		}
+	}
+	eng.bindTapChords()
+	for _, rule := range toggle.Rules {
+		resolved := modeRule{Rule: rule, mode: -1}
+		if rule.Action != config.RuleBypass {
+			if resolved.mode = modeNamed(modes, rule.Mode); resolved.mode < 0 {
+				return nil, fmt.Errorf("rule %s:%s names unknown mode %q", rule.Field, rule.Pattern, rule.Mode)
+			}
+		}
+		eng.rules = append(eng.rules, resolved)
+	}
+
+	if toggle.Auto.Enabled {
+		eng.english = detect.NewEnglishDictionary()
+		eng.korean = detect.NewKoreanDictionary()
+		if toggle.Auto.Words != "" {
+			if err := eng.english.LoadFile(toggle.Auto.Words); err != nil {
+				return nil, err
 			}
 		}
 	}
-	eng.modeIndex = defaultIndex
 
 	for idx, mode := range modes {
-		if mode.Kind == types.ModeHangul {
-			eng.hangulComposers[idx] = hangul.NewHangulComposer()
+		switch mode.Kind {
+		case types.ModeHangul:
+			if toggle.ModeOptions(mode.Name).Moachigi && (mode.Layout == nil || !mode.Layout.HasTrailing()) {
+				return nil, fmt.Errorf("mode %q enables moachigi, but its layout has no final consonant keys", mode.Name)
+			}
+			eng.hangulComposers[idx] = eng.newHangulComposer(mode)
+		case types.ModeRomaji:
+			eng.romajiComposers[idx] = kana.NewRomajiComposer()
+		case types.ModeKana:
+			eng.voicingComposers[idx] = kana.NewVoicingComposer()
 		}
 	}
 	return eng, nil
 }
 
+// SetWarningHandler passes handler the errors the engine recovers from,
+// such as a failed paste that was typed instead. They are dropped
+// without one.
+func (e *Engine) SetWarningHandler(handler func(error)) {
+	e.warn = handler
+}
+
+func (e *Engine) warning(err error) {
+	if e.warn != nil {
+		e.warn(err)
+	}
+}
+
+// modeNamed returns the index of the mode called name, or -1.
+func modeNamed(modes []ModeSpec, name string) int {
+	if name == "" {
+		return -1
+	}
+	for idx, mode := range modes {
+		if strings.EqualFold(mode.Name, name) {
+			return idx
+		}
+	}
+	return -1
+}
+
 func (e *Engine) Run() error {
 	if err := linux.IoctlSetInt(e.deviceFD, linux.EVIOCGRAB, 1); err != nil {
 		return fmt.Errorf("grab device: %w", err)
 	}
 	defer linux.IoctlSetInt(e.deviceFD, linux.EVIOCGRAB, 0)
 	defer e.emitter.Close()
+	e.mu.Lock()
+	if e.writeLED == nil {
+		e.writeLED = e.writeDeviceLED
+	}
+	e.syncLED()
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.clearLED()
+		e.mu.Unlock()
+	}()
 
 	size := util.InputEventSize()
 	pollFDs := []unix.PollFd{{Fd: int32(e.deviceFD), Events: unix.POLLIN}}
@@ -172,6 +291,37 @@ func waitForReadable(pollFDs []unix.PollFd) error {
 }
 
 func (e *Engine) processEvent(event *util.InputEvent) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.focusErr; err != nil {
+		e.focusErr = nil
+		return err
+	}
+	if e.bypassed() {
+		return e.passThrough(event)
+	}
+	if event.Type != linux.EvKey || len(e.tapBindings) == 0 || e.modeLocked() {
+		return e.dispatchEvent(event)
+	}
+	action, replay, consumed := e.trackTap(event)
+	if replay != 0 {
+		press := util.InputEvent{Time: event.Time, Type: linux.EvKey, Code: replay, Value: 1}
+		if err := e.dispatchEvent(&press); err != nil {
+			return err
+		}
+	}
+	if !consumed {
+		if err := e.dispatchEvent(event); err != nil {
+			return err
+		}
+	}
+	if action != nil {
+		return action()
+	}
+	return nil
+}
+
+func (e *Engine) dispatchEvent(event *util.InputEvent) error {
 	if event.Type != linux.EvKey {
 		if e.currentModeKind() == types.ModeLatin {
 			return e.forwardKeyEvent(event)
@@ -179,13 +329,36 @@ func (e *Engine) processEvent(event *util.InputEvent) error {
 		return nil
 	}
 
-	if e.shouldToggle(event) {
-		if isKeyPress(event) {
-			return e.toggleMode()
+	if _, ok := e.swallowedKeys[event.Code]; ok && event.Value != 1 {
+		if isKeyRelease(event) {
+			delete(e.swallowedKeys, event.Code)
 		}
 		return nil
 	}
 
+	if !e.modeLocked() {
+		if e.shouldToggle(event) {
+			e.swallowKey(event.Code)
+			return e.toggleMode()
+		}
+
+		if target, ok := e.selectedMode(event); ok {
+			e.swallowKey(event.Code)
+			return e.selectMode(target)
+		}
+
+		if e.shouldReconvert(event) {
+			e.swallowKey(event.Code)
+			return e.reconvert()
+		}
+		if e.english != nil {
+			if handled, err := e.handleAutoKey(event); handled || err != nil {
+				return err
+			}
+		}
+	}
+	e.noteKeystroke(event)
+
 	code := event.Code
 	if contains(modifierKeys, code) {
 		return e.handleModifier(event)
@@ -195,6 +368,31 @@ func (e *Engine) processEvent(event *util.InputEvent) error {
 		return e.forwardKeyEvent(event)
 	}
 
+	if e.hanja != nil && isKeyPress(event) {
+		handled, err := e.handleHanjaSelection(event)
+		if handled || err != nil {
+			return err
+		}
+	}
+
+	if e.kanji != nil && isKeyPress(event) {
+		handled, err := e.handleKanjiSelection(event)
+		if handled || err != nil {
+			return err
+		}
+	}
+
+	if e.kanaConversionEnabled() && isKeyPress(event) {
+		handled, err := e.handleKanaBufferKey(event)
+		if handled || err != nil {
+			return err
+		}
+	}
+
+	if code == uint16(linux.KeyHanja) && e.currentModeKind() == types.ModeHangul {
+		return e.handleHanjaKey(event)
+	}
+
 	if code == uint16(linux.KeyBackspace) {
 		return e.handleBackspace(event)
 	}
@@ -233,7 +431,7 @@ func (e *Engine) handleModifier(event *util.InputEvent) error {
 
 func (e *Engine) handleBackspace(event *util.InputEvent) error {
 	switch e.currentModeKind() {
-	case types.ModeLatin, types.ModeKana:
+	case types.ModeLatin:
 		return e.forwardKeyEvent(event)
 	case types.ModeDatabase:
 		return e.handleDatabaseBackspace(event)
@@ -248,10 +446,35 @@ func (e *Engine) handleBackspace(event *util.InputEvent) error {
 		if newPreedit, ok := composer.Backspace(); ok {
 			return e.replacePreedit(newPreedit)
 		}
+		if composer.BackspacePolicy() == hangul.BackspaceReopen {
+			if reopened, err := e.reopenHangul(composer); reopened || err != nil {
+				return err
+			}
+		}
+	}
+	if composer := e.currentRomajiComposer(); composer != nil {
+		if newPreedit, ok := composer.Backspace(); ok {
+			return e.replacePreedit(e.kanaBuffer + newPreedit)
+		}
+	}
+	if composer := e.currentVoicingComposer(); composer != nil {
+		if newPreedit, ok := composer.Backspace(); ok {
+			return e.replacePreedit(e.kanaBuffer + newPreedit)
+		}
+	}
+	if e.kanaBuffer != "" {
+		runes := []rune(e.kanaBuffer)
+		e.kanaBuffer = string(runes[:len(runes)-1])
+		return e.replacePreedit(e.kanaBuffer)
 	}
 	if err := e.commitPreedit(); err != nil {
 		return err
 	}
+	if e.currentModeKind() == types.ModeHangul {
+		// The application deletes a whole committed syllable, whose keys
+		// the history cannot tell apart.
+		e.wordKeys = nil
+	}
 	return e.forwardKeyEvent(event)
 }
 
@@ -264,8 +487,11 @@ func (e *Engine) handleKeyRelease(event *util.InputEvent) error {
 
 func (e *Engine) handleKeyPress(event *util.InputEvent) error {
 	mode := e.currentMode()
-	if mode.Kind == types.ModeDatabase {
+	switch mode.Kind {
+	case types.ModeDatabase:
 		return e.handleDatabaseKeyPress(event)
+	case types.ModeRomaji:
+		return e.handleRomajiKeyPress(event)
 	}
 
 	if e.modifiersActive(alwaysForward) {
@@ -313,7 +539,21 @@ func (e *Engine) handleKeyPress(event *util.InputEvent) error {
 				return err
 			}
 		}
+		if composer := e.currentVoicingComposer(); composer != nil {
+			result := composer.Feed(symbol.Text)
+			return e.applyComposition(result.Commit, result.Preedit)
+		}
 		return e.sendText(symbol.Text)
+	case layout.SymbolKanaMark:
+		composer := e.currentVoicingComposer()
+		if composer == nil {
+			if err := e.commitPreedit(); err != nil {
+				return err
+			}
+			return e.sendText(symbol.Text)
+		}
+		result := composer.Mark([]rune(symbol.Text)[0])
+		return e.applyComposition(result.Commit, result.Preedit)
 	case layout.SymbolJamo:
 		composer := e.currentComposer()
 		result := composer.Feed(symbol.Jamo, symbol.Role)
@@ -321,6 +561,7 @@ func (e *Engine) handleKeyPress(event *util.InputEvent) error {
 			if err := e.commitText(result.Commit); err != nil {
 				return err
 			}
+			e.noteHangulCommit(result.Commit)
 		}
 		if result.Preedit != e.preedit {
 			if err := e.replacePreedit(result.Preedit); err != nil {
@@ -339,6 +580,7 @@ func (e *Engine) forwardKeyEvent(event *util.InputEvent) error {
 	}
 	if isKeyPress(event) {
 		e.forwardedKeys[event.Code] = struct{}{}
+		e.recentHangul = nil
 	} else if isKeyRelease(event) {
 		delete(e.forwardedKeys, event.Code)
 	}
@@ -378,9 +620,22 @@ func (e *Engine) shouldToggle(event *util.InputEvent) bool {
 	if !isKeyPress(event) {
 		return false
 	}
-	code := event.Code
-	for _, chord := range e.toggleChords {
-		if chord.Key != code {
+	return e.chordPressed(e.toggle.Chords, event.Code)
+}
+
+// swallowKey drops the repeats and release of a non-modifier key whose
+// press fired a chord, so a key such as Caps Lock never reaches the
+// application and holding it does not fire again. Modifier releases still
+// go through handleModifier.
+func (e *Engine) swallowKey(code uint16) {
+	if !contains(modifierKeys, code) {
+		e.swallowedKeys[code] = struct{}{}
+	}
+}
+
+func (e *Engine) chordPressed(chords []config.ToggleChord, code uint16) bool {
+	for _, chord := range chords {
+		if chord.Key != code || chord.Trigger != config.TriggerPress {
 			continue
 		}
 		if len(chord.ModifierGroups) == 0 || e.modifierGroupsActive(chord.ModifierGroups) {
@@ -390,6 +645,22 @@ func (e *Engine) shouldToggle(event *util.InputEvent) bool {
 	return false
 }
 
+// selectedMode reports the mode a select or previous chord asks for.
+func (e *Engine) selectedMode(event *util.InputEvent) (int, bool) {
+	if !isKeyPress(event) {
+		return 0, false
+	}
+	if e.chordPressed(e.toggle.Previous, event.Code) {
+		return e.previousIndex, true
+	}
+	for idx, chords := range e.selectChords {
+		if e.chordPressed(chords, event.Code) {
+			return idx, true
+		}
+	}
+	return 0, false
+}
+
 func (e *Engine) currentMode() ModeSpec {
 	return e.modes[e.modeIndex]
 }
@@ -401,12 +672,45 @@ func (e *Engine) currentModeKind() types.InputMode {
 func (e *Engine) currentComposer() *hangul.HangulComposer {
 	composer, ok := e.hangulComposers[e.modeIndex]
 	if !ok || composer == nil {
-		composer = hangul.NewHangulComposer()
+		composer = e.newHangulComposer(e.currentMode())
 		e.hangulComposers[e.modeIndex] = composer
 	}
 	return composer
 }
 
+// reopenHangul moves the last committed syllable back into the empty
+// composer and removes one jamo from it, so Backspace keeps editing the
+// word instead of deleting whole syllables. It only applies while that
+// syllable is still the last thing written; anything else committed
+// after it clears recentHangul.
+func (e *Engine) reopenHangul(composer *hangul.HangulComposer) (bool, error) {
+	if len(e.recentHangul) == 0 {
+		return false, nil
+	}
+	keep := len(e.recentHangul) - 1
+	last := string(e.recentHangul[keep:])
+	if !composer.Reopen(last) {
+		return false, nil
+	}
+	if err := e.eraseCommitted(last); err != nil {
+		return true, err
+	}
+	e.recentHangul = e.recentHangul[:keep]
+	newPreedit, _ := composer.Backspace()
+	return true, e.replacePreedit(newPreedit)
+}
+
+// newHangulComposer creates a composer configured by the mode's
+// [mode.<name>] section.
+func (e *Engine) newHangulComposer(mode ModeSpec) *hangul.HangulComposer {
+	composer := hangul.NewHangulComposer()
+	options := e.toggle.ModeOptions(mode.Name)
+	composer.SetMoachigi(options.Moachigi)
+	composer.SetOldHangul(mode.Layout != nil && mode.Layout.OldHangul())
+	composer.SetBackspacePolicy(options.Backspace)
+	return composer
+}
+
 func (e *Engine) currentComposerIfHangul() *hangul.HangulComposer {
 	if e.currentModeKind() != types.ModeHangul {
 		return nil
@@ -464,11 +768,36 @@ func (e *Engine) toggleMode() error {
 	if len(e.modes) == 0 {
 		return nil
 	}
-	e.modeIndex = (e.modeIndex + 1) % len(e.modes)
-	e.pinyinBuffer = ""
+	e.setMode((e.modeIndex + 1) % len(e.modes))
+	return e.replacePreedit("")
+}
+
+// selectMode commits the preedit and switches straight to target.
+func (e *Engine) selectMode(target int) error {
+	if target == e.modeIndex || target < 0 || target >= len(e.modes) {
+		return nil
+	}
+	if err := e.commitPreedit(); err != nil {
+		return err
+	}
+	e.setMode(target)
 	return e.replacePreedit("")
 }
 
+// setMode makes target the current mode and remembers the one it replaces
+// for the previous-mode chord. The keystroke history starts over.
+func (e *Engine) setMode(target int) {
+	if target != e.modeIndex {
+		e.previousIndex = e.modeIndex
+	}
+	e.modeIndex = target
+	e.pinyinBuffer = ""
+	e.pinyinCandidates = nil
+	e.recentHangul = nil
+	e.wordKeys = nil
+	e.syncLED()
+}
+
 func (e *Engine) commitText(text string) error {
 	if text == "" {
 		return nil
@@ -483,6 +812,9 @@ func (e *Engine) commitPreedit() error {
 	mode := e.currentMode()
 	switch mode.Kind {
 	case types.ModeHangul:
+		if e.hanja != nil {
+			return e.commitHanja(false)
+		}
 		composer := e.currentComposer()
 		commit := composer.Flush()
 		if commit == "" && e.preedit == "" {
@@ -495,10 +827,24 @@ func (e *Engine) commitPreedit() error {
 			if err := e.sendText(commit); err != nil {
 				return err
 			}
+			e.noteHangulCommit(commit)
 		}
 		return nil
 	case types.ModeDatabase:
-		return e.commitPinyinBuffer()
+		return e.commitPinyinBuffer(false)
+	case types.ModeRomaji, types.ModeKana:
+		if e.kanji != nil {
+			return e.commitKanji(false)
+		}
+		commit := e.kanaBuffer + e.flushKanaComposer()
+		e.kanaBuffer = ""
+		if commit == "" && e.preedit == "" {
+			return nil
+		}
+		if err := e.replacePreedit(""); err != nil {
+			return err
+		}
+		return e.sendText(commit)
 	default:
 		if e.preedit == "" {
 			return nil
@@ -519,31 +865,53 @@ func (e *Engine) handleDatabaseKeyPress(event *util.InputEvent) error {
 	}
 
 	code := event.Code
-	if code >= uint16(linux.KeyA) && code <= uint16(linux.KeyZ) {
-		ch := rune('a' + int(code-uint16(linux.KeyA)))
-		e.pinyinBuffer += string(ch)
-		return e.replacePreedit(e.pinyinBuffer)
+	if layout.IsLetterKey(code) {
+		ch, _ := layout.QwertyRune(code, false)
+		return e.updatePinyinBuffer(e.pinyinBuffer + string(ch))
 	}
 
-	if code >= uint16(linux.Key1) && code <= uint16(linux.Key5) {
-		ch := rune('1' + int(code-uint16(linux.Key1)))
-		e.pinyinBuffer += string(ch)
-		return e.replacePreedit(e.pinyinBuffer)
+	if e.pinyinBuffer == "" {
+		if err := e.ensureShiftForwarded(); err != nil {
+			return err
+		}
+		return e.forwardKeyEvent(event)
 	}
 
-	if code == uint16(linux.KeyApostrophe) {
-		e.pinyinBuffer += "'"
-		return e.replacePreedit(e.pinyinBuffer)
+	// While candidates are listed the digit keys select them; otherwise
+	// 1-5 are kept in the buffer as tone numbers.
+	if code >= uint16(linux.Key1) && code <= uint16(linux.Key9) {
+		number := int(code-uint16(linux.Key1)) + 1
+		if e.pinyinCandidates != nil {
+			if candidate, ok := e.pinyinCandidates.pick(number); ok {
+				e.learnCandidate(e.pinyinBuffer, candidate)
+				return e.commitPinyinCandidate(candidate)
+			}
+			return nil
+		}
+		if number <= 5 {
+			return e.updatePinyinBuffer(e.pinyinBuffer + string(rune('0'+number)))
+		}
 	}
 
 	switch code {
-	case uint16(linux.KeySpace), uint16(linux.KeyEnter), uint16(linux.KeyTab):
-		if err := e.commitPinyinBuffer(); err != nil {
-			return err
-		}
-		return e.forwardKeyEvent(event)
+	case uint16(linux.KeyApostrophe):
+		return e.updatePinyinBuffer(e.pinyinBuffer + "'")
+	case uint16(linux.KeySpace):
+		return e.commitPinyinBuffer(true)
+	case uint16(linux.KeyEnter):
+		return e.commitPinyinCandidate(e.pinyinBuffer)
+	case uint16(linux.KeyEsc):
+		return e.updatePinyinBuffer("")
+	case uint16(linux.KeyTab), uint16(linux.KeyDown), uint16(linux.KeyRight):
+		return e.movePinyinHighlight(1)
+	case uint16(linux.KeyUp), uint16(linux.KeyLeft):
+		return e.movePinyinHighlight(-1)
+	case uint16(linux.KeyPageDown), uint16(linux.KeyEqual):
+		return e.movePinyinPage(1)
+	case uint16(linux.KeyPageUp), uint16(linux.KeyMinus):
+		return e.movePinyinPage(-1)
 	default:
-		if err := e.commitPinyinBuffer(); err != nil {
+		if err := e.commitPinyinBuffer(false); err != nil {
 			return err
 		}
 		if err := e.ensureShiftForwarded(); err != nil {
@@ -555,47 +923,124 @@ func (e *Engine) handleDatabaseKeyPress(event *util.InputEvent) error {
 
 func (e *Engine) handleDatabaseBackspace(event *util.InputEvent) error {
 	if isKeyRelease(event) {
+		if _, ok := e.forwardedKeys[event.Code]; ok {
+			return e.forwardKeyEvent(event)
+		}
 		return nil
 	}
 	if e.pinyinBuffer == "" {
 		return e.forwardKeyEvent(event)
 	}
 	runes := []rune(e.pinyinBuffer)
-	if len(runes) == 0 {
-		return e.replacePreedit("")
+	return e.updatePinyinBuffer(string(runes[:len(runes)-1]))
+}
+
+// updatePinyinBuffer replaces the raw key buffer, looks up its candidates
+// and redraws the preedit.
+func (e *Engine) updatePinyinBuffer(buffer string) error {
+	e.pinyinBuffer = buffer
+	e.pinyinCandidates = nil
+	mode := e.currentMode()
+	if buffer != "" && mode.Database.Available() {
+		e.pinyinCandidates = newCandidateList(mode.UserDict.Rank(buffer, mode.Database.Search(buffer)))
 	}
-	e.pinyinBuffer = string(runes[:len(runes)-1])
-	return e.replacePreedit(e.pinyinBuffer)
+	return e.replacePreedit(e.renderPinyin())
 }
 
-func (e *Engine) commitPinyinBuffer() error {
+func (e *Engine) renderPinyin() string {
+	if e.pinyinCandidates == nil {
+		return e.pinyinBuffer
+	}
+	return e.pinyinBuffer + " " + e.pinyinCandidates.render()
+}
+
+func (e *Engine) movePinyinHighlight(step int) error {
+	if e.pinyinCandidates == nil {
+		return nil
+	}
+	e.pinyinCandidates.move(step)
+	return e.replacePreedit(e.renderPinyin())
+}
+
+func (e *Engine) movePinyinPage(step int) error {
+	if e.pinyinCandidates == nil || !e.pinyinCandidates.movePage(step) {
+		return nil
+	}
+	return e.replacePreedit(e.renderPinyin())
+}
+
+// commitPinyinBuffer commits the highlighted candidate, or the raw buffer
+// when the database has no entry for it. With learn, the user chose the
+// candidate and it is recorded in the user dictionary.
+func (e *Engine) commitPinyinBuffer(learn bool) error {
 	if e.pinyinBuffer == "" {
 		if e.preedit != "" {
 			return e.replacePreedit("")
 		}
 		return nil
 	}
-	mode := e.currentMode()
 	text := e.pinyinBuffer
-	if mode.Database.Available() {
-		if candidate, ok := mode.Database.Lookup(text); ok {
-			text = candidate
+	if e.pinyinCandidates != nil {
+		text = e.pinyinCandidates.current()
+		if learn {
+			e.learnCandidate(e.pinyinBuffer, text)
 		}
 	}
+	return e.commitPinyinCandidate(text)
+}
+
+// userDictSaveDelay lets a burst of selections be saved at once.
+const userDictSaveDelay = 2 * time.Second
+
+// learnCandidate records a candidate the user chose in the user
+// dictionary, which is saved shortly after the last change.
+func (e *Engine) learnCandidate(key, candidate string) {
+	dict := e.currentMode().UserDict
+	if dict == nil {
+		return
+	}
+	dict.Record(key, candidate)
+	dict.SaveLater(userDictSaveDelay, e.warning)
+}
+
+func (e *Engine) commitPinyinCandidate(text string) error {
 	if err := e.replacePreedit(""); err != nil {
 		return err
 	}
-	if err := e.sendText(text); err != nil {
-		return err
-	}
 	e.pinyinBuffer = ""
-	return nil
+	e.pinyinCandidates = nil
+	return e.sendText(text)
 }
 
 func (e *Engine) replacePreedit(newText string) error {
+	native, _ := e.emitter.(emitter.PreeditOutput)
+	useNative := native != nil && native.NativePreedit()
+	if e.nativePreedit && !useNative {
+		// The text field that showed the preedit is gone, and the
+		// preedit with it.
+		e.preedit = ""
+		e.preeditShown = ""
+		e.nativePreedit = false
+	}
 	if newText == e.preedit {
 		return nil
 	}
+	if useNative {
+		if !e.nativePreedit && e.preeditShown != "" {
+			// Typed before the text field became active; erase it.
+			if err := e.eraseRunes(countRunes(e.preeditShown)); err != nil {
+				return err
+			}
+		}
+		shown := e.outputText(newText)
+		if err := native.SetPreedit(shown); err != nil {
+			return err
+		}
+		e.preedit = newText
+		e.preeditShown = shown
+		e.nativePreedit = newText != ""
+		return nil
+	}
 	if !e.emitter.SupportsPreedit() {
 		e.preedit = newText
 		return nil
@@ -604,22 +1049,23 @@ func (e *Engine) replacePreedit(newText string) error {
 	if err != nil {
 		return err
 	}
-	if e.preedit != "" {
-		count := countRunes(e.preedit)
-		if count > 0 {
-			if err := e.emitter.SendBackspace(count); err != nil {
-				e.restoreForwardedModifiers(suspended)
-				return err
-			}
+	// The preedit is erased as it was drawn; the mode, and with it the
+	// normalization, may have changed since.
+	if count := countRunes(e.preeditShown); count > 0 {
+		if err := e.emitter.SendBackspace(count); err != nil {
+			e.restoreForwardedModifiers(suspended)
+			return err
 		}
 	}
-	if newText != "" {
-		if err := e.emitter.SendText(newText); err != nil {
+	shown := e.outputText(newText)
+	if shown != "" {
+		if err := e.emitter.SendText(shown); err != nil {
 			e.restoreForwardedModifiers(suspended)
 			return err
 		}
 	}
 	e.preedit = newText
+	e.preeditShown = shown
 	e.restoreForwardedModifiers(suspended)
 	return nil
 }
@@ -628,15 +1074,58 @@ func (e *Engine) sendText(text string) error {
 	if text == "" {
 		return nil
 	}
+	if !isHangulText(text) {
+		// Symbols and other text end the word that Hanja lookups and
+		// reopening reach back into.
+		e.recentHangul = nil
+	}
 	suspended, err := e.suspendForwardedModifiers()
 	if err != nil {
 		return err
 	}
-	err = e.emitter.SendText(text)
+	err = e.writeText(e.outputText(text))
 	e.restoreForwardedModifiers(suspended)
 	return err
 }
 
+// writeText types text, or pastes it when the focused window has a
+// [paste] entry, the commit is long enough and the emitter can paste. A
+// failed paste is passed to the warning handler and the text typed
+// instead.
+func (e *Engine) writeText(text string) error {
+	if e.paste != nil {
+		threshold := e.toggle.Paste.Threshold
+		if threshold <= 0 {
+			threshold = config.DefaultPasteThreshold
+		}
+		if paster, ok := e.emitter.(emitter.PasteOutput); ok && countRunes(text) >= threshold {
+			err := paster.PasteText(text, e.paste.ShiftInsert)
+			if err == nil {
+				return nil
+			}
+			e.warning(fmt.Errorf("paste failed, typing instead: %w", err))
+		}
+	}
+	return e.emitter.SendText(text)
+}
+
+// outputText applies the current mode's output normalization. Everything
+// the engine writes, preedit included, goes through it; the drawn preedit
+// is kept in preeditShown so that it is erased with as many backspaces as
+// it took.
+func (e *Engine) outputText(text string) string {
+	return hangul.Normalize(text, e.toggle.ModeOptions(e.currentMode().Name).Normalization)
+}
+
+func isHangulText(s string) bool {
+	for _, r := range s {
+		if !unicode.Is(unicode.Hangul, r) {
+			return false
+		}
+	}
+	return true
+}
+
 func countRunes(s string) int {
 	count := 0
 	for range s {
@@ -1,9 +1,14 @@
 package engine
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 
+	"github.com/gg582/hanfe/internal/backend"
 	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/emitter"
+	"github.com/gg582/hanfe/internal/hangul"
 	"github.com/gg582/hanfe/internal/layout"
 	"github.com/gg582/hanfe/internal/linux"
 	"github.com/gg582/hanfe/internal/types"
@@ -15,11 +20,15 @@ type fakeEmitter struct {
 	supportsPreedit bool
 	texts           []string
 	backspaces      []int
+	forwarded       []util.InputEvent
 }
 
 func (f *fakeEmitter) Close() error { return nil }
 
-func (f *fakeEmitter) ForwardEvent(ev *util.InputEvent) error { return nil }
+func (f *fakeEmitter) ForwardEvent(ev *util.InputEvent) error {
+	f.forwarded = append(f.forwarded, *ev)
+	return nil
+}
 
 func (f *fakeEmitter) SendKeyState(code uint16, pressed bool) error { return nil }
 
@@ -51,27 +60,63 @@ func (f *fakeEmitter) String() string { return string(f.buffer) }
 
 func (f *fakeEmitter) SupportsPreedit() bool { return f.supportsPreedit }
 
-func newTestEngine(t *testing.T) (*Engine, *fakeEmitter) {
+// testSetup is what newTestEngine builds an engine from: a dubeolsik and a
+// Latin mode writing to a fakeEmitter, unless options change it.
+type testSetup struct {
+	modes  []ModeSpec
+	toggle config.ToggleConfig
+	out    emitter.Output
+}
+
+func newTestEngine(t *testing.T, options ...func(*testSetup)) (*Engine, *fakeEmitter) {
 	t.Helper()
 
-	keyLayout, err := layout.Load("dubeolsik")
-	if err != nil {
-		t.Fatalf("load layout: %v", err)
-	}
-	emitter := &fakeEmitter{supportsPreedit: true}
-	layoutCopy := keyLayout
+	out := &fakeEmitter{supportsPreedit: true}
 	toggle := config.DefaultToggleConfig()
 	toggle.ModeCycle = []string{"dubeolsik", "latin"}
 	toggle.DefaultMode = "dubeolsik"
-	modes := []ModeSpec{
-		{Name: "dubeolsik", Kind: types.ModeHangul, Layout: &layoutCopy},
-		{Name: "latin", Kind: types.ModeLatin},
+	setup := testSetup{
+		modes: []ModeSpec{
+			layoutMode(t, "dubeolsik", types.ModeHangul),
+			{Name: "latin", Kind: types.ModeLatin},
+		},
+		toggle: toggle,
+		out:    out,
+	}
+	for _, option := range options {
+		option(&setup)
 	}
-	eng, err := NewEngine(0, modes, toggle, emitter)
+	eng, err := NewEngine(0, setup.modes, setup.toggle, setup.out)
 	if err != nil {
 		t.Fatalf("new engine: %v", err)
 	}
-	return eng, emitter
+	return eng, out
+}
+
+// layoutMode returns a mode of kind using the named engine layout.
+func layoutMode(t *testing.T, name string, kind types.InputMode) ModeSpec {
+	t.Helper()
+	keyLayout, err := layout.Load(name)
+	if err != nil {
+		t.Fatalf("load layout: %v", err)
+	}
+	return ModeSpec{Name: name, Kind: kind, Layout: &keyLayout}
+}
+
+// withModes replaces the default modes.
+func withModes(modes ...ModeSpec) func(*testSetup) {
+	return func(s *testSetup) { s.modes = modes }
+}
+
+// withToggle adjusts the toggle configuration.
+func withToggle(adjust func(*config.ToggleConfig)) func(*testSetup) {
+	return func(s *testSetup) { adjust(&s.toggle) }
+}
+
+// withEmitter sends the engine's output to out instead of the returned
+// fakeEmitter.
+func withEmitter(out emitter.Output) func(*testSetup) {
+	return func(s *testSetup) { s.out = out }
 }
 
 func pressKey(t *testing.T, eng *Engine, code uint16) {
@@ -158,3 +203,551 @@ func TestEngineSkipsPreeditWhenUnsupported(t *testing.T) {
 		t.Fatalf("expected single committed text '난', got %v", out.texts)
 	}
 }
+
+// withHanja gives the Hangul mode a small Hanja dictionary.
+func withHanja(s *testSetup) {
+	s.modes[0].Hanja = backend.NewDatabase(map[string][]string{
+		"한자": {"漢字", "韓字"},
+		"자":  {"字", "子"},
+	})
+}
+
+func TestEngineHanjaConvertsCommittedAndPreeditSyllables(t *testing.T) {
+	eng, out := newTestEngine(t, withHanja)
+
+	for _, code := range []int{linux.KeyG, linux.KeyK, linux.KeyS, linux.KeyW, linux.KeyK} {
+		pressKey(t, eng, uint16(code))
+	}
+	if got := out.String(); got != "한자" {
+		t.Fatalf("expected '한자' before conversion, got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyHanja))
+	if got := out.String(); got != "漢字" {
+		t.Fatalf("expected first candidate to replace both syllables, got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyHanja))
+	if got := out.String(); got != "韓字" {
+		t.Fatalf("expected Hanja key to cycle to the next candidate, got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeySpace))
+	if got := out.String(); got != "韓字" {
+		t.Fatalf("expected space to commit the candidate without inserting a space, got %q", got)
+	}
+	if eng.preedit != "" || eng.hanja != nil {
+		t.Fatalf("expected conversion state to be cleared, preedit=%q", eng.preedit)
+	}
+}
+
+func TestEngineHanjaEscapeRestoresHangul(t *testing.T) {
+	eng, out := newTestEngine(t, withHanja)
+
+	pressKey(t, eng, uint16(linux.KeyW))
+	pressKey(t, eng, uint16(linux.KeyK))
+	pressKey(t, eng, uint16(linux.KeyHanja))
+	if got := out.String(); got != "字" {
+		t.Fatalf("expected preedit syllable to convert to '字', got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyEsc))
+	if got := out.String(); got != "자" {
+		t.Fatalf("expected escape to restore the Hangul source, got %q", got)
+	}
+	if eng.hanja != nil {
+		t.Fatalf("expected conversion state to be cleared after escape")
+	}
+}
+
+func TestEngineHanjaStopsAtSymbols(t *testing.T) {
+	eng, out := newTestEngine(t,
+		withModes(layoutMode(t, "sebeolsik-final", types.ModeHangul)),
+		func(s *testSetup) {
+			s.modes[0].Hanja = backend.NewDatabase(map[string][]string{"한": {"韓"}})
+		},
+	)
+
+	// 한 followed by the 3-91 ")" key.
+	typeKeys(t, eng, linux.KeyM, linux.KeyF, linux.KeyS, linux.KeyMinus)
+	pressKey(t, eng, linux.KeyHanja)
+	if got := out.String(); got != "한)" || eng.hanja != nil {
+		t.Fatalf("expected the symbol to end the lookup word, got %q", got)
+	}
+}
+
+// withPinyin replaces the default modes with a pinyin database mode.
+func withPinyin(s *testSetup) {
+	db := backend.NewDatabase(map[string][]string{
+		"ni": {"你", "尼", "泥", "逆", "倪", "拟", "妮"},
+	})
+	s.modes = []ModeSpec{
+		{Name: "pinyin", Kind: types.ModeDatabase, Database: db},
+		{Name: "latin", Kind: types.ModeLatin},
+	}
+	s.toggle.DefaultMode = "pinyin"
+}
+
+func TestEnginePinyinShowsNumberedCandidates(t *testing.T) {
+	eng, out := newTestEngine(t, withPinyin)
+
+	pressKey(t, eng, uint16(linux.KeyN))
+	if got := out.String(); got != "n [1.你] 2.尼 3.泥 4.逆 5.倪 (1/2)" {
+		t.Fatalf("expected partial key to preview candidates, got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyI))
+	want := "ni [1.你] 2.尼 3.泥 4.逆 5.倪 (1/2)"
+	if got := out.String(); got != want {
+		t.Fatalf("expected candidate list %q, got %q", want, got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyPageDown))
+	want = "ni [1.拟] 2.妮 (2/2)"
+	if got := out.String(); got != want {
+		t.Fatalf("expected second page %q, got %q", want, got)
+	}
+
+	pressKey(t, eng, uint16(linux.Key2))
+	if got := out.String(); got != "妮" {
+		t.Fatalf("expected digit to commit the second candidate on the page, got %q", got)
+	}
+	if eng.pinyinBuffer != "" || eng.preedit != "" {
+		t.Fatalf("expected buffer to be cleared after selection")
+	}
+}
+
+func TestEnginePinyinSpaceCommitsHighlightedCandidate(t *testing.T) {
+	eng, out := newTestEngine(t, withPinyin)
+
+	pressKey(t, eng, uint16(linux.KeyN))
+	pressKey(t, eng, uint16(linux.KeyI))
+	pressKey(t, eng, uint16(linux.KeyTab))
+	pressKey(t, eng, uint16(linux.KeySpace))
+	if got := out.String(); got != "尼" {
+		t.Fatalf("expected space to commit the highlighted candidate, got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyN))
+	pressKey(t, eng, uint16(linux.KeyI))
+	pressKey(t, eng, uint16(linux.KeyEnter))
+	if got := out.String(); got != "尼ni" {
+		t.Fatalf("expected enter to commit the raw buffer, got %q", got)
+	}
+}
+
+func TestEnginePinyinLearnsSelections(t *testing.T) {
+	eng, out := newTestEngine(t, withPinyin)
+	dict, err := backend.LoadUserDictionary(filepath.Join(t.TempDir(), "userdict.json"))
+	if err != nil {
+		t.Fatalf("load user dictionary: %v", err)
+	}
+	t.Cleanup(func() { dict.Close() })
+	eng.modes[0].UserDict = dict
+
+	pressKey(t, eng, uint16(linux.KeyN))
+	pressKey(t, eng, uint16(linux.KeyI))
+	pressKey(t, eng, uint16(linux.Key3))
+	if got := out.String(); got != "泥" {
+		t.Fatalf("expected digit to commit '泥', got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyN))
+	pressKey(t, eng, uint16(linux.KeyI))
+	pressKey(t, eng, uint16(linux.KeySpace))
+	if got := out.String(); got != "泥泥" {
+		t.Fatalf("expected learned candidate to be highlighted first, got %q", got)
+	}
+}
+
+func TestEnginePinyinLearnsOnlyChosenCandidates(t *testing.T) {
+	eng, out := newTestEngine(t, withPinyin)
+	dict, err := backend.LoadUserDictionary(filepath.Join(t.TempDir(), "userdict.json"))
+	if err != nil {
+		t.Fatalf("load user dictionary: %v", err)
+	}
+	t.Cleanup(func() { dict.Close() })
+	eng.modes[0].UserDict = dict
+
+	// A punctuation key commits the highlighted candidate without the
+	// user having chosen it.
+	typeKeys(t, eng, linux.KeyN, linux.KeyI, linux.KeyTab, linux.KeyComma)
+	if got := out.String(); got != "尼" {
+		t.Fatalf("expected the highlighted candidate to be committed, got %q", got)
+	}
+	typeKeys(t, eng, linux.KeyN, linux.KeyI, linux.KeySpace)
+	if got := out.String(); got != "尼你" {
+		t.Fatalf("expected an implicit commit not to be learned, got %q", got)
+	}
+}
+
+func TestEngineRomajiComposesKana(t *testing.T) {
+	eng, out := newTestEngine(t, withModes(
+		ModeSpec{Name: "romaji", Kind: types.ModeRomaji},
+		ModeSpec{Name: "latin", Kind: types.ModeLatin},
+	))
+
+	for _, code := range []uint16{linux.KeyK, linux.KeyI, linux.KeyT, linux.KeyT, linux.KeyE, linux.KeyN} {
+		pressKey(t, eng, code)
+	}
+	if got := out.String(); got != "きってn" {
+		t.Fatalf("expected committed kana plus pending 'n', got %q", got)
+	}
+	if eng.preedit != "n" {
+		t.Fatalf("expected preedit 'n', got %q", eng.preedit)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyBackspace))
+	if got := out.String(); got != "きって" || eng.preedit != "" {
+		t.Fatalf("expected backspace to remove pending romaji, got %q (preedit %q)", got, eng.preedit)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyKataHira))
+	pressKey(t, eng, uint16(linux.KeyN))
+	pressKey(t, eng, uint16(linux.KeyA))
+	if got := out.String(); got != "きってナ" {
+		t.Fatalf("expected katakana after toggle, got %q", got)
+	}
+}
+
+func TestEngineKanaVoicingMarks(t *testing.T) {
+	eng, out := newTestEngine(t, withModes(layoutMode(t, "kana86", types.ModeKana)))
+
+	pressKey(t, eng, uint16(linux.KeyT))
+	pressKey(t, eng, uint16(linux.KeyLeftBrace))
+	if got := out.String(); got != "が" || eng.preedit != "が" {
+		t.Fatalf("expected か and dakuten to merge, got %q (preedit %q)", got, eng.preedit)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyBackspace))
+	if got := out.String(); got != "か" {
+		t.Fatalf("expected backspace to remove the dakuten, got %q", got)
+	}
+
+	pressKey(t, eng, uint16(linux.KeyF))
+	pressKey(t, eng, uint16(linux.KeyRightBrace))
+	if got := out.String(); got != "かぱ" || eng.preedit != "ぱ" {
+		t.Fatalf("expected は and handakuten to merge, got %q (preedit %q)", got, eng.preedit)
+	}
+
+	pressKey(t, eng, uint16(linux.KeySpace))
+	if eng.preedit != "" {
+		t.Fatalf("expected space to commit the held kana, got preedit %q", eng.preedit)
+	}
+}
+
+// withKanji replaces the default modes with a romaji mode that converts
+// to kanji.
+func withKanji(s *testSetup) {
+	db := backend.NewDatabase(map[string][]string{
+		"かんじ":  {"漢字", "感じ", "幹事"},
+		"へんかん": {"変換"},
+		"を":    {"を"},
+	})
+	s.modes = []ModeSpec{{Name: "romaji", Kind: types.ModeRomaji, Database: db}}
+}
+
+func typeKeys(t *testing.T, eng *Engine, codes ...uint16) {
+	t.Helper()
+	for _, code := range codes {
+		pressKey(t, eng, code)
+	}
+}
+
+func TestEngineKanjiConversion(t *testing.T) {
+	eng, out := newTestEngine(t, withKanji)
+
+	// kanjiwohenkan
+	typeKeys(t, eng, linux.KeyK, linux.KeyA, linux.KeyN, linux.KeyJ, linux.KeyI,
+		linux.KeyW, linux.KeyO, linux.KeyH, linux.KeyE, linux.KeyN, linux.KeyK, linux.KeyA, linux.KeyN)
+	if got := out.String(); got != "かんじをへんかn" {
+		t.Fatalf("expected kana to stay in the preedit, got %q", got)
+	}
+
+	// The trailing n is flushed to ん before the conversion sees it.
+	pressKey(t, eng, linux.KeySpace)
+	if eng.kanji == nil || len(eng.kanji.segments) != 3 || eng.kanji.reading != "かんじをへんかん" {
+		t.Fatalf("expected three segments of かんじをへんかん, got %+v", eng.kanji)
+	}
+	if !strings.HasPrefix(eng.preedit, "[漢字]を変換") {
+		t.Fatalf("expected converted preedit, got %q", eng.preedit)
+	}
+
+	pressKey(t, eng, linux.KeySpace)
+	if !strings.HasPrefix(eng.preedit, "[感じ]を変換") {
+		t.Fatalf("expected space to cycle the focused segment, got %q", eng.preedit)
+	}
+
+	pressKey(t, eng, linux.KeyEnter)
+	if got := out.String(); got != "感じを変換" || eng.preedit != "" {
+		t.Fatalf("expected conversion to be committed, got %q (preedit %q)", got, eng.preedit)
+	}
+}
+
+func TestEngineKanjiConversionEscRestoresKana(t *testing.T) {
+	eng, out := newTestEngine(t, withKanji)
+
+	typeKeys(t, eng, linux.KeyK, linux.KeyA, linux.KeyN, linux.KeyJ, linux.KeyI)
+	pressKey(t, eng, linux.KeySpace)
+	if !strings.HasPrefix(eng.preedit, "漢字") {
+		t.Fatalf("expected conversion, got %q", eng.preedit)
+	}
+
+	pressKey(t, eng, linux.KeyEsc)
+	if got := out.String(); got != "かんじ" || eng.kanji != nil {
+		t.Fatalf("expected Esc to restore the kana, got %q", got)
+	}
+
+	pressKey(t, eng, linux.KeyBackspace)
+	if got := out.String(); got != "かん" {
+		t.Fatalf("expected backspace to delete buffered kana, got %q", got)
+	}
+
+	pressKey(t, eng, linux.KeyEnter)
+	if got := out.String(); got != "かん" || eng.preedit != "" {
+		t.Fatalf("expected Enter to commit the kana unchanged, got %q (preedit %q)", got, eng.preedit)
+	}
+}
+
+func TestEngineSebeolsikFinal(t *testing.T) {
+	eng, out := newTestEngine(t, withModes(layoutMode(t, "sebeolsik-final", types.ModeHangul)))
+
+	typeKeys(t, eng, linux.KeyM, linux.KeyF, linux.KeyS, linux.KeyK, linux.KeyG, linux.KeyW)
+	if got := out.String(); got != "한글" {
+		t.Fatalf("expected 3-91 keys to compose '한글', got %q", got)
+	}
+}
+
+func TestEngineMoachigiOption(t *testing.T) {
+	eng, out := newTestEngine(t,
+		withModes(layoutMode(t, "sebeolsik-final", types.ModeHangul)),
+		withToggle(func(toggle *config.ToggleConfig) {
+			toggle.Modes = map[string]config.ModeOptions{"sebeolsik-final": {Moachigi: true}}
+		}),
+	)
+
+	// ㄴ(final) ㅏ ㅎ(initial) typed out of order.
+	typeKeys(t, eng, linux.KeyS, linux.KeyF, linux.KeyM)
+	if got := out.String(); got != "한" {
+		t.Fatalf("expected moachigi to reorder jamo into '한', got %q", got)
+	}
+}
+
+func TestEngineMoachigiNeedsFinalKeys(t *testing.T) {
+	toggle := config.DefaultToggleConfig()
+	toggle.Modes = map[string]config.ModeOptions{"dubeolsik": {Moachigi: true}}
+	modes := []ModeSpec{layoutMode(t, "dubeolsik", types.ModeHangul)}
+	if _, err := NewEngine(0, modes, toggle, &fakeEmitter{}); err == nil {
+		t.Fatalf("expected an error for moachigi on a layout without final consonant keys")
+	}
+}
+
+func TestEngineOldHangulLayout(t *testing.T) {
+	eng, out := newTestEngine(t, withModes(layoutMode(t, "old-hangul", types.ModeHangul)))
+
+	// ㅂ ㅇ ㅏ forms ㅸ, which only exists as conjoining jamo.
+	typeKeys(t, eng, linux.KeyQ, linux.KeyD, linux.KeyK)
+	if got := out.String(); got != "ᄫᅡ" {
+		t.Fatalf("expected conjoining ᄫ+ᅡ, got %q", got)
+	}
+}
+
+// withNFD makes dubeolsik write NFD.
+func withNFD(s *testSetup) {
+	s.toggle.Modes = map[string]config.ModeOptions{"dubeolsik": {Normalization: hangul.NormalizeNFD}}
+}
+
+func TestEngineOutputNormalization(t *testing.T) {
+	eng, out := newTestEngine(t, withNFD)
+
+	// 한글: the preedit grows from one to three conjoining jamo and must be
+	// erased with as many backspaces.
+	typeKeys(t, eng, linux.KeyG, linux.KeyK, linux.KeyS, linux.KeyR, linux.KeyM, linux.KeyF)
+	if got := out.String(); got != "\u1112\u1161\u11AB\u1100\u1173\u11AF" {
+		t.Fatalf("expected NFD output, got %+q", got)
+	}
+	if eng.preedit != "글" {
+		t.Fatalf("expected the preedit to stay precomposed internally, got %q", eng.preedit)
+	}
+}
+
+func TestEngineErasesPreeditAsDrawn(t *testing.T) {
+	eng, out := newTestEngine(t, withNFD)
+
+	// 한 is drawn as three jamo; Latin mode writes NFC, in which it would
+	// be a single character.
+	typeKeys(t, eng, linux.KeyG, linux.KeyK, linux.KeyS)
+	eng.setMode(1)
+	if err := eng.replacePreedit(""); err != nil {
+		t.Fatalf("replace preedit: %v", err)
+	}
+	if got := out.String(); got != "" || out.backspaces[len(out.backspaces)-1] != 3 {
+		t.Fatalf("expected the NFD preedit to be erased with 3 backspaces, got %q (backspaces %v)", got, out.backspaces)
+	}
+}
+
+// withBackspace sets the backspace policy of dubeolsik.
+func withBackspace(policy hangul.BackspacePolicy) func(*testSetup) {
+	return func(s *testSetup) {
+		s.toggle.Modes = map[string]config.ModeOptions{"dubeolsik": {Backspace: policy}}
+	}
+}
+
+func TestEngineBackspacePolicies(t *testing.T) {
+	cases := []struct {
+		policy hangul.BackspacePolicy
+		want   string
+	}{
+		{hangul.BackspaceJamo, "갑"},
+		{hangul.BackspaceSyllable, ""},
+		{hangul.BackspaceReopen, "갑"},
+	}
+	for _, tc := range cases {
+		eng, out := newTestEngine(t, withBackspace(tc.policy))
+		// 값
+		typeKeys(t, eng, linux.KeyR, linux.KeyK, linux.KeyQ, linux.KeyT)
+		pressKey(t, eng, linux.KeyBackspace)
+		if got := out.String(); got != tc.want || eng.preedit != tc.want {
+			t.Fatalf("%s: expected %q after backspace, got %q (preedit %q)", tc.policy, tc.want, got, eng.preedit)
+		}
+	}
+}
+
+func TestEngineBackspaceReopensCommittedSyllable(t *testing.T) {
+	eng, out := newTestEngine(t, withBackspace(hangul.BackspaceReopen))
+
+	// 한글, then erase 글 jamo by jamo and walk back into 한.
+	typeKeys(t, eng, linux.KeyG, linux.KeyK, linux.KeyS, linux.KeyR, linux.KeyM, linux.KeyF)
+	for i := 0; i < 4; i++ {
+		pressKey(t, eng, linux.KeyBackspace)
+	}
+	if got := out.String(); got != "하" || eng.preedit != "하" {
+		t.Fatalf("expected 한 to reopen as 하, got %q (preedit %q)", got, eng.preedit)
+	}
+
+	// The reopened syllable keeps composing.
+	pressKey(t, eng, linux.KeyR)
+	if got := out.String(); got != "학" {
+		t.Fatalf("expected the reopened syllable to take a final, got %q", got)
+	}
+}
+
+func TestEngineBackspaceReopenStopsAtSymbols(t *testing.T) {
+	eng, out := newTestEngine(t,
+		withModes(layoutMode(t, "sebeolsik-final", types.ModeHangul)),
+		withToggle(func(toggle *config.ToggleConfig) {
+			toggle.Modes = map[string]config.ModeOptions{"sebeolsik-final": {Backspace: hangul.BackspaceReopen}}
+		}),
+	)
+
+	typeKeys(t, eng, linux.KeyM, linux.KeyF, linux.KeyS, linux.KeyMinus)
+	erased := len(out.backspaces)
+	pressKey(t, eng, linux.KeyBackspace)
+	if eng.preedit != "" || len(out.backspaces) != erased {
+		t.Fatalf("expected backspace to delete the symbol only, got %q (preedit %q)", out.String(), eng.preedit)
+	}
+	if len(out.forwarded) == 0 || out.forwarded[len(out.forwarded)-1].Code != linux.KeyBackspace {
+		t.Fatalf("expected backspace to be forwarded, got %+v", out.forwarded)
+	}
+}
+
+func TestEngineSelectAndPreviousChords(t *testing.T) {
+	ctrl := [][]uint16{ctrlKeys}
+	eng, out := newTestEngine(t,
+		withModes(
+			layoutMode(t, "dubeolsik", types.ModeHangul),
+			ModeSpec{Name: "romaji", Kind: types.ModeRomaji},
+			ModeSpec{Name: "latin", Kind: types.ModeLatin},
+		),
+		withToggle(func(toggle *config.ToggleConfig) {
+			toggle.Select = map[string][]config.ToggleChord{
+				"latin":  {{Key: uint16(linux.Key1), ModifierGroups: ctrl}},
+				"romaji": {{Key: uint16(linux.Key2), ModifierGroups: ctrl}},
+			}
+			toggle.Previous = []config.ToggleChord{{Key: uint16(linux.KeyF3)}}
+		}),
+	)
+	withCtrl := func(code uint16) {
+		t.Helper()
+		ctrlPress := util.InputEvent{Type: linux.EvKey, Code: uint16(linux.KeyLeftCtrl), Value: 1}
+		if err := eng.processEvent(&ctrlPress); err != nil {
+			t.Fatalf("press ctrl: %v", err)
+		}
+		pressKey(t, eng, code)
+		ctrlRelease := util.InputEvent{Type: linux.EvKey, Code: uint16(linux.KeyLeftCtrl), Value: 0}
+		if err := eng.processEvent(&ctrlRelease); err != nil {
+			t.Fatalf("release ctrl: %v", err)
+		}
+	}
+
+	pressKey(t, eng, linux.KeyF3) // no earlier mode yet
+	if eng.modeIndex != 0 {
+		t.Fatalf("expected previous without history to keep the mode, got %d", eng.modeIndex)
+	}
+
+	typeKeys(t, eng, linux.KeyG, linux.KeyK)
+	withCtrl(uint16(linux.Key1))
+	if eng.currentModeKind() != types.ModeLatin || eng.preedit != "" || out.String() != "하" {
+		t.Fatalf("expected 하 committed and Latin mode, got mode %v output %q", eng.currentModeKind(), out.String())
+	}
+
+	withCtrl(uint16(linux.Key2))
+	if eng.currentModeKind() != types.ModeRomaji {
+		t.Fatalf("expected select.romaji to skip the cycle order, got %v", eng.currentModeKind())
+	}
+	pressKey(t, eng, linux.KeyF3)
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected previous to return to Latin, got %v", eng.currentModeKind())
+	}
+	pressKey(t, eng, linux.KeyF3)
+	if eng.currentModeKind() != types.ModeRomaji {
+		t.Fatalf("expected a second previous to swap back, got %v", eng.currentModeKind())
+	}
+}
+
+func TestEngineSelectChordUnknownMode(t *testing.T) {
+	toggle := config.DefaultToggleConfig()
+	toggle.Select = map[string][]config.ToggleChord{"pinyin": {{Key: uint16(linux.KeyF2)}}}
+	modes := []ModeSpec{{Name: "latin", Kind: types.ModeLatin}}
+	if _, err := NewEngine(0, modes, toggle, &fakeEmitter{}); err == nil {
+		t.Fatalf("expected an error for a select chord naming a missing mode")
+	}
+}
+
+type fakePreeditEmitter struct {
+	fakeEmitter
+	native   bool
+	preedits []string
+}
+
+func (f *fakePreeditEmitter) NativePreedit() bool { return f.native }
+
+func (f *fakePreeditEmitter) SetPreedit(text string) error {
+	f.preedits = append(f.preedits, text)
+	return nil
+}
+
+func TestEngineNativePreedit(t *testing.T) {
+	out := &fakePreeditEmitter{fakeEmitter: fakeEmitter{supportsPreedit: true}}
+	eng, _ := newTestEngine(t, withEmitter(out))
+
+	// Typed before a text field is active, then replaced by a native
+	// preedit once it is.
+	pressKey(t, eng, linux.KeyG)
+	out.native = true
+	pressKey(t, eng, linux.KeyK)
+	typeKeys(t, eng, linux.KeyS, linux.KeyK)
+	if out.String() != "하" {
+		t.Fatalf("expected only the committed syllable to be typed, got %q", out.String())
+	}
+	if got, want := strings.Join(out.preedits, "|"), "하|한||나"; got != want {
+		t.Fatalf("expected native preedits %q, got %q", want, got)
+	}
+
+	// Losing the text field drops the native preedit without erasing.
+	out.native = false
+	pressKey(t, eng, linux.KeyS)
+	if len(out.backspaces) != 1 || out.String() != "하난" {
+		t.Fatalf("expected a typed preedit after deactivation, got %q (backspaces %v)", out.String(), out.backspaces)
+	}
+}
@@ -0,0 +1,122 @@
+package engine
+
+import (
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// maxRecentHangul bounds how many committed syllables are remembered for
+// Hanja lookups that extend past the current preedit.
+const maxRecentHangul = 8
+
+type hanjaState struct {
+	source string
+	list   *candidateList
+}
+
+func (e *Engine) noteHangulCommit(text string) {
+	if e.currentModeKind() != types.ModeHangul {
+		return
+	}
+	e.recentHangul = append(e.recentHangul, []rune(text)...)
+	if len(e.recentHangul) > maxRecentHangul {
+		e.recentHangul = append([]rune(nil), e.recentHangul[len(e.recentHangul)-maxRecentHangul:]...)
+	}
+}
+
+func (e *Engine) handleHanjaKey(event *util.InputEvent) error {
+	if isKeyRelease(event) {
+		if _, ok := e.forwardedKeys[event.Code]; ok {
+			return e.forwardKeyEvent(event)
+		}
+		return nil
+	}
+	mode := e.currentMode()
+	if !mode.Hanja.Available() {
+		return e.forwardKeyEvent(event)
+	}
+
+	preedit := []rune(e.preedit)
+	word := append(append([]rune(nil), e.recentHangul...), preedit...)
+	for start := 0; start < len(word); start++ {
+		source := string(word[start:])
+		candidates := mode.UserDict.Rank(source, mode.Hanja.Candidates(source))
+		if len(candidates) == 0 {
+			continue
+		}
+		return e.startHanja(source, candidates, len(word)-start-len(preedit))
+	}
+	return e.forwardKeyEvent(event)
+}
+
+// startHanja replaces the current preedit, together with the last committed
+// runes that belong to source, by the first Hanja candidate.
+func (e *Engine) startHanja(source string, candidates []string, committed int) error {
+	e.currentComposer().Flush()
+	if err := e.replacePreedit(""); err != nil {
+		return err
+	}
+	if committed > 0 {
+		keep := len(e.recentHangul) - committed
+		if err := e.eraseCommitted(string(e.recentHangul[keep:])); err != nil {
+			return err
+		}
+		e.recentHangul = e.recentHangul[:keep]
+	}
+	e.hanja = &hanjaState{source: source, list: newCandidateList(candidates)}
+	return e.replacePreedit(e.hanja.list.current())
+}
+
+// eraseCommitted deletes text that was already committed.
+func (e *Engine) eraseCommitted(text string) error {
+	return e.eraseRunes(countRunes(e.outputText(text)))
+}
+
+func (e *Engine) eraseRunes(count int) error {
+	suspended, err := e.suspendForwardedModifiers()
+	if err != nil {
+		return err
+	}
+	err = e.emitter.SendBackspace(count)
+	e.restoreForwardedModifiers(suspended)
+	return err
+}
+
+func (e *Engine) cycleHanja(step int) error {
+	e.hanja.list.move(step)
+	return e.replacePreedit(e.hanja.list.current())
+}
+
+// handleHanjaSelection processes a key press while a Hanja candidate is
+// shown. It reports whether the key was consumed; unconsumed keys commit the
+// candidate and continue through the regular key handling.
+func (e *Engine) handleHanjaSelection(event *util.InputEvent) (bool, error) {
+	switch int(event.Code) {
+	case linux.KeyHanja, linux.KeyTab:
+		return true, e.cycleHanja(1)
+	case linux.KeyEsc, linux.KeyBackspace:
+		source := e.hanja.source
+		e.hanja = nil
+		return true, e.commitText(source)
+	case linux.KeySpace, linux.KeyEnter:
+		return true, e.commitHanja(true)
+	default:
+		return false, e.commitHanja(false)
+	}
+}
+
+// commitHanja commits the shown candidate, recording it in the user
+// dictionary with learn.
+func (e *Engine) commitHanja(learn bool) error {
+	if e.hanja == nil {
+		return nil
+	}
+	text := e.hanja.list.current()
+	if learn {
+		e.learnCandidate(e.hanja.source, text)
+	}
+	e.hanja = nil
+	e.recentHangul = nil
+	return e.commitText(text)
+}
@@ -0,0 +1,106 @@
+package engine
+
+import (
+	"github.com/gg582/hanfe/internal/kana"
+	"github.com/gg582/hanfe/internal/layout"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// handleRomajiKeyPress feeds typed Latin characters to the romaji composer.
+// Completed kana are committed immediately; unfinished romaji stays in the
+// preedit exactly like a partially composed Hangul syllable.
+func (e *Engine) handleRomajiKeyPress(event *util.InputEvent) error {
+	if e.modifiersActive(alwaysForward) {
+		if err := e.commitPreedit(); err != nil {
+			return err
+		}
+		if err := e.ensureShiftForwarded(); err != nil {
+			return err
+		}
+		return e.forwardKeyEvent(event)
+	}
+
+	composer := e.currentRomajiComposer()
+	switch event.Code {
+	case uint16(linux.KeyKataHira):
+		composer.ToggleKatakana()
+		return nil
+	case uint16(linux.KeyKatakana):
+		composer.SetKatakana(true)
+		return nil
+	case uint16(linux.KeyHiragana):
+		composer.SetKatakana(false)
+		return nil
+	}
+
+	ch, ok := layout.QwertyRune(event.Code, e.shiftActive())
+	if !ok || !composer.Accepts(ch) {
+		if err := e.commitPreedit(); err != nil {
+			return err
+		}
+		if err := e.ensureShiftForwarded(); err != nil {
+			return err
+		}
+		return e.forwardKeyEvent(event)
+	}
+
+	result := composer.Feed(ch)
+	return e.applyComposition(result.Commit, result.Preedit)
+}
+
+func (e *Engine) currentRomajiComposer() *kana.RomajiComposer {
+	if e.currentModeKind() != types.ModeRomaji {
+		return nil
+	}
+	composer, ok := e.romajiComposers[e.modeIndex]
+	if !ok || composer == nil {
+		composer = kana.NewRomajiComposer()
+		e.romajiComposers[e.modeIndex] = composer
+	}
+	return composer
+}
+
+func (e *Engine) currentVoicingComposer() *kana.VoicingComposer {
+	if e.currentModeKind() != types.ModeKana {
+		return nil
+	}
+	composer, ok := e.voicingComposers[e.modeIndex]
+	if !ok || composer == nil {
+		composer = kana.NewVoicingComposer()
+		e.voicingComposers[e.modeIndex] = composer
+	}
+	return composer
+}
+
+// flushKanaComposer empties the composer of the current kana mode and
+// returns the kana it was holding.
+func (e *Engine) flushKanaComposer() string {
+	if composer := e.currentRomajiComposer(); composer != nil {
+		return composer.Flush()
+	}
+	if composer := e.currentVoicingComposer(); composer != nil {
+		return composer.Flush()
+	}
+	return ""
+}
+
+// applyComposition commits finished kana and redraws what is still held.
+// When the mode converts to kanji, finished kana are collected in the kana
+// buffer instead and stay in the preedit until conversion.
+func (e *Engine) applyComposition(commit, preedit string) error {
+	if e.kanaConversionEnabled() {
+		e.kanaBuffer += commit
+		return e.replacePreedit(e.kanaBuffer + preedit)
+	}
+	if commit != "" {
+		if err := e.commitText(commit); err != nil {
+			return err
+		}
+	}
+	if preedit != e.preedit {
+		return e.replacePreedit(preedit)
+	}
+	return nil
+}
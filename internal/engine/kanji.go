@@ -0,0 +1,196 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/gg582/hanfe/internal/kana"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// kanjiState tracks an active kana-kanji conversion. The kana buffer is
+// split into segments, each with its own candidate list; focus is the
+// segment the selection keys act on.
+type kanjiState struct {
+	reading  string
+	segments []kanjiSegment
+	focus    int
+}
+
+type kanjiSegment struct {
+	reading string
+	list    *candidateList
+}
+
+// kanaConversionEnabled reports whether kana typed in the current mode are
+// buffered for conversion instead of being committed immediately.
+func (e *Engine) kanaConversionEnabled() bool {
+	mode := e.currentMode()
+	return mode.Database.Available() && (e.currentRomajiComposer() != nil || e.currentVoicingComposer() != nil)
+}
+
+// handleKanaBufferKey handles the keys that act on the whole kana buffer
+// before conversion starts: Space converts, Enter commits the kana as typed
+// and Esc discards them. It reports whether the key was consumed.
+func (e *Engine) handleKanaBufferKey(event *util.InputEvent) (bool, error) {
+	if e.kanaBuffer == "" && e.preedit == "" {
+		return false, nil
+	}
+	switch int(event.Code) {
+	case linux.KeySpace:
+		e.kanaBuffer += e.flushKanaComposer()
+		if e.kanaBuffer == "" {
+			return false, nil
+		}
+		return true, e.startKanji()
+	case linux.KeyEnter:
+		return true, e.commitPreedit()
+	case linux.KeyEsc:
+		e.flushKanaComposer()
+		e.kanaBuffer = ""
+		return true, e.replacePreedit("")
+	}
+	return false, nil
+}
+
+// startKanji segments the kana buffer by the longest dictionary entries and
+// shows the first candidate of every segment.
+func (e *Engine) startKanji() error {
+	mode := e.currentMode()
+	state := &kanjiState{reading: e.kanaBuffer}
+	runes := []rune(e.kanaBuffer)
+	var unmatched []rune
+	flushUnmatched := func() {
+		if len(unmatched) == 0 {
+			return
+		}
+		reading := string(unmatched)
+		state.segments = append(state.segments, kanjiSegment{reading: reading, list: newCandidateList(e.kanjiCandidates(reading))})
+		unmatched = nil
+	}
+	for start := 0; start < len(runes); {
+		end := len(runes)
+		for ; end > start; end-- {
+			if len(mode.Database.Candidates(kana.ToHiragana(string(runes[start:end])))) > 0 {
+				break
+			}
+		}
+		if end == start {
+			// Kana without any dictionary entry are grouped into one
+			// segment that converts to itself.
+			unmatched = append(unmatched, runes[start])
+			start++
+			continue
+		}
+		flushUnmatched()
+		reading := string(runes[start:end])
+		state.segments = append(state.segments, kanjiSegment{reading: reading, list: newCandidateList(e.kanjiCandidates(reading))})
+		start = end
+	}
+	flushUnmatched()
+	e.kanji = state
+	return e.replacePreedit(e.renderKanji())
+}
+
+// kanjiCandidates returns the dictionary candidates for reading followed by
+// the kana themselves, so every segment can always stay unconverted.
+func (e *Engine) kanjiCandidates(reading string) []string {
+	mode := e.currentMode()
+	key := kana.ToHiragana(reading)
+	candidates := mode.UserDict.Rank(key, mode.Database.Candidates(key))
+	candidates = appendUnique(candidates, reading)
+	candidates = appendUnique(candidates, key)
+	return appendUnique(candidates, kana.ToKatakana(key))
+}
+
+func appendUnique(list []string, value string) []string {
+	for _, existing := range list {
+		if existing == value {
+			return list
+		}
+	}
+	return append(list, value)
+}
+
+// renderKanji joins the chosen candidates, brackets the focused segment when
+// there are several, and lists the focused segment's candidates.
+func (e *Engine) renderKanji() string {
+	var b strings.Builder
+	for idx, segment := range e.kanji.segments {
+		text := segment.list.current()
+		if idx == e.kanji.focus && len(e.kanji.segments) > 1 {
+			text = "[" + text + "]"
+		}
+		b.WriteString(text)
+	}
+	focus := e.kanji.segments[e.kanji.focus].list
+	if len(focus.candidates) > 1 {
+		b.WriteString(" ")
+		b.WriteString(focus.render())
+	}
+	return b.String()
+}
+
+// handleKanjiSelection processes a key press while a conversion is shown.
+// Unconsumed keys commit the conversion and continue through the regular
+// key handling, like the Hanja selection does.
+func (e *Engine) handleKanjiSelection(event *util.InputEvent) (bool, error) {
+	focus := e.kanji.segments[e.kanji.focus].list
+	code := int(event.Code)
+	if code >= linux.Key1 && code <= linux.Key9 {
+		if focus.choose(code - linux.Key1 + 1) {
+			if e.kanji.focus == len(e.kanji.segments)-1 {
+				return true, e.commitKanji(true)
+			}
+			e.kanji.focus++
+			return true, e.replacePreedit(e.renderKanji())
+		}
+		return true, nil
+	}
+	switch code {
+	case linux.KeySpace, linux.KeyDown:
+		focus.move(1)
+	case linux.KeyUp:
+		focus.move(-1)
+	case linux.KeyPageDown:
+		focus.movePage(1)
+	case linux.KeyPageUp:
+		focus.movePage(-1)
+	case linux.KeyRight, linux.KeyTab:
+		if e.kanji.focus < len(e.kanji.segments)-1 {
+			e.kanji.focus++
+		}
+	case linux.KeyLeft:
+		if e.kanji.focus > 0 {
+			e.kanji.focus--
+		}
+	case linux.KeyEnter:
+		return true, e.commitKanji(true)
+	case linux.KeyEsc, linux.KeyBackspace:
+		e.kanaBuffer = e.kanji.reading
+		e.kanji = nil
+		return true, e.replacePreedit(e.kanaBuffer)
+	default:
+		return false, e.commitKanji(false)
+	}
+	return true, e.replacePreedit(e.renderKanji())
+}
+
+// commitKanji commits the conversion, recording the chosen candidates in
+// the user dictionary with learn.
+func (e *Engine) commitKanji(learn bool) error {
+	if e.kanji == nil {
+		return nil
+	}
+	var b strings.Builder
+	for _, segment := range e.kanji.segments {
+		text := segment.list.current()
+		if learn && text != segment.reading {
+			e.learnCandidate(kana.ToHiragana(segment.reading), text)
+		}
+		b.WriteString(text)
+	}
+	e.kanji = nil
+	e.kanaBuffer = ""
+	return e.commitText(b.String())
+}
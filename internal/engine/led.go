@@ -0,0 +1,60 @@
+package engine
+
+import (
+	"syscall"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+func ledCode(indicator config.Indicator) (uint16, bool) {
+	switch indicator {
+	case config.IndicatorCaps:
+		return linux.LedCapsL, true
+	case config.IndicatorScroll:
+		return linux.LedScrollL, true
+	case config.IndicatorKana:
+		return linux.LedKana, true
+	case config.IndicatorCompose:
+		return linux.LedCompose, true
+	}
+	return 0, false
+}
+
+// writeDeviceLED sets an LED on the grabbed keyboard. The grab keeps the
+// kernel from driving the LEDs itself, so they only change when told to.
+func (e *Engine) writeDeviceLED(code uint16, on bool) error {
+	value := int32(0)
+	if on {
+		value = 1
+	}
+	events := []util.InputEvent{
+		{Type: linux.EvLed, Code: code, Value: value},
+		{Type: linux.EvSyn, Code: linux.SynReport},
+	}
+	for i := range events {
+		if _, err := syscall.Write(e.deviceFD, events[i].Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// syncLED lights the configured LED while a non-Latin mode is active. A
+// keyboard without that LED is not an error worth stopping for.
+func (e *Engine) syncLED() {
+	code, ok := ledCode(e.toggle.LED)
+	if !ok || e.writeLED == nil || len(e.modes) == 0 {
+		return
+	}
+	_ = e.writeLED(code, e.currentModeKind() != types.ModeLatin)
+}
+
+// clearLED turns the configured LED off again.
+func (e *Engine) clearLED() {
+	if code, ok := ledCode(e.toggle.LED); ok && e.writeLED != nil {
+		_ = e.writeLED(code, false)
+	}
+}
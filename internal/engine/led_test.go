@@ -0,0 +1,57 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+type ledWrite struct {
+	code uint16
+	on   bool
+}
+
+func TestEngineCapsLockToggleDrivesLED(t *testing.T) {
+	eng, out := newTestEngine(t,
+		withChords(config.ToggleChord{Key: uint16(linux.KeyCapsLock)}),
+		withToggle(func(toggle *config.ToggleConfig) {
+			toggle.LED = config.IndicatorCaps
+			toggle.DefaultMode = "latin"
+		}))
+	var writes []ledWrite
+	eng.writeLED = func(code uint16, on bool) error {
+		writes = append(writes, ledWrite{code: code, on: on})
+		return nil
+	}
+
+	caps := uint16(linux.KeyCapsLock)
+	for _, value := range []int32{1, 2, 2, 0} {
+		event := util.InputEvent{Type: linux.EvKey, Code: caps, Value: value}
+		if err := eng.processEvent(&event); err != nil {
+			t.Fatalf("process caps lock %d: %v", value, err)
+		}
+	}
+	if eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected Caps Lock to switch to Hangul")
+	}
+	for _, ev := range out.forwarded {
+		if ev.Code == caps {
+			t.Fatalf("expected Caps Lock to be swallowed, forwarded %+v", ev)
+		}
+	}
+
+	pressKey(t, eng, caps)
+	want := []ledWrite{{code: linux.LedCapsL, on: true}, {code: linux.LedCapsL, on: false}}
+	if len(writes) != len(want) || writes[0] != want[0] || writes[1] != want[1] {
+		t.Fatalf("expected LED writes %v, got %v", want, writes)
+	}
+
+	// Other keys still reach the application in Latin mode.
+	pressKey(t, eng, linux.KeyA)
+	if len(out.forwarded) != 2 || out.forwarded[0].Code != uint16(linux.KeyA) {
+		t.Fatalf("expected only the A press and release to be forwarded, got %+v", out.forwarded)
+	}
+}
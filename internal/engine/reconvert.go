@@ -0,0 +1,156 @@
+package engine
+
+import (
+	"strings"
+
+	"github.com/gg582/hanfe/internal/hangul"
+	"github.com/gg582/hanfe/internal/layout"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// maxWordKeys bounds the keystroke history kept for reconversion.
+const maxWordKeys = 32
+
+type keyStroke struct {
+	code  uint16
+	shift bool
+}
+
+// noteKeystroke keeps the keys typed since the last whitespace in Latin and
+// Hangul modes. Shortcuts, navigation keys and other modes end the word.
+func (e *Engine) noteKeystroke(event *util.InputEvent) {
+	if !isKeyPress(event) || contains(modifierKeys, event.Code) {
+		return
+	}
+	kind := e.currentModeKind()
+	if (kind != types.ModeLatin && kind != types.ModeHangul) || e.modifiersActive(alwaysForward) {
+		e.wordKeys = nil
+		return
+	}
+	if event.Code == uint16(linux.KeyBackspace) {
+		// Backspace removes one character in Latin mode and one jamo in
+		// Hangul mode, except when whole syllables are erased.
+		if kind == types.ModeHangul && e.currentComposer().BackspacePolicy() == hangul.BackspaceSyllable {
+			e.wordKeys = nil
+		} else if n := len(e.wordKeys); n > 0 {
+			e.wordKeys = e.wordKeys[:n-1]
+		}
+		return
+	}
+	if r, ok := layout.QwertyRune(event.Code, false); !ok || r == ' ' {
+		e.wordKeys = nil
+		return
+	}
+	e.wordKeys = append(e.wordKeys, keyStroke{code: event.Code, shift: e.shiftActive()})
+	if len(e.wordKeys) > maxWordKeys {
+		e.wordKeys = append([]keyStroke(nil), e.wordKeys[len(e.wordKeys)-maxWordKeys:]...)
+	}
+}
+
+func (e *Engine) shouldReconvert(event *util.InputEvent) bool {
+	return isKeyPress(event) && e.chordPressed(e.toggle.Reconvert, event.Code)
+}
+
+// reconvert retypes the current word in the other script: keys typed in
+// Latin mode are erased and composed as Hangul, and Hangul is turned back
+// into the Latin keys that produced it. The engine switches to that mode
+// and keeps the history, so a second press converts back.
+func (e *Engine) reconvert() error {
+	var target int
+	switch e.currentModeKind() {
+	case types.ModeLatin:
+		target = e.modeOfKind(types.ModeHangul)
+	case types.ModeHangul:
+		target = e.modeOfKind(types.ModeLatin)
+	default:
+		return nil
+	}
+	if target < 0 || len(e.wordKeys) == 0 {
+		return nil
+	}
+	return e.reconvertTo(target)
+}
+
+// reconvertTo erases the word in e.wordKeys as the current mode rendered it
+// and types it again in the target mode. The last syllable stays in the
+// preedit.
+func (e *Engine) reconvertTo(target int) error {
+	keys := e.wordKeys
+	current := e.currentMode()
+	var scratch *hangul.HangulComposer
+	if current.Kind == types.ModeHangul {
+		e.currentComposer().Flush()
+		e.hanja = nil
+		scratch = e.newHangulComposer(current)
+	}
+	shown := e.preedit
+	if err := e.replacePreedit(""); err != nil {
+		return err
+	}
+	commit, preedit := e.renderKeys(current, scratch, keys)
+	if err := e.eraseCommitted(strings.TrimSuffix(commit+preedit, shown)); err != nil {
+		return err
+	}
+
+	e.setMode(target)
+	e.wordKeys = keys
+	mode := e.currentMode()
+	var composer *hangul.HangulComposer
+	if mode.Kind == types.ModeHangul {
+		composer = e.currentComposer()
+	}
+	commit, preedit = e.renderKeys(mode, composer, keys)
+	if err := e.sendText(commit); err != nil {
+		return err
+	}
+	e.noteHangulCommit(commit)
+	return e.replacePreedit(preedit)
+}
+
+// modeOfKind returns the current mode when it has the given kind and the
+// first such mode otherwise, or -1 when there is none.
+func (e *Engine) modeOfKind(kind types.InputMode) int {
+	if e.currentModeKind() == kind {
+		return e.modeIndex
+	}
+	for idx, mode := range e.modes {
+		if mode.Kind == kind {
+			return idx
+		}
+	}
+	return -1
+}
+
+// renderKeys replays keys through mode and returns the committed text and
+// the preedit left in composer. Latin modes produce the QWERTY characters.
+func (e *Engine) renderKeys(mode ModeSpec, composer *hangul.HangulComposer, keys []keyStroke) (string, string) {
+	var commit strings.Builder
+	preedit := ""
+	for _, key := range keys {
+		r, _ := layout.QwertyRune(key.code, key.shift)
+		if mode.Kind != types.ModeHangul || mode.Layout == nil {
+			commit.WriteRune(r)
+			continue
+		}
+		symbol := mode.Layout.Translate(key.code, key.shift)
+		switch {
+		case symbol != nil && symbol.Kind == layout.SymbolJamo:
+			result := composer.Feed(symbol.Jamo, symbol.Role)
+			commit.WriteString(result.Commit)
+			preedit = result.Preedit
+		case symbol != nil && symbol.Kind == layout.SymbolText:
+			if symbol.CommitBefore {
+				commit.WriteString(composer.Flush())
+				preedit = ""
+			}
+			commit.WriteString(symbol.Text)
+		default:
+			commit.WriteString(composer.Flush())
+			preedit = ""
+			commit.WriteRune(r)
+		}
+	}
+	return commit.String(), preedit
+}
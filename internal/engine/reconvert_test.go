@@ -0,0 +1,117 @@
+package engine
+
+import (
+	"testing"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// withReconvert starts in Latin mode with F12 as the reconvert key.
+func withReconvert(s *testSetup) {
+	s.toggle.DefaultMode = "latin"
+	s.toggle.Reconvert = []config.ToggleChord{{Key: uint16(linux.KeyF12)}}
+}
+
+func TestEngineReconvertLatinToHangul(t *testing.T) {
+	eng, out := newTestEngine(t, withReconvert)
+
+	// Latin keys are forwarded; stand in for the application's echo.
+	typeKeys(t, eng, linux.KeyA, linux.KeySpace)
+	typeKeys(t, eng, linux.KeyG, linux.KeyK, linux.KeyS, linux.KeyR, linux.KeyM, linux.KeyF)
+	out.buffer = []rune("a gksrmf")
+
+	pressKey(t, eng, linux.KeyF12)
+	if got := out.String(); got != "a 한글" {
+		t.Fatalf("expected the word to be retyped as Hangul, got %q", got)
+	}
+	if eng.currentModeKind() != types.ModeHangul || eng.preedit != "글" {
+		t.Fatalf("expected Hangul mode with 글 still composing, got mode %v preedit %q", eng.currentModeKind(), eng.preedit)
+	}
+
+	// Typing continues in the reconverted syllable.
+	pressKey(t, eng, linux.KeyK)
+	if got := out.String(); got != "a 한그라" {
+		t.Fatalf("expected composition to continue, got %q", got)
+	}
+}
+
+func TestEngineReconvertHangulToLatin(t *testing.T) {
+	eng, out := newTestEngine(t, withReconvert)
+	pressKey(t, eng, linux.KeyF12) // nothing typed yet: no-op
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected reconvert without history to keep the mode")
+	}
+	eng.modeIndex = 0
+
+	typeKeys(t, eng, linux.KeyD, linux.KeyK, linux.KeyS, linux.KeyS, linux.KeyU, linux.KeyD)
+	if got := out.String(); got != "안녕" {
+		t.Fatalf("expected 안녕, got %q", got)
+	}
+	pressKey(t, eng, linux.KeyF12)
+	if got := out.String(); got != "dkssud" || eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected dkssud in Latin mode, got %q (mode %v)", got, eng.currentModeKind())
+	}
+
+	pressKey(t, eng, linux.KeyF12)
+	if got := out.String(); got != "안녕" {
+		t.Fatalf("expected a second press to convert back, got %q", got)
+	}
+}
+
+func TestEngineKeystrokeHistory(t *testing.T) {
+	eng, _ := newTestEngine(t, withReconvert)
+
+	shift := util.InputEvent{Type: linux.EvKey, Code: uint16(linux.KeyLeftShift), Value: 1}
+	if err := eng.processEvent(&shift); err != nil {
+		t.Fatalf("press shift: %v", err)
+	}
+	pressKey(t, eng, linux.KeyR)
+	shift.Value = 0
+	if err := eng.processEvent(&shift); err != nil {
+		t.Fatalf("release shift: %v", err)
+	}
+	typeKeys(t, eng, linux.KeyK, linux.KeyX, linux.KeyBackspace)
+	want := []keyStroke{{code: uint16(linux.KeyR), shift: true}, {code: uint16(linux.KeyK)}}
+	if len(eng.wordKeys) != len(want) || eng.wordKeys[0] != want[0] || eng.wordKeys[1] != want[1] {
+		t.Fatalf("unexpected history %+v", eng.wordKeys)
+	}
+
+	pressKey(t, eng, linux.KeyEnter)
+	if len(eng.wordKeys) != 0 {
+		t.Fatalf("expected Enter to end the word, got %+v", eng.wordKeys)
+	}
+
+	for i := 0; i < maxWordKeys+5; i++ {
+		pressKey(t, eng, linux.KeyA)
+	}
+	if len(eng.wordKeys) != maxWordKeys {
+		t.Fatalf("expected history to be bounded to %d keys, got %d", maxWordKeys, len(eng.wordKeys))
+	}
+}
+
+func TestEngineKeystrokeHistoryFollowsMode(t *testing.T) {
+	eng, out := newTestEngine(t, withReconvert)
+
+	// Keys typed before a mode switch are not part of the word.
+	typeKeys(t, eng, linux.KeyG, linux.KeyK)
+	pressKey(t, eng, linux.KeyRightAlt)
+	typeKeys(t, eng, linux.KeyR, linux.KeyK)
+	out.buffer = []rune("gk" + out.String())
+	pressKey(t, eng, linux.KeyF12)
+	if got := out.String(); got != "gkrk" {
+		t.Fatalf("expected only 가 to be reconverted, got %q", got)
+	}
+
+	// Erasing a committed syllable ends the word.
+	pressKey(t, eng, linux.KeyF12)
+	typeKeys(t, eng, linux.KeySpace, linux.KeyD, linux.KeyK, linux.KeyS, linux.KeyS, linux.KeyK)
+	pressKey(t, eng, linux.KeyBackspace)
+	pressKey(t, eng, linux.KeyBackspace)
+	pressKey(t, eng, linux.KeyBackspace)
+	if len(eng.wordKeys) != 0 {
+		t.Fatalf("expected erasing 안 to clear the history, got %+v", eng.wordKeys)
+	}
+}
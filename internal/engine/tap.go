@@ -0,0 +1,184 @@
+package engine
+
+import (
+	"time"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+const (
+	defaultTapTimeout  = 250 * time.Millisecond
+	defaultHoldTimeout = 500 * time.Millisecond
+)
+
+// chordBinding ties a tap, double-tap or hold chord to what it does. A
+// binding with an active func only counts while it returns true.
+type chordBinding struct {
+	chord  config.ToggleChord
+	action func() error
+	active func() bool
+}
+
+// tapState follows the key that may complete a tap or hold chord.
+type tapState struct {
+	code        uint16
+	down        time.Duration
+	interrupted bool
+	consumed    bool
+	fired       bool
+	// lastTap and lastTapEnd remember the previous tap for double taps.
+	lastTap    uint16
+	lastTapEnd time.Duration
+}
+
+// bindTapChords collects the chords that do not fire on press.
+func (e *Engine) bindTapChords() {
+	bind := func(chords []config.ToggleChord, action func() error) {
+		for _, chord := range chords {
+			if chord.Trigger != config.TriggerPress {
+				e.tapBindings = append(e.tapBindings, chordBinding{chord: chord, action: action})
+			}
+		}
+	}
+	bind(e.toggle.Chords, e.toggleMode)
+	bind(e.toggle.Reconvert, e.reconvert)
+	bind(e.toggle.Previous, func() error { return e.selectMode(e.previousIndex) })
+	for idx, chords := range e.selectChords {
+		target := idx
+		bind(chords, func() error { return e.selectMode(target) })
+	}
+	if e.toggle.Auto.Enabled {
+		for _, chord := range e.toggle.Auto.Undo {
+			if chord.Trigger != config.TriggerPress {
+				e.tapBindings = append(e.tapBindings, chordBinding{
+					chord:  chord,
+					action: e.undoAutoSwitch,
+					active: func() bool { return e.autoUndo != nil },
+				})
+			}
+		}
+	}
+}
+
+func (e *Engine) tapTimeout() time.Duration {
+	if e.toggle.TapTimeout > 0 {
+		return e.toggle.TapTimeout
+	}
+	return defaultTapTimeout
+}
+
+func (e *Engine) holdTimeout() time.Duration {
+	if e.toggle.HoldTimeout > 0 {
+		return e.toggle.HoldTimeout
+	}
+	return defaultHoldTimeout
+}
+
+func eventTime(event *util.InputEvent) time.Duration {
+	return time.Duration(event.Time.Sec)*time.Second + time.Duration(event.Time.Usec)*time.Microsecond
+}
+
+// trackTap updates the tap state for a key event. It returns the action of
+// a chord completed by the event, to run after the event itself, and
+// whether the event belongs to a tap chord on a non-modifier key and must
+// not reach the application. Modifier keys keep working as modifiers. A
+// non-modifier key held back on press that turns out not to complete a
+// chord is returned as replay: its press is due before the event.
+func (e *Engine) trackTap(event *util.InputEvent) (action func() error, replay uint16, consumed bool) {
+	code := event.Code
+	at := eventTime(event)
+	switch event.Value {
+	case 1:
+		if e.tap.code != 0 && e.tap.code != code {
+			e.tap.interrupted = true
+			if e.tap.consumed {
+				// Typed together with another key: not a chord.
+				replay = e.tap.code
+				e.tap.consumed = false
+			}
+		}
+		if !e.tapBound(code) {
+			e.tap.lastTap = 0
+			return nil, replay, false
+		}
+		if e.tap.lastTap != code || at-e.tap.lastTapEnd > e.tapTimeout() {
+			e.tap.lastTap = 0
+		}
+		e.tap.code = code
+		e.tap.down = at
+		e.tap.interrupted = false
+		e.tap.fired = false
+		e.tap.consumed = !contains(modifierKeys, code)
+		return nil, replay, e.tap.consumed
+	case 2:
+		if code != e.tap.code {
+			return nil, 0, false
+		}
+		if !e.tap.interrupted && !e.tap.fired && at-e.tap.down >= e.holdTimeout() {
+			if action := e.tapAction(config.TriggerHold, code); action != nil {
+				e.tap.fired = true
+				return action, 0, e.tap.consumed
+			}
+		}
+		return nil, 0, e.tap.consumed
+	case 0:
+		if code != e.tap.code {
+			return nil, 0, false
+		}
+		state := e.tap
+		e.tap.code = 0
+		e.tap.lastTap = 0
+		if state.interrupted || state.fired {
+			return nil, 0, state.consumed
+		}
+		held := at - state.down
+		switch {
+		case held >= e.holdTimeout():
+			action = e.tapAction(config.TriggerHold, code)
+		case held >= e.tapTimeout():
+		case state.lastTap == code && e.tapAction(config.TriggerDoubleTap, code) != nil:
+			action = e.tapAction(config.TriggerDoubleTap, code)
+		default:
+			e.tap.lastTap = code
+			e.tap.lastTapEnd = at
+			action = e.tapAction(config.TriggerTap, code)
+		}
+		if action == nil && state.consumed {
+			// The key was typed after all; deliver its press, then this
+			// release.
+			return nil, code, false
+		}
+		return action, 0, state.consumed
+	}
+	return nil, 0, false
+}
+
+// tapBound reports whether a tap, double-tap or hold chord uses code with
+// the modifiers currently held.
+func (e *Engine) tapBound(code uint16) bool {
+	for _, binding := range e.tapBindings {
+		if binding.chord.Key == code && e.bindingActive(binding) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) tapAction(trigger config.ChordTrigger, code uint16) func() error {
+	for _, binding := range e.tapBindings {
+		chord := binding.chord
+		if chord.Trigger == trigger && chord.Key == code && e.bindingActive(binding) {
+			return binding.action
+		}
+	}
+	return nil
+}
+
+func (e *Engine) bindingActive(binding chordBinding) bool {
+	return e.chordModifiersActive(binding.chord) && (binding.active == nil || binding.active())
+}
+
+func (e *Engine) chordModifiersActive(chord config.ToggleChord) bool {
+	return len(chord.ModifierGroups) == 0 || e.modifierGroupsActive(chord.ModifierGroups)
+}
@@ -0,0 +1,159 @@
+package engine
+
+import (
+	"syscall"
+	"testing"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// withChords replaces the toggle chords.
+func withChords(chords ...config.ToggleChord) func(*testSetup) {
+	return func(s *testSetup) { s.toggle.Chords = chords }
+}
+
+// sendKeyAt delivers a key event stamped ms milliseconds into the test.
+func sendKeyAt(t *testing.T, eng *Engine, code uint16, value int32, ms int64) {
+	t.Helper()
+	event := util.InputEvent{
+		Time:  syscall.Timeval{Sec: ms / 1000, Usec: (ms % 1000) * 1000},
+		Type:  linux.EvKey,
+		Code:  code,
+		Value: value,
+	}
+	if err := eng.processEvent(&event); err != nil {
+		t.Fatalf("process key %d value %d: %v", code, value, err)
+	}
+}
+
+func TestEngineTapChordOnModifier(t *testing.T) {
+	shift := uint16(linux.KeyLeftShift)
+	eng, out := newTestEngine(t, withChords(config.ToggleChord{Key: shift, Trigger: config.TriggerTap}))
+
+	// Shift+letter still types a capital and does not toggle.
+	sendKeyAt(t, eng, shift, 1, 0)
+	sendKeyAt(t, eng, uint16(linux.KeyR), 1, 50)
+	sendKeyAt(t, eng, uint16(linux.KeyR), 0, 80)
+	sendKeyAt(t, eng, shift, 0, 100)
+	if eng.currentModeKind() != types.ModeHangul || eng.preedit != "ㄲ" {
+		t.Fatalf("expected Shift+R to compose ㄲ in Hangul mode, got mode %v preedit %q", eng.currentModeKind(), eng.preedit)
+	}
+
+	// A lone tap toggles and commits the syllable.
+	sendKeyAt(t, eng, shift, 1, 1000)
+	sendKeyAt(t, eng, shift, 0, 1100)
+	if eng.currentModeKind() != types.ModeLatin || out.String() != "ㄲ" {
+		t.Fatalf("expected a Shift tap to switch to Latin, got mode %v output %q", eng.currentModeKind(), out.String())
+	}
+
+	// Holding past the tap timeout is not a tap.
+	sendKeyAt(t, eng, shift, 1, 2000)
+	sendKeyAt(t, eng, shift, 0, 2400)
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected a slow release not to toggle")
+	}
+}
+
+func TestEngineDoubleTapAndHoldChords(t *testing.T) {
+	caps := uint16(linux.KeyCapsLock)
+	ctrl := uint16(linux.KeyRightCtrl)
+	eng, _ := newTestEngine(t, withChords(
+		config.ToggleChord{Key: ctrl, Trigger: config.TriggerDoubleTap},
+		config.ToggleChord{Key: caps, Trigger: config.TriggerHold},
+	))
+
+	sendKeyAt(t, eng, ctrl, 1, 0)
+	sendKeyAt(t, eng, ctrl, 0, 50)
+	if eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected a single tap not to toggle")
+	}
+	sendKeyAt(t, eng, ctrl, 1, 150)
+	sendKeyAt(t, eng, ctrl, 0, 200)
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected a double tap to toggle")
+	}
+
+	// Taps too far apart do not count as a double tap.
+	sendKeyAt(t, eng, ctrl, 1, 1000)
+	sendKeyAt(t, eng, ctrl, 0, 1050)
+	sendKeyAt(t, eng, ctrl, 1, 2000)
+	sendKeyAt(t, eng, ctrl, 0, 2050)
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected separate taps not to toggle")
+	}
+
+	// Holding fires on the first repeat past the hold timeout, once.
+	sendKeyAt(t, eng, caps, 1, 3000)
+	sendKeyAt(t, eng, caps, 2, 3300)
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected hold not to fire before the timeout")
+	}
+	sendKeyAt(t, eng, caps, 2, 3600)
+	sendKeyAt(t, eng, caps, 2, 3700)
+	sendKeyAt(t, eng, caps, 0, 3800)
+	if eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected a long press to toggle once, got %v", eng.currentModeKind())
+	}
+}
+
+func TestEngineTapChordReplaysTypedKey(t *testing.T) {
+	caps := uint16(linux.KeyCapsLock)
+	eng, out := newTestEngine(t,
+		withChords(config.ToggleChord{Key: caps, Trigger: config.TriggerTap}),
+		withToggle(func(toggle *config.ToggleConfig) { toggle.DefaultMode = "latin" }),
+	)
+	forwarded := func() []util.InputEvent {
+		events := out.forwarded
+		out.forwarded = nil
+		return events
+	}
+
+	// Another key pressed meanwhile: Caps Lock was typed, in order.
+	sendKeyAt(t, eng, caps, 1, 0)
+	if events := forwarded(); len(events) != 0 {
+		t.Fatalf("expected the press to be held back, got %+v", events)
+	}
+	sendKeyAt(t, eng, uint16(linux.KeyA), 1, 50)
+	sendKeyAt(t, eng, uint16(linux.KeyA), 0, 80)
+	sendKeyAt(t, eng, caps, 0, 100)
+	events := forwarded()
+	if len(events) != 4 || events[0].Code != caps || events[0].Value != 1 || events[1].Code != uint16(linux.KeyA) || events[3].Code != caps || events[3].Value != 0 {
+		t.Fatalf("expected Caps Lock, A, A, Caps Lock, got %+v", events)
+	}
+
+	// Released too late for a tap: the key press and release go through.
+	sendKeyAt(t, eng, caps, 1, 1000)
+	sendKeyAt(t, eng, caps, 0, 1400)
+	if events := forwarded(); len(events) != 2 || events[0].Value != 1 || events[1].Value != 0 {
+		t.Fatalf("expected the slow press to be replayed, got %+v", events)
+	}
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected no toggle, got %v", eng.currentModeKind())
+	}
+
+	sendKeyAt(t, eng, caps, 1, 2000)
+	sendKeyAt(t, eng, caps, 0, 2050)
+	if events := forwarded(); len(events) != 0 || eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected a tap to toggle without forwarding, got %+v (mode %v)", events, eng.currentModeKind())
+	}
+}
+
+func TestEngineTapChordUndoesAutoSwitch(t *testing.T) {
+	shift := uint16(linux.KeyLeftShift)
+	eng, out := newTestEngine(t, withAuto("latin"), withToggle(func(toggle *config.ToggleConfig) {
+		toggle.Auto.Undo = []config.ToggleChord{{Key: shift, Trigger: config.TriggerTap}}
+	}))
+
+	typeKeys(t, eng, linux.KeyG, linux.KeyK, linux.KeyS, linux.KeyR, linux.KeyM, linux.KeyF)
+	out.buffer = []rune("gksrmf")
+	pressKey(t, eng, linux.KeySpace)
+	out.buffer = append(out.buffer, ' ')
+	sendKeyAt(t, eng, shift, 1, 0)
+	sendKeyAt(t, eng, shift, 0, 50)
+	if got := out.String(); got != "gksrmf" || eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected a Shift tap to undo the switch, got %q (mode %v)", got, eng.currentModeKind())
+	}
+}
@@ -0,0 +1,181 @@
+package engine
+
+import (
+	"strconv"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/focus"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/util"
+)
+
+// modeRule is a [rules] entry with its mode resolved; mode is -1 for
+// bypass rules.
+type modeRule struct {
+	config.Rule
+	mode int
+}
+
+func (r *modeRule) matches(ctx focus.Context) bool {
+	return r.Matches(windowField(ctx, r.Field))
+}
+
+// windowField returns the field of a window that [rules] and [paste]
+// entries match against.
+func windowField(ctx focus.Context, field string) string {
+	switch field {
+	case "instance":
+		return ctx.Instance
+	case "process":
+		return ctx.Process
+	case "title":
+		return ctx.Title
+	}
+	return ctx.Class
+}
+
+// SetFocusProvider follows the focus changes reported by provider. They
+// drive per-window modes, [rules] and the [auto] exclude list.
+func (e *Engine) SetFocusProvider(provider focus.Provider) error {
+	changes, err := provider.Watch()
+	if err != nil {
+		return err
+	}
+	go func() {
+		for ctx := range changes {
+			e.setFocus(ctx)
+		}
+	}()
+	return nil
+}
+
+// setFocus applies a focus change as soon as it is reported, so the mode
+// and the LED follow the focused window before the next key. It is safe to
+// call from any goroutine; an output error is returned with the next event.
+func (e *Engine) setFocus(ctx focus.Context) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.applyFocus(ctx); err != nil && e.focusErr == nil {
+		e.focusErr = err
+	}
+}
+
+// applyFocus saves the mode of the window that lost focus and picks the
+// mode of the focused one: a forced mode first, then the remembered one,
+// then a rule's default mode. Windows seen for the first time start in the
+// default mode when modes are remembered per window.
+func (e *Engine) applyFocus(ctx focus.Context) error {
+	if e.focusSeen && ctx == e.focusCtx {
+		return nil
+	}
+	if e.windowModes == nil {
+		e.windowModes = make(map[string]int)
+	}
+	remember := e.toggle.Remember != config.RememberOff
+	// Modes forced by a rule are not the user's choice; keep them out of
+	// the memory. Without per-window memory, only unruled windows share
+	// the global mode.
+	if e.rule == nil || (remember && e.rule.Action == config.RuleDefault) {
+		if remember && e.focusSeen {
+			e.windowModes[e.focusKey] = e.modeIndex
+		} else if !remember {
+			e.windowModes[""] = e.modeIndex
+		}
+	}
+
+	e.focusSeen = true
+	e.focusCtx = ctx
+	e.focusKey = e.memoryKey(e.focusCtx)
+	e.rule = nil
+	for i := range e.rules {
+		if e.rules[i].matches(e.focusCtx) {
+			e.rule = &e.rules[i]
+			break
+		}
+	}
+	e.paste = nil
+	for i := range e.toggle.Paste.Apps {
+		app := &e.toggle.Paste.Apps[i]
+		if app.Matches(windowField(e.focusCtx, app.Field)) {
+			e.paste = app
+			break
+		}
+	}
+	if err := e.settlePreedit(); err != nil {
+		return err
+	}
+
+	target := e.modeIndex
+	remembered, ok := e.windowModes[e.focusKey]
+	switch {
+	case e.rule != nil && e.rule.Action == config.RuleBypass:
+	case e.rule != nil && e.rule.Action == config.RuleForce:
+		target = e.rule.mode
+	case ok && (remember || e.rule == nil):
+		target = remembered
+	case e.rule != nil:
+		target = e.rule.mode
+	case remember:
+		target = e.defaultIndex
+	}
+	if target != e.modeIndex {
+		e.setMode(target)
+	}
+	return nil
+}
+
+// memoryKey names the slot a window's mode is remembered in; "" is the
+// single global slot used when modes are not remembered.
+func (e *Engine) memoryKey(ctx focus.Context) string {
+	switch e.toggle.Remember {
+	case config.RememberWindow:
+		return strconv.FormatUint(uint64(ctx.Window), 10)
+	case config.RememberClass:
+		return ctx.Class
+	}
+	return ""
+}
+
+// modeLocked reports whether a force rule holds the focused window in its
+// mode. Mode switching keys then act as ordinary keys.
+func (e *Engine) modeLocked() bool {
+	return e.rule != nil && e.rule.Action == config.RuleForce
+}
+
+func (e *Engine) bypassed() bool {
+	return e.rule != nil && e.rule.Action == config.RuleBypass
+}
+
+// passThrough forwards an event unchanged while keeping the modifier and
+// key bookkeeping that lets keys held across a focus change be released
+// correctly afterwards.
+func (e *Engine) passThrough(event *util.InputEvent) error {
+	if event.Type != linux.EvKey {
+		return e.emitter.ForwardEvent(event)
+	}
+	if contains(modifierKeys, event.Code) {
+		e.modifierState[event.Code] = isKeyPress(event)
+		e.forwardedModifiers[event.Code] = isKeyPress(event)
+	}
+	return e.forwardKeyEvent(event)
+}
+
+// settlePreedit ends the composition before the mode changes. Focus has
+// already moved when the change is reported: a Hangul syllable drawn by
+// typing stays behind in the window that showed it, already the text it
+// would commit. Anything else, a candidate list or a syllable the output
+// never showed, is committed the usual way.
+func (e *Engine) settlePreedit() error {
+	if composer := e.currentComposerIfHangul(); composer != nil && e.hanja == nil && !e.nativePreedit && e.preeditShown != "" {
+		composer.Flush()
+		e.preedit = ""
+		e.preeditShown = ""
+	}
+	if err := e.commitPreedit(); err != nil {
+		return err
+	}
+	e.recentHangul = nil
+	e.wordKeys = nil
+	e.autoUndo = nil
+	return nil
+}
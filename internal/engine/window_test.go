@@ -0,0 +1,235 @@
+package engine
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gg582/hanfe/internal/config"
+	"github.com/gg582/hanfe/internal/focus"
+	"github.com/gg582/hanfe/internal/linux"
+	"github.com/gg582/hanfe/internal/types"
+)
+
+type fakeProvider struct {
+	changes chan focus.Context
+}
+
+func (p *fakeProvider) Active() (focus.Context, error) { return focus.Context{}, nil }
+
+func (p *fakeProvider) Watch() (<-chan focus.Context, error) { return p.changes, nil }
+
+func (p *fakeProvider) Close() error {
+	close(p.changes)
+	return nil
+}
+
+// sendFocus reports ctx through provider and waits until the engine has
+// applied it.
+func sendFocus(t *testing.T, eng *Engine, provider *fakeProvider, ctx focus.Context) {
+	t.Helper()
+	provider.changes <- ctx
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		eng.mu.Lock()
+		applied := eng.focusSeen && eng.focusCtx == ctx
+		eng.mu.Unlock()
+		if applied {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Fatalf("focus change %+v was not applied", ctx)
+}
+
+// withRemember remembers the input mode per window or class.
+func withRemember(remember config.RememberMode) func(*testSetup) {
+	return func(s *testSetup) { s.toggle.Remember = remember }
+}
+
+// withRules sets the [rules] entries.
+func withRules(rules ...config.Rule) func(*testSetup) {
+	return func(s *testSetup) { s.toggle.Rules = rules }
+}
+
+func TestEngineRemembersModePerWindow(t *testing.T) {
+	eng, out := newTestEngine(t, withRemember(config.RememberWindow))
+	provider := &fakeProvider{changes: make(chan focus.Context)}
+	if err := eng.SetFocusProvider(provider); err != nil {
+		t.Fatalf("SetFocusProvider: %v", err)
+	}
+	defer provider.Close()
+	editor := focus.Context{Window: 1, Class: "Gedit"}
+	terminal := focus.Context{Window: 2, Class: "XTerm"}
+	sendFocus(t, eng, provider, editor)
+
+	typeKeys(t, eng, linux.KeyG, linux.KeyK)
+	if eng.preedit != "하" {
+		t.Fatalf("expected 하 composing, got %q", eng.preedit)
+	}
+
+	// The terminal starts in the default mode; the syllable stays behind
+	// in the editor and nothing is sent on its behalf.
+	sent := len(out.texts)
+	sendFocus(t, eng, provider, terminal)
+	pressKey(t, eng, linux.KeyRightAlt)
+	if len(out.texts) != sent || eng.preedit != "" {
+		t.Fatalf("expected the preedit to be left in place, sent %q preedit %q", out.texts[sent:], eng.preedit)
+	}
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected the toggle to switch the terminal to Latin")
+	}
+
+	eng.setFocus(editor)
+	if eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected the editor's mode to return with the focus change")
+	}
+	pressKey(t, eng, linux.KeyK)
+	if eng.currentModeKind() != types.ModeHangul || eng.preedit != "ㅏ" {
+		t.Fatalf("expected the editor to return to Hangul with a fresh syllable, got mode %v preedit %q", eng.currentModeKind(), eng.preedit)
+	}
+
+	eng.setFocus(terminal)
+	pressKey(t, eng, linux.KeyK)
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected the terminal to stay in Latin mode")
+	}
+}
+
+func TestEngineFocusChangeSettlesComposition(t *testing.T) {
+	// A candidate list is no text to leave behind; the selected candidate
+	// replaces it.
+	eng, out := newTestEngine(t, withPinyin, withRemember(config.RememberWindow))
+	eng.setFocus(focus.Context{Window: 1})
+	typeKeys(t, eng, linux.KeyN, linux.KeyI)
+	eng.setFocus(focus.Context{Window: 2})
+	if got := out.String(); got != "你" || eng.pinyinBuffer != "" || eng.preedit != "" {
+		t.Fatalf("expected the candidate list to be committed, got %q (buffer %q)", got, eng.pinyinBuffer)
+	}
+
+	// Without preedit support the syllable was never shown; it is sent
+	// rather than lost.
+	eng, out = newTestEngine(t, withRemember(config.RememberWindow))
+	out.supportsPreedit = false
+	eng.setFocus(focus.Context{Window: 1})
+	typeKeys(t, eng, linux.KeyG, linux.KeyK)
+	eng.setFocus(focus.Context{Window: 2})
+	if got := out.String(); got != "하" || eng.preedit != "" {
+		t.Fatalf("expected the syllable to be committed, got %q (preedit %q)", got, eng.preedit)
+	}
+}
+
+func TestEngineFocusRules(t *testing.T) {
+	eng, out := newTestEngine(t, withRules(
+		config.Rule{Field: "class", Pattern: "*term*", Action: config.RuleForce, Mode: "latin"},
+		config.Rule{Field: "process", Pattern: "steam_app_*", Action: config.RuleBypass},
+		config.Rule{Field: "class", Pattern: "firefox", Action: config.RuleDefault, Mode: "latin"},
+	))
+
+	// A forced window ignores the toggle key, which reaches the
+	// application like any other key.
+	eng.setFocus(focus.Context{Window: 1, Class: "XTerm"})
+	pressKey(t, eng, linux.KeyRightAlt)
+	if eng.currentModeKind() != types.ModeLatin {
+		t.Fatalf("expected the forced window to stay in Latin, got %v", eng.currentModeKind())
+	}
+	if len(out.forwarded) == 0 || out.forwarded[0].Code != uint16(linux.KeyRightAlt) {
+		t.Fatalf("expected the toggle key to be forwarded, got %+v", out.forwarded)
+	}
+
+	// Leaving restores the global mode.
+	eng.setFocus(focus.Context{Window: 2, Class: "Gedit"})
+	pressKey(t, eng, linux.KeyG)
+	if eng.currentModeKind() != types.ModeHangul || eng.preedit != "ㅎ" {
+		t.Fatalf("expected Hangul outside the forced window, got %v %q", eng.currentModeKind(), eng.preedit)
+	}
+
+	// A bypassed window gets every key unchanged, Hangul mode or not.
+	out.forwarded = nil
+	eng.setFocus(focus.Context{Window: 3, Class: "Game", Process: "steam_app_42"})
+	pressKey(t, eng, linux.KeyK)
+	pressKey(t, eng, linux.KeyRightAlt)
+	if len(out.forwarded) != 4 || eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected four forwarded events and no toggle, got %+v (mode %v)", out.forwarded, eng.currentModeKind())
+	}
+
+	// A default rule picks the mode on focus without locking it.
+	eng.setFocus(focus.Context{Window: 4, Class: "Firefox"})
+	pressKey(t, eng, linux.KeyRightAlt)
+	if eng.currentModeKind() != types.ModeHangul {
+		t.Fatalf("expected the default rule to start in Latin and allow toggling")
+	}
+}
+
+func TestEngineRuleUnknownMode(t *testing.T) {
+	toggle := config.DefaultToggleConfig()
+	toggle.Rules = []config.Rule{{Field: "class", Pattern: "xterm", Action: config.RuleForce, Mode: "pinyin"}}
+	modes := []ModeSpec{{Name: "latin", Kind: types.ModeLatin}}
+	if _, err := NewEngine(0, modes, toggle, &fakeEmitter{}); err == nil {
+		t.Fatalf("expected an error for a rule naming a missing mode")
+	}
+}
+
+type fakePasteEmitter struct {
+	fakeEmitter
+	pasted []string
+	keys   []bool
+	err    error
+}
+
+func (f *fakePasteEmitter) PasteText(text string, shiftInsert bool) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.pasted = append(f.pasted, text)
+	f.keys = append(f.keys, shiftInsert)
+	return nil
+}
+
+func TestEnginePastesLongCommits(t *testing.T) {
+	out := &fakePasteEmitter{}
+	eng, _ := newTestEngine(t, withEmitter(out), withToggle(func(toggle *config.ToggleConfig) {
+		toggle.Paste = config.PasteConfig{Threshold: 3, Apps: []config.PasteRule{
+			{Field: "class", Pattern: "*term*", ShiftInsert: true},
+			{Field: "title", Pattern: "*LibreOffice*"},
+		}}
+	}))
+	var warnings []error
+	eng.SetWarningHandler(func(err error) { warnings = append(warnings, err) })
+	send := func(text string) {
+		t.Helper()
+		if err := eng.sendText(text); err != nil {
+			t.Fatalf("sendText: %v", err)
+		}
+	}
+
+	// Unlisted windows are always typed.
+	eng.setFocus(focus.Context{Window: 1, Class: "Gedit"})
+	send("한글입력")
+	if len(out.pasted) != 0 || len(out.texts) != 1 {
+		t.Fatalf("expected the commit to be typed, pasted %q", out.pasted)
+	}
+
+	eng.setFocus(focus.Context{Window: 2, Class: "XTerm"})
+	send("한글")
+	send("한글입력")
+	if len(out.texts) != 2 || len(out.pasted) != 1 || out.pasted[0] != "한글입력" || !out.keys[0] {
+		t.Fatalf("expected only the long commit pasted with Shift+Insert, typed %q pasted %q", out.texts, out.pasted)
+	}
+
+	eng.setFocus(focus.Context{Window: 3, Class: "Soffice", Title: "Untitled 1 - LibreOffice Writer"})
+	send("가나다")
+	if len(out.pasted) != 2 || out.keys[1] {
+		t.Fatalf("expected a Ctrl+V paste, pasted %q", out.pasted)
+	}
+
+	// A failed paste is typed instead.
+	out.err = errors.New("selection holds no text")
+	send("라마바사")
+	if len(out.pasted) != 2 || out.texts[len(out.texts)-1] != "라마바사" {
+		t.Fatalf("expected the text to be typed after a failed paste, typed %q", out.texts)
+	}
+	if len(warnings) != 1 || !errors.Is(warnings[0], out.err) {
+		t.Fatalf("expected the failed paste to be reported, got %v", warnings)
+	}
+}
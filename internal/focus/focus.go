@@ -0,0 +1,23 @@
+// Package focus reports which application has keyboard focus.
+package focus
+
+// Context describes the focused window.
+type Context struct {
+	Window   uint32
+	Instance string
+	Class    string
+	Process  string
+	Title    string
+}
+
+// Provider reports the focused window and follows focus changes.
+type Provider interface {
+	// Active returns the focused window.
+	Active() (Context, error)
+	// Watch reports the focused window now and after every change. The
+	// channel is closed when the provider is closed.
+	Watch() (<-chan Context, error)
+	Close() error
+}
+
+var _ Provider = (*X11)(nil)
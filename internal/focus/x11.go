@@ -0,0 +1,161 @@
+package focus
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+// X11 looks up the focused window through the EWMH _NET_ACTIVE_WINDOW
+// property of the root window.
+type X11 struct {
+	conn         *xgb.Conn
+	root         xproto.Window
+	activeWindow xproto.Atom
+	wmPID        xproto.Atom
+	wmName       xproto.Atom
+	utf8String   xproto.Atom
+	mu           sync.Mutex
+}
+
+// OpenX11 connects to $DISPLAY.
+func OpenX11() (*X11, error) {
+	display := os.Getenv("DISPLAY")
+	if display == "" {
+		return nil, fmt.Errorf("DISPLAY not set")
+	}
+	conn, err := xgb.NewConnDisplay(display)
+	if err != nil {
+		return nil, fmt.Errorf("connect to X display: %w", err)
+	}
+	atoms := make([]xproto.Atom, 4)
+	for i, name := range []string{"_NET_ACTIVE_WINDOW", "_NET_WM_PID", "_NET_WM_NAME", "UTF8_STRING"} {
+		reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("intern %s: %w", name, err)
+		}
+		atoms[i] = reply.Atom
+	}
+	root := xproto.Setup(conn).DefaultScreen(conn).Root
+	return &X11{conn: conn, root: root, activeWindow: atoms[0], wmPID: atoms[1], wmName: atoms[2], utf8String: atoms[3]}, nil
+}
+
+// ActiveClass returns the WM_CLASS class of the focused window, or "" when
+// no window is focused.
+func (x *X11) ActiveClass() (string, error) {
+	ctx, err := x.Active()
+	if err != nil {
+		return "", err
+	}
+	return ctx.Class, nil
+}
+
+// Active returns the focused window. The zero Context means none.
+func (x *X11) Active() (Context, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	reply, err := xproto.GetProperty(x.conn, false, x.root, x.activeWindow, xproto.AtomWindow, 0, 1).Reply()
+	if err != nil {
+		return Context{}, fmt.Errorf("read _NET_ACTIVE_WINDOW: %w", err)
+	}
+	if reply.Format != 32 || len(reply.Value) < 4 {
+		return Context{}, nil
+	}
+	window := xproto.Window(xgb.Get32(reply.Value))
+	if window == 0 {
+		return Context{}, nil
+	}
+	class, err := xproto.GetProperty(x.conn, false, window, xproto.AtomWmClass, xproto.AtomString, 0, 64).Reply()
+	if err != nil {
+		return Context{}, fmt.Errorf("read WM_CLASS: %w", err)
+	}
+	ctx := Context{Window: uint32(window)}
+	ctx.Instance, ctx.Class = ParseWMClass(class.Value)
+	ctx.Title = x.title(window)
+	if pid, err := xproto.GetProperty(x.conn, false, window, x.wmPID, xproto.AtomCardinal, 0, 1).Reply(); err == nil && pid.Format == 32 && len(pid.Value) >= 4 {
+		ctx.Process = processName(int(xgb.Get32(pid.Value)))
+	}
+	return ctx, nil
+}
+
+// title reads _NET_WM_NAME, falling back to WM_NAME.
+func (x *X11) title(window xproto.Window) string {
+	reply, err := xproto.GetProperty(x.conn, false, window, x.wmName, x.utf8String, 0, 256).Reply()
+	if err == nil && len(reply.Value) > 0 {
+		return string(reply.Value)
+	}
+	reply, err = xproto.GetProperty(x.conn, false, window, xproto.AtomWmName, xproto.AtomString, 0, 256).Reply()
+	if err != nil {
+		return ""
+	}
+	return string(reply.Value)
+}
+
+// processName returns the command name of pid from /proc.
+func processName(pid int) string {
+	if pid <= 0 {
+		return ""
+	}
+	comm, err := os.ReadFile("/proc/" + strconv.Itoa(pid) + "/comm")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(comm))
+}
+
+// Watch reports the focused window now and after every change of
+// _NET_ACTIVE_WINDOW. The channel is closed when the connection closes.
+func (x *X11) Watch() (<-chan Context, error) {
+	mask := []uint32{xproto.EventMaskPropertyChange}
+	if err := xproto.ChangeWindowAttributesChecked(x.conn, x.root, xproto.CwEventMask, mask).Check(); err != nil {
+		return nil, fmt.Errorf("watch root window: %w", err)
+	}
+	changes := make(chan Context, 1)
+	go func() {
+		defer close(changes)
+		last, err := x.Active()
+		if err == nil {
+			changes <- last
+		}
+		for {
+			ev, xerr := x.conn.WaitForEvent()
+			if ev == nil && xerr == nil {
+				return
+			}
+			notify, ok := ev.(xproto.PropertyNotifyEvent)
+			if !ok || notify.Window != x.root || notify.Atom != x.activeWindow {
+				continue
+			}
+			ctx, err := x.Active()
+			if err != nil || ctx.Window == last.Window {
+				continue
+			}
+			last = ctx
+			changes <- ctx
+		}
+	}()
+	return changes, nil
+}
+
+func (x *X11) Close() error {
+	x.conn.Close()
+	return nil
+}
+
+// ParseWMClass splits a WM_CLASS value, two NUL-terminated strings, into
+// the instance and class names.
+func ParseWMClass(value []byte) (string, string) {
+	parts := strings.Split(strings.TrimRight(string(value), "\x00"), "\x00")
+	instance := parts[0]
+	class := instance
+	if len(parts) > 1 {
+		class = parts[1]
+	}
+	return instance, class
+}
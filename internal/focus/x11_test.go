@@ -0,0 +1,99 @@
+package focus
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/BurntSushi/xgb"
+	"github.com/BurntSushi/xgb/xproto"
+)
+
+func TestParseWMClass(t *testing.T) {
+	cases := []struct {
+		value    string
+		instance string
+		class    string
+	}{
+		{"navigator\x00Firefox\x00", "navigator", "Firefox"},
+		{"xterm\x00", "xterm", "xterm"},
+		{"", "", ""},
+	}
+	for _, tc := range cases {
+		instance, class := ParseWMClass([]byte(tc.value))
+		if instance != tc.instance || class != tc.class {
+			t.Errorf("ParseWMClass(%q) = %q, %q; want %q, %q", tc.value, instance, class, tc.instance, tc.class)
+		}
+	}
+}
+
+func TestX11ActiveClass(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY not set")
+	}
+	x, err := OpenX11()
+	if err != nil {
+		t.Skipf("open X display: %v", err)
+	}
+	defer x.Close()
+	if _, err := x.ActiveClass(); err != nil {
+		t.Fatalf("ActiveClass: %v", err)
+	}
+}
+
+// TestX11Watch needs an X server without a window manager, such as Xvfb:
+// it sets _NET_ACTIVE_WINDOW itself.
+func TestX11Watch(t *testing.T) {
+	if os.Getenv("DISPLAY") == "" {
+		t.Skip("DISPLAY not set")
+	}
+	x, err := OpenX11()
+	if err != nil {
+		t.Skipf("open X display: %v", err)
+	}
+	defer x.Close()
+
+	conn, err := xgb.NewConn()
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer conn.Close()
+	screen := xproto.Setup(conn).DefaultScreen(conn)
+	window, err := xproto.NewWindowId(conn)
+	if err != nil {
+		t.Fatalf("allocate window: %v", err)
+	}
+	err = xproto.CreateWindowChecked(conn, screen.RootDepth, window, screen.Root, 0, 0, 10, 10, 0,
+		xproto.WindowClassInputOutput, screen.RootVisual, 0, nil).Check()
+	if err != nil {
+		t.Fatalf("create window: %v", err)
+	}
+	class := []byte("hanfe-test\x00HanfeTest\x00")
+	err = xproto.ChangePropertyChecked(conn, xproto.PropModeReplace, window, xproto.AtomWmClass,
+		xproto.AtomString, 8, uint32(len(class)), class).Check()
+	if err != nil {
+		t.Fatalf("set WM_CLASS: %v", err)
+	}
+
+	changes, err := x.Watch()
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+	<-changes // the window focused when watching starts
+
+	value := make([]byte, 4)
+	xgb.Put32(value, uint32(window))
+	err = xproto.ChangePropertyChecked(conn, xproto.PropModeReplace, screen.Root, x.activeWindow,
+		xproto.AtomWindow, 32, 1, value).Check()
+	if err != nil {
+		t.Fatalf("set _NET_ACTIVE_WINDOW: %v", err)
+	}
+	select {
+	case got := <-changes:
+		if got.Window != uint32(window) || got.Class != "HanfeTest" || got.Instance != "hanfe-test" {
+			t.Fatalf("expected window %d HanfeTest, got %+v", window, got)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no focus change reported")
+	}
+}
@@ -1,5 +1,10 @@
 package hangul
 
+import (
+	"fmt"
+	"strings"
+)
+
 type JamoRole int
 
 const (
@@ -17,12 +22,69 @@ type HangulComposer struct {
 	leading  *rune
 	vowel    *rune
 	trailing *rune
+	// explicitTrailing marks a final consonant typed with RoleTrailing. Such
+	// a final stays in its syllable when a vowel follows.
+	explicitTrailing bool
+	// moachigi lets jamo of one syllable arrive in any order; see SetMoachigi.
+	moachigi bool
+	// oldHangul enables archaic clusters and conjoining output; see
+	// SetOldHangul.
+	oldHangul bool
+	backspace BackspacePolicy
+}
+
+// BackspacePolicy selects what Backspace removes from a syllable.
+type BackspacePolicy string
+
+const (
+	// BackspaceJamo removes the last jamo, splitting compounds one part at
+	// a time (ㅄ → ㅂ, ㅘ → ㅗ).
+	BackspaceJamo BackspacePolicy = "jamo"
+	// BackspaceSyllable discards the whole syllable being composed, like
+	// libhangul's erase-syllable mode.
+	BackspaceSyllable BackspacePolicy = "syllable"
+	// BackspaceReopen removes jamo like BackspaceJamo and, once nothing is
+	// being composed, lets the caller Reopen the last committed syllable.
+	BackspaceReopen BackspacePolicy = "reopen"
+)
+
+// ParseBackspacePolicy validates a backspace policy name from the config
+// file. The empty string selects BackspaceJamo.
+func ParseBackspacePolicy(name string) (BackspacePolicy, error) {
+	switch policy := BackspacePolicy(strings.ToLower(strings.TrimSpace(name))); policy {
+	case "", BackspaceJamo:
+		return BackspaceJamo, nil
+	case BackspaceSyllable, BackspaceReopen:
+		return policy, nil
+	}
+	return BackspaceJamo, fmt.Errorf("unknown backspace policy '%s'", name)
 }
 
 func NewHangulComposer() *HangulComposer {
 	return &HangulComposer{}
 }
 
+// SetMoachigi enables order-independent ("moachigi") composition for
+// layouts whose consonant keys carry explicit roles. Each jamo fills its
+// slot in the current syllable (vowels the medial, RoleTrailing consonants
+// the final, other consonants the initial) regardless of the order in which
+// the keys arrive; a new syllable starts only when the slot is already taken
+// and the jamo cannot combine with it.
+func (c *HangulComposer) SetMoachigi(enabled bool) {
+	c.moachigi = enabled
+}
+
+func (c *HangulComposer) SetBackspacePolicy(policy BackspacePolicy) {
+	c.backspace = policy
+}
+
+func (c *HangulComposer) BackspacePolicy() BackspacePolicy {
+	if c.backspace == "" {
+		return BackspaceJamo
+	}
+	return c.backspace
+}
+
 func runePtr(r rune) *rune {
 	v := r
 	return &v
@@ -81,8 +143,8 @@ var (
 )
 
 var (
-	consonantSet = buildSet(append(append([]rune{}, choList...), filterZero(jongList)...))
-	vowelSet     = buildSet(jungList)
+	consonantSet = buildSet(append(append(append([]rune{}, choList...), filterZero(jongList)...), archaicConsonants...))
+	vowelSet     = buildSet(append(append([]rune{}, jungList...), archaicVowels...))
 )
 
 func invertDouble(src map[[2]rune]rune) map[rune][2]rune {
@@ -131,11 +193,16 @@ func isVowel(ch rune) bool {
 
 func (c *HangulComposer) Feed(ch rune, role JamoRole) CompositionResult {
 	var commit []rune
-	if isVowel(ch) {
+	if c.moachigi {
+		commit = c.feedMoachigi(ch, role)
+	} else if isVowel(ch) {
 		commit = c.handleVowel(ch)
 	} else {
 		commit = c.handleConsonant(ch, role)
 	}
+	if c.trailing == nil {
+		c.explicitTrailing = false
+	}
 	result := CompositionResult{
 		Commit:  string(commit),
 		Preedit: string(c.currentPreedit()),
@@ -144,17 +211,25 @@ func (c *HangulComposer) Feed(ch rune, role JamoRole) CompositionResult {
 }
 
 func (c *HangulComposer) Backspace() (string, bool) {
+	if c.backspace == BackspaceSyllable {
+		if c.leading == nil && c.vowel == nil && c.trailing == nil {
+			return "", false
+		}
+		c.reset()
+		return "", true
+	}
 	if c.trailing != nil {
-		if pair, ok := finalDecompose[*c.trailing]; ok {
+		if pair, ok := splitFinal(*c.trailing); ok {
 			first := pair[0]
 			c.trailing = runePtr(first)
 		} else {
 			c.trailing = nil
+			c.explicitTrailing = false
 		}
 		return string(c.currentPreedit()), true
 	}
 	if c.vowel != nil {
-		if pair, ok := medialDecompose[*c.vowel]; ok {
+		if pair, ok := splitMedial(*c.vowel); ok {
 			first := pair[0]
 			c.vowel = runePtr(first)
 		} else {
@@ -163,7 +238,7 @@ func (c *HangulComposer) Backspace() (string, bool) {
 		return string(c.currentPreedit()), true
 	}
 	if c.leading != nil {
-		if pair, ok := initialDecompose[*c.leading]; ok {
+		if pair, ok := splitInitial(*c.leading); ok {
 			first := pair[0]
 			c.leading = runePtr(first)
 		} else {
@@ -174,11 +249,40 @@ func (c *HangulComposer) Backspace() (string, bool) {
 	return "", false
 }
 
+// Reopen loads a committed syllable, or a lone jamo, back into an empty
+// composer so that it can be edited again. It reports false when the
+// composer is busy or text is not a single syllable it can represent.
+func (c *HangulComposer) Reopen(text string) bool {
+	runes := []rune(text)
+	if len(runes) != 1 || c.leading != nil || c.vowel != nil || c.trailing != nil {
+		return false
+	}
+	r := runes[0]
+	switch {
+	case r >= syllableBase && r <= syllableLast:
+		index := int(r - syllableBase)
+		c.leading = runePtr(choList[index/(jungseongLen*jongseongLen)])
+		c.vowel = runePtr(jungList[index%(jungseongLen*jongseongLen)/jongseongLen])
+		if tail := index % jongseongLen; tail != 0 {
+			c.trailing = runePtr(jongList[tail])
+		}
+	case isVowel(r):
+		c.vowel = runePtr(r)
+	case isConsonant(r):
+		c.leading = runePtr(r)
+	default:
+		return false
+	}
+	c.explicitTrailing = false
+	return true
+}
+
 func (c *HangulComposer) Flush() string {
 	commit := string(c.compose())
 	c.leading = nil
 	c.vowel = nil
 	c.trailing = nil
+	c.explicitTrailing = false
 	return commit
 }
 
@@ -198,6 +302,12 @@ func (c *HangulComposer) handleConsonant(ch rune, role JamoRole) []rune {
 	}
 
 	if forceLeading {
+		if c.vowel == nil {
+			if combined, ok := c.combineInitial(*c.leading, ch); ok {
+				c.leading = runePtr(combined)
+				return commit
+			}
+		}
 		commit = c.compose()
 		c.leading = runePtr(ch)
 		c.vowel = nil
@@ -206,8 +316,7 @@ func (c *HangulComposer) handleConsonant(ch rune, role JamoRole) []rune {
 	}
 
 	if c.vowel == nil {
-		pair := [2]rune{*c.leading, ch}
-		if combined, ok := doubleInitial[pair]; ok {
+		if combined, ok := c.combineInitial(*c.leading, ch); ok {
 			c.leading = runePtr(combined)
 		} else {
 			commit = append(commit, *c.leading)
@@ -217,12 +326,15 @@ func (c *HangulComposer) handleConsonant(ch rune, role JamoRole) []rune {
 	}
 
 	if forceTrailing {
-		return c.attachTrailing(ch)
+		commit = c.attachTrailing(ch)
+		c.explicitTrailing = c.trailing != nil
+		return commit
 	}
 
 	if c.trailing == nil {
 		if isConsonant(ch) {
 			c.trailing = runePtr(ch)
+			c.explicitTrailing = false
 			return commit
 		}
 		commit = c.compose()
@@ -232,8 +344,7 @@ func (c *HangulComposer) handleConsonant(ch rune, role JamoRole) []rune {
 		return commit
 	}
 
-	pair := [2]rune{*c.trailing, ch}
-	if combined, ok := doubleFinal[pair]; ok {
+	if combined, ok := c.combineFinal(*c.trailing, ch); ok {
 		c.trailing = runePtr(combined)
 	} else {
 		commit = c.compose()
@@ -252,8 +363,17 @@ func (c *HangulComposer) handleVowel(ch rune) []rune {
 		return commit
 	}
 
+	if c.trailing != nil && c.explicitTrailing {
+		commit = c.compose()
+		c.leading = nil
+		c.vowel = runePtr(ch)
+		c.trailing = nil
+		c.explicitTrailing = false
+		return commit
+	}
+
 	if c.trailing != nil {
-		if split, ok := finalDecompose[*c.trailing]; ok {
+		if split, ok := splitFinal(*c.trailing); ok {
 			first := split[0]
 			second := split[1]
 			c.trailing = runePtr(first)
@@ -272,8 +392,7 @@ func (c *HangulComposer) handleVowel(ch rune) []rune {
 		return commit
 	}
 
-	pair := [2]rune{*c.vowel, ch}
-	if combined, ok := doubleMedial[pair]; ok {
+	if combined, ok := c.combineMedial(*c.vowel, ch); ok {
 		c.vowel = runePtr(combined)
 		return commit
 	}
@@ -299,8 +418,7 @@ func (c *HangulComposer) attachTrailing(ch rune) []rune {
 		return commit
 	}
 
-	pair := [2]rune{*c.trailing, ch}
-	if combined, ok := doubleFinal[pair]; ok {
+	if combined, ok := c.combineFinal(*c.trailing, ch); ok {
 		c.trailing = runePtr(combined)
 		return commit
 	}
@@ -312,27 +430,85 @@ func (c *HangulComposer) attachTrailing(ch rune) []rune {
 	return commit
 }
 
+func (c *HangulComposer) feedMoachigi(ch rune, role JamoRole) []rune {
+	switch {
+	case isVowel(ch):
+		if c.vowel == nil {
+			c.vowel = runePtr(ch)
+			return nil
+		}
+		if combined, ok := c.combineMedial(*c.vowel, ch); ok {
+			c.vowel = runePtr(combined)
+			return nil
+		}
+		commit := c.compose()
+		c.reset()
+		c.vowel = runePtr(ch)
+		return commit
+	case role == RoleTrailing:
+		if c.trailing == nil {
+			c.trailing = runePtr(ch)
+			c.explicitTrailing = true
+			return nil
+		}
+		if combined, ok := c.combineFinal(*c.trailing, ch); ok {
+			c.trailing = runePtr(combined)
+			return nil
+		}
+		commit := c.compose()
+		c.reset()
+		c.trailing = runePtr(ch)
+		c.explicitTrailing = true
+		return commit
+	default:
+		if c.leading == nil {
+			c.leading = runePtr(ch)
+			return nil
+		}
+		if c.vowel == nil && c.trailing == nil {
+			if combined, ok := c.combineInitial(*c.leading, ch); ok {
+				c.leading = runePtr(combined)
+				return nil
+			}
+		}
+		commit := c.compose()
+		c.reset()
+		c.leading = runePtr(ch)
+		return commit
+	}
+}
+
+func (c *HangulComposer) reset() {
+	c.leading = nil
+	c.vowel = nil
+	c.trailing = nil
+	c.explicitTrailing = false
+}
+
 func (c *HangulComposer) compose() []rune {
-	if c.leading == nil && c.vowel == nil {
+	if c.leading == nil && c.vowel == nil && c.trailing == nil {
 		return []rune{}
 	}
 	if c.leading != nil && c.vowel != nil {
-		leadIdx := choseongIndex[*c.leading]
-		vowelIdx := jungseongIndex[*c.vowel]
-		tailIdx := 0
-		if c.trailing != nil {
-			tailIdx = jongseongIndex[*c.trailing]
+		if syllable, ok := precompose(*c.leading, *c.vowel, c.trailing); ok {
+			return []rune{syllable}
+		}
+		if c.oldHangul {
+			if jamo, ok := conjoin(*c.leading, *c.vowel, c.trailing); ok {
+				return jamo
+			}
 		}
-		codepoint := rune(0xAC00 + ((leadIdx*21)+vowelIdx)*28 + tailIdx)
-		return []rune{codepoint}
-	}
-	if c.leading != nil {
-		return []rune{*c.leading}
 	}
-	if c.vowel != nil {
-		return []rune{*c.vowel}
+	// An incomplete syllable is shown as its jamo in initial, medial,
+	// final order; outside moachigi only one of them can be present. A
+	// syllable that cannot be composed is spelled out the same way.
+	var out []rune
+	for _, part := range []*rune{c.leading, c.vowel, c.trailing} {
+		if part != nil {
+			out = append(out, *part)
+		}
 	}
-	return []rune{}
+	return out
 }
 
 func (c *HangulComposer) currentPreedit() []rune {
@@ -201,3 +201,188 @@ func TestHangulComposerCarryTrailingToLeading(t *testing.T) {
 		t.Fatalf("expected flush to commit trailing syllable '자'")
 	}
 }
+
+func TestHangulComposerExplicitTrailingKeepsSyllable(t *testing.T) {
+	composer := NewHangulComposer()
+
+	composer.Feed('ㄱ', RoleLeading)
+	composer.Feed('ㅏ', RoleAuto)
+	composer.Feed('ㅂ', RoleTrailing)
+
+	result := composer.Feed('ㅏ', RoleAuto)
+	if result.Commit != "갑" {
+		t.Fatalf("expected explicit final to stay in '갑', got commit %q", result.Commit)
+	}
+	if result.Preedit != "ㅏ" {
+		t.Fatalf("expected the vowel to start a new syllable, got %q", result.Preedit)
+	}
+}
+
+func TestHangulComposerDoubleLeadingRole(t *testing.T) {
+	composer := NewHangulComposer()
+
+	composer.Feed('ㄱ', RoleLeading)
+	result := composer.Feed('ㄱ', RoleLeading)
+	if result.Commit != "" || result.Preedit != "ㄲ" {
+		t.Fatalf("expected repeated leading ㄱ to form 'ㄲ', got commit %q preedit %q", result.Commit, result.Preedit)
+	}
+}
+
+func TestHangulComposerMoachigiReordersJamo(t *testing.T) {
+	composer := NewHangulComposer()
+	composer.SetMoachigi(true)
+
+	// 한 typed as final, vowel, initial.
+	composer.Feed('ㄴ', RoleTrailing)
+	composer.Feed('ㅏ', RoleAuto)
+	result := composer.Feed('ㅎ', RoleLeading)
+	if result.Commit != "" || result.Preedit != "한" {
+		t.Fatalf("expected jamo in any order to form '한', got commit %q preedit %q", result.Commit, result.Preedit)
+	}
+
+	// The next initial starts a new syllable.
+	result = composer.Feed('ㄱ', RoleLeading)
+	if result.Commit != "한" || result.Preedit != "ㄱ" {
+		t.Fatalf("expected '한' to commit when the initial slot is taken, got commit %q preedit %q", result.Commit, result.Preedit)
+	}
+
+	// 글 typed as vowel, final, initial.
+	composer.Flush()
+	composer.Feed('ㅡ', RoleAuto)
+	composer.Feed('ㄹ', RoleTrailing)
+	if got := composer.Flush(); got != "ㅡㄹ" {
+		t.Fatalf("expected incomplete syllable to flush as its jamo, got %q", got)
+	}
+}
+
+func TestHangulComposerMoachigiCombinesWithinSlot(t *testing.T) {
+	composer := NewHangulComposer()
+	composer.SetMoachigi(true)
+
+	composer.Feed('ㅏ', RoleAuto)
+	composer.Feed('ㄱ', RoleAuto)
+	composer.Feed('ㄱ', RoleTrailing)
+	result := composer.Feed('ㅅ', RoleTrailing)
+	if result.Preedit != "갃" {
+		t.Fatalf("expected compound final in moachigi, got %q", result.Preedit)
+	}
+
+	result = composer.Feed('ㅗ', RoleAuto)
+	if result.Commit != "갃" || result.Preedit != "ㅗ" {
+		t.Fatalf("expected a second vowel to start a new syllable, got commit %q preedit %q", result.Commit, result.Preedit)
+	}
+}
+
+func TestHangulComposerOldHangulConjoiningOutput(t *testing.T) {
+	composer := NewHangulComposer()
+	composer.SetOldHangul(true)
+
+	composer.Feed('ㅎ', RoleAuto)
+	composer.Feed('ㆍ', RoleAuto)
+	result := composer.Feed('ㄴ', RoleAuto)
+	if result.Preedit != "ᄒᆞᆫ" {
+		t.Fatalf("expected conjoining jamo for an archaic vowel, got %q", result.Preedit)
+	}
+
+	composer.Flush()
+	composer.Feed('ㄱ', RoleAuto)
+	if result := composer.Feed('ㅏ', RoleAuto); result.Preedit != "가" {
+		t.Fatalf("expected modern syllables to stay precomposed, got %q", result.Preedit)
+	}
+}
+
+func TestHangulComposerOldHangulClusters(t *testing.T) {
+	composer := NewHangulComposer()
+	composer.SetOldHangul(true)
+
+	composer.Feed('ㅅ', RoleAuto)
+	composer.Feed('ㄱ', RoleAuto)
+	result := composer.Feed('ㅏ', RoleAuto)
+	if result.Commit != "" || result.Preedit != "ᄭᅡ" {
+		t.Fatalf("expected ㅺ initial cluster, got commit %q preedit %q", result.Commit, result.Preedit)
+	}
+
+	// A cluster final splits when a vowel follows, like modern finals.
+	composer.Flush()
+	composer.Feed('ㅇ', RoleAuto)
+	composer.Feed('ㅗ', RoleAuto)
+	composer.Feed('ㅅ', RoleAuto)
+	composer.Feed('ㄱ', RoleAuto)
+	result = composer.Feed('ㅏ', RoleAuto)
+	if result.Commit != "옷" || result.Preedit != "가" {
+		t.Fatalf("expected cluster final to split, got commit %q preedit %q", result.Commit, result.Preedit)
+	}
+
+	if _, ok := composer.Backspace(); !ok {
+		t.Fatalf("expected backspace to edit the syllable")
+	}
+	composer.Flush()
+	composer.Feed('ㆍ', RoleAuto)
+	if result := composer.Feed('ㅣ', RoleAuto); result.Preedit != "ㆎ" {
+		t.Fatalf("expected ㆍ+ㅣ to combine, got %q", result.Preedit)
+	}
+}
+
+func TestHangulComposerModernIgnoresOldClusters(t *testing.T) {
+	composer := NewHangulComposer()
+
+	composer.Feed('ㅅ', RoleAuto)
+	result := composer.Feed('ㄱ', RoleAuto)
+	if result.Commit != "ㅅ" || result.Preedit != "ㄱ" {
+		t.Fatalf("expected ㅅ to commit outside Old Hangul mode, got commit %q preedit %q", result.Commit, result.Preedit)
+	}
+}
+
+func TestHangulComposerBackspaceSyllablePolicy(t *testing.T) {
+	composer := NewHangulComposer()
+	composer.SetBackspacePolicy(BackspaceSyllable)
+
+	composer.Feed('ㄱ', RoleAuto)
+	composer.Feed('ㅗ', RoleAuto)
+	composer.Feed('ㅏ', RoleAuto)
+	composer.Feed('ㅂ', RoleAuto)
+	composer.Feed('ㅅ', RoleAuto)
+	preedit, ok := composer.Backspace()
+	if !ok || preedit != "" {
+		t.Fatalf("expected the whole syllable to be erased, got %q (%v)", preedit, ok)
+	}
+	if _, ok := composer.Backspace(); ok {
+		t.Fatalf("expected backspace on an empty composer to report false")
+	}
+}
+
+func TestHangulComposerReopen(t *testing.T) {
+	composer := NewHangulComposer()
+	if !composer.Reopen("괎") {
+		t.Fatalf("expected a precomposed syllable to reopen")
+	}
+	for _, want := range []string{"괍", "과", "고", "ㄱ", ""} {
+		if preedit, ok := composer.Backspace(); !ok || preedit != want {
+			t.Fatalf("expected %q after backspace, got %q (%v)", want, preedit, ok)
+		}
+	}
+
+	if !composer.Reopen("ㅏ") || composer.Flush() != "ㅏ" {
+		t.Fatalf("expected a lone jamo to reopen")
+	}
+	composer.Feed('ㄱ', RoleAuto)
+	if composer.Reopen("가") {
+		t.Fatalf("expected reopen to refuse while composing")
+	}
+	composer.Flush()
+	if composer.Reopen("a") || composer.Reopen("가나") {
+		t.Fatalf("expected reopen to refuse non-Hangul text")
+	}
+}
+
+func TestParseBackspacePolicy(t *testing.T) {
+	if policy, err := ParseBackspacePolicy(""); err != nil || policy != BackspaceJamo {
+		t.Fatalf("expected jamo by default, got %q (%v)", policy, err)
+	}
+	if policy, err := ParseBackspacePolicy("Reopen"); err != nil || policy != BackspaceReopen {
+		t.Fatalf("expected reopen, got %q (%v)", policy, err)
+	}
+	if _, err := ParseBackspacePolicy("word"); err == nil {
+		t.Fatalf("expected an error for an unknown policy")
+	}
+}
@@ -0,0 +1,132 @@
+package hangul
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Normalization selects how composed Hangul is written to the output.
+type Normalization string
+
+const (
+	// NormalizeNone passes text through unchanged: precomposed syllables,
+	// with incomplete syllables as compatibility jamo.
+	NormalizeNone Normalization = ""
+	// NormalizeNFC composes modern conjoining jamo sequences into
+	// precomposed syllables.
+	NormalizeNFC Normalization = "nfc"
+	// NormalizeNFD decomposes precomposed syllables into conjoining jamo.
+	NormalizeNFD Normalization = "nfd"
+	// NormalizeFiller writes compatibility jamo as conjoining jamo padded
+	// with the choseong and jungseong fillers, as KS X 1026-1 does for
+	// incomplete syllables.
+	NormalizeFiller Normalization = "filler"
+)
+
+const (
+	syllableBase  = 0xAC00
+	syllableLast  = 0xD7A3
+	choseongBase  = 0x1100
+	jungseongBase = 0x1161
+	jongseongBase = 0x11A7
+	choseongCount = 19
+	jungseongLen  = 21
+	jongseongLen  = 28
+
+	choseongFiller  = 0x115F
+	jungseongFiller = 0x1160
+)
+
+// ParseNormalization validates a normalization name from the config file.
+func ParseNormalization(name string) (Normalization, error) {
+	switch form := Normalization(strings.ToLower(strings.TrimSpace(name))); form {
+	case NormalizeNone, "none":
+		return NormalizeNone, nil
+	case NormalizeNFC, NormalizeNFD, NormalizeFiller:
+		return form, nil
+	}
+	return NormalizeNone, fmt.Errorf("unknown normalization '%s'", name)
+}
+
+// Normalize rewrites the Hangul in text according to form. Other characters
+// are left untouched.
+func Normalize(text string, form Normalization) string {
+	switch form {
+	case NormalizeNFC:
+		return composeConjoining(text)
+	case NormalizeNFD:
+		return decomposeSyllables(text)
+	case NormalizeFiller:
+		return fillCompatibilityJamo(text)
+	default:
+		return text
+	}
+}
+
+func decomposeSyllables(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		if r < syllableBase || r > syllableLast {
+			b.WriteRune(r)
+			continue
+		}
+		index := int(r - syllableBase)
+		b.WriteRune(rune(choseongBase + index/(jungseongLen*jongseongLen)))
+		b.WriteRune(rune(jungseongBase + index%(jungseongLen*jongseongLen)/jongseongLen))
+		if tail := index % jongseongLen; tail != 0 {
+			b.WriteRune(rune(jongseongBase + tail))
+		}
+	}
+	return b.String()
+}
+
+func composeConjoining(text string) string {
+	runes := []rune(text)
+	out := make([]rune, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		lead := runes[i] - choseongBase
+		if lead < 0 || lead >= choseongCount || i+1 >= len(runes) {
+			out = append(out, runes[i])
+			continue
+		}
+		vowel := runes[i+1] - jungseongBase
+		if vowel < 0 || vowel >= jungseongLen {
+			out = append(out, runes[i])
+			continue
+		}
+		syllable := syllableBase + (lead*jungseongLen+vowel)*jongseongLen
+		i++
+		if i+1 < len(runes) {
+			if tail := runes[i+1] - jongseongBase; tail > 0 && tail < jongseongLen {
+				syllable += tail
+				i++
+			}
+		}
+		out = append(out, syllable)
+	}
+	return string(out)
+}
+
+func fillCompatibilityJamo(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		forms, ok := conjoiningJamo[r]
+		if !ok {
+			b.WriteRune(r)
+			continue
+		}
+		switch {
+		case forms[1] != 0:
+			b.WriteRune(choseongFiller)
+			b.WriteRune(forms[1])
+		case forms[0] != 0:
+			b.WriteRune(forms[0])
+			b.WriteRune(jungseongFiller)
+		default:
+			b.WriteRune(choseongFiller)
+			b.WriteRune(jungseongFiller)
+			b.WriteRune(forms[2])
+		}
+	}
+	return b.String()
+}
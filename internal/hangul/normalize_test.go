@@ -0,0 +1,46 @@
+package hangul
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	cases := []struct {
+		form Normalization
+		in   string
+		want string
+	}{
+		{NormalizeNone, "한ㄱ", "한ㄱ"},
+		{NormalizeNFD, "한글 a", "\u1112\u1161\u11AB\u1100\u1173\u11AF a"},
+		{NormalizeNFD, "ㄱ", "ㄱ"},
+		{NormalizeNFC, "\u1112\u1161\u11AB\u1100\u1173", "한그"},
+		{NormalizeNFC, "\u1112\u119E\u11AB", "\u1112\u119E\u11AB"},
+		{NormalizeFiller, "가ㄱ", "가\u1100\u1160"},
+		{NormalizeFiller, "ㅏ", "\u115F\u1161"},
+		{NormalizeFiller, "ㄳ", "\u115F\u1160\u11AA"},
+	}
+	for _, tc := range cases {
+		if got := Normalize(tc.in, tc.form); got != tc.want {
+			t.Errorf("Normalize(%q, %q) = %+q, want %+q", tc.in, tc.form, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeRoundTrip(t *testing.T) {
+	for r := rune(syllableBase); r <= syllableLast; r++ {
+		decomposed := Normalize(string(r), NormalizeNFD)
+		if got := Normalize(decomposed, NormalizeNFC); got != string(r) {
+			t.Fatalf("round trip of %U gave %+q", r, got)
+		}
+	}
+}
+
+func TestParseNormalization(t *testing.T) {
+	if form, err := ParseNormalization("NFD"); err != nil || form != NormalizeNFD {
+		t.Fatalf("expected nfd, got %q (%v)", form, err)
+	}
+	if form, err := ParseNormalization("none"); err != nil || form != NormalizeNone {
+		t.Fatalf("expected none, got %q (%v)", form, err)
+	}
+	if _, err := ParseNormalization("nfkc"); err == nil {
+		t.Fatalf("expected an error for an unknown normalization")
+	}
+}
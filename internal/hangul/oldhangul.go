@@ -0,0 +1,268 @@
+package hangul
+
+// Old Hangul (옛한글) support. The composer keeps working with compatibility
+// jamo internally; archaic letters and clusters that have no precomposed
+// syllable are written out as conjoining jamo instead.
+
+var (
+	archaicConsonants = []rune{
+		'ㅥ', 'ㅦ', 'ㅧ', 'ㅨ', 'ㅩ', 'ㅪ', 'ㅫ', 'ㅬ', 'ㅭ', 'ㅮ', 'ㅯ', 'ㅰ', 'ㅱ', 'ㅲ', 'ㅳ', 'ㅴ',
+		'ㅵ', 'ㅶ', 'ㅷ', 'ㅸ', 'ㅹ', 'ㅺ', 'ㅻ', 'ㅼ', 'ㅽ', 'ㅾ', 'ㅿ', 'ㆀ', 'ㆁ', 'ㆂ', 'ㆃ', 'ㆄ',
+		'ㆅ', 'ㆆ',
+	}
+	archaicVowels = []rune{'ㆇ', 'ㆈ', 'ㆉ', 'ㆊ', 'ㆋ', 'ㆌ', 'ㆍ', 'ㆎ'}
+)
+
+// Clusters that only exist in Old Hangul. They are combined only when the
+// composer is in Old Hangul mode so modern typing is unchanged.
+var (
+	oldDoubleInitial = map[[2]rune]rune{
+		{'ㄴ', 'ㄴ'}: 'ㅥ',
+		{'ㄴ', 'ㄷ'}: 'ㅦ',
+		{'ㄴ', 'ㅅ'}: 'ㅧ',
+		{'ㄹ', 'ㄷ'}: 'ㅪ',
+		{'ㅁ', 'ㅂ'}: 'ㅮ',
+		{'ㅁ', 'ㅅ'}: 'ㅯ',
+		{'ㅁ', 'ㅇ'}: 'ㅱ',
+		{'ㅂ', 'ㄱ'}: 'ㅲ',
+		{'ㅂ', 'ㄷ'}: 'ㅳ',
+		{'ㅂ', 'ㅅ'}: 'ㅄ',
+		{'ㅄ', 'ㄱ'}: 'ㅴ',
+		{'ㅄ', 'ㄷ'}: 'ㅵ',
+		{'ㅂ', 'ㅈ'}: 'ㅶ',
+		{'ㅂ', 'ㅌ'}: 'ㅷ',
+		{'ㅂ', 'ㅇ'}: 'ㅸ',
+		{'ㅃ', 'ㅇ'}: 'ㅹ',
+		{'ㅅ', 'ㄱ'}: 'ㅺ',
+		{'ㅅ', 'ㄴ'}: 'ㅻ',
+		{'ㅅ', 'ㄷ'}: 'ㅼ',
+		{'ㅅ', 'ㅂ'}: 'ㅽ',
+		{'ㅅ', 'ㅈ'}: 'ㅾ',
+		{'ㅇ', 'ㅇ'}: 'ㆀ',
+		{'ㅍ', 'ㅇ'}: 'ㆄ',
+		{'ㅎ', 'ㅎ'}: 'ㆅ',
+	}
+	oldDoubleMedial = map[[2]rune]rune{
+		{'ㅛ', 'ㅑ'}: 'ㆇ',
+		{'ㅛ', 'ㅒ'}: 'ㆈ',
+		{'ㅛ', 'ㅣ'}: 'ㆉ',
+		{'ㅠ', 'ㅕ'}: 'ㆊ',
+		{'ㅠ', 'ㅖ'}: 'ㆋ',
+		{'ㅠ', 'ㅣ'}: 'ㆌ',
+		{'ㆍ', 'ㅣ'}: 'ㆎ',
+	}
+	oldDoubleFinal = map[[2]rune]rune{
+		{'ㄴ', 'ㄴ'}: 'ㅥ',
+		{'ㄴ', 'ㄷ'}: 'ㅦ',
+		{'ㄴ', 'ㅅ'}: 'ㅧ',
+		{'ㄴ', 'ㅿ'}: 'ㅨ',
+		{'ㄺ', 'ㅅ'}: 'ㅩ',
+		{'ㄹ', 'ㄷ'}: 'ㅪ',
+		{'ㄼ', 'ㅅ'}: 'ㅫ',
+		{'ㄹ', 'ㅿ'}: 'ㅬ',
+		{'ㄹ', 'ㆆ'}: 'ㅭ',
+		{'ㅁ', 'ㅂ'}: 'ㅮ',
+		{'ㅁ', 'ㅅ'}: 'ㅯ',
+		{'ㅁ', 'ㅿ'}: 'ㅰ',
+		{'ㅁ', 'ㅇ'}: 'ㅱ',
+		{'ㅂ', 'ㄷ'}: 'ㅳ',
+		{'ㅄ', 'ㄷ'}: 'ㅵ',
+		{'ㅂ', 'ㅈ'}: 'ㅶ',
+		{'ㅂ', 'ㅇ'}: 'ㅸ',
+		{'ㅅ', 'ㄱ'}: 'ㅺ',
+		{'ㅅ', 'ㄷ'}: 'ㅼ',
+		{'ㅅ', 'ㅂ'}: 'ㅽ',
+		{'ㅅ', 'ㅈ'}: 'ㅾ',
+		{'ㅇ', 'ㅇ'}: 'ㆀ',
+		{'ㆁ', 'ㅅ'}: 'ㆂ',
+		{'ㆁ', 'ㅿ'}: 'ㆃ',
+		{'ㅍ', 'ㅇ'}: 'ㆄ',
+	}
+)
+
+var (
+	oldInitialDecompose = invertDouble(oldDoubleInitial)
+	oldMedialDecompose  = invertDouble(oldDoubleMedial)
+	oldFinalDecompose   = invertDouble(oldDoubleFinal)
+)
+
+// conjoiningJamo maps each compatibility jamo to its conjoining initial,
+// medial and final forms (U+1100–U+11FF, U+A960–U+A97F, U+D7B0–U+D7FF).
+// A zero entry means the letter has no form in that position.
+var conjoiningJamo = map[rune][3]rune{
+	'ㄱ': {0x1100, 0, 0x11A8},
+	'ㄲ': {0x1101, 0, 0x11A9},
+	'ㄳ': {0, 0, 0x11AA},
+	'ㄴ': {0x1102, 0, 0x11AB},
+	'ㄵ': {0x115C, 0, 0x11AC},
+	'ㄶ': {0x115D, 0, 0x11AD},
+	'ㄷ': {0x1103, 0, 0x11AE},
+	'ㄸ': {0x1104, 0, 0xD7CD},
+	'ㄹ': {0x1105, 0, 0x11AF},
+	'ㄺ': {0xA964, 0, 0x11B0},
+	'ㄻ': {0xA968, 0, 0x11B1},
+	'ㄼ': {0xA969, 0, 0x11B2},
+	'ㄽ': {0xA96C, 0, 0x11B3},
+	'ㄾ': {0, 0, 0x11B4},
+	'ㄿ': {0, 0, 0x11B5},
+	'ㅀ': {0x111A, 0, 0x11B6},
+	'ㅁ': {0x1106, 0, 0x11B7},
+	'ㅂ': {0x1107, 0, 0x11B8},
+	'ㅃ': {0x1108, 0, 0xD7E6},
+	'ㅄ': {0x1121, 0, 0x11B9},
+	'ㅅ': {0x1109, 0, 0x11BA},
+	'ㅆ': {0x110A, 0, 0x11BB},
+	'ㅇ': {0x110B, 0, 0x11BC},
+	'ㅈ': {0x110C, 0, 0x11BD},
+	'ㅉ': {0x110D, 0, 0xD7F9},
+	'ㅊ': {0x110E, 0, 0x11BE},
+	'ㅋ': {0x110F, 0, 0x11BF},
+	'ㅌ': {0x1110, 0, 0x11C0},
+	'ㅍ': {0x1111, 0, 0x11C1},
+	'ㅎ': {0x1112, 0, 0x11C2},
+	'ㅏ': {0, 0x1161, 0},
+	'ㅐ': {0, 0x1162, 0},
+	'ㅑ': {0, 0x1163, 0},
+	'ㅒ': {0, 0x1164, 0},
+	'ㅓ': {0, 0x1165, 0},
+	'ㅔ': {0, 0x1166, 0},
+	'ㅕ': {0, 0x1167, 0},
+	'ㅖ': {0, 0x1168, 0},
+	'ㅗ': {0, 0x1169, 0},
+	'ㅘ': {0, 0x116A, 0},
+	'ㅙ': {0, 0x116B, 0},
+	'ㅚ': {0, 0x116C, 0},
+	'ㅛ': {0, 0x116D, 0},
+	'ㅜ': {0, 0x116E, 0},
+	'ㅝ': {0, 0x116F, 0},
+	'ㅞ': {0, 0x1170, 0},
+	'ㅟ': {0, 0x1171, 0},
+	'ㅠ': {0, 0x1172, 0},
+	'ㅡ': {0, 0x1173, 0},
+	'ㅢ': {0, 0x1174, 0},
+	'ㅣ': {0, 0x1175, 0},
+	'ㅥ': {0x1114, 0, 0x11FF},
+	'ㅦ': {0x1115, 0, 0x11C6},
+	'ㅧ': {0x115B, 0, 0x11C7},
+	'ㅨ': {0, 0, 0x11C8},
+	'ㅩ': {0, 0, 0x11CC},
+	'ㅪ': {0xA966, 0, 0x11CE},
+	'ㅫ': {0, 0, 0x11D3},
+	'ㅬ': {0, 0, 0x11D7},
+	'ㅭ': {0, 0, 0x11D9},
+	'ㅮ': {0x111C, 0, 0x11DC},
+	'ㅯ': {0xA971, 0, 0x11DD},
+	'ㅰ': {0, 0, 0x11DF},
+	'ㅱ': {0x111D, 0, 0x11E2},
+	'ㅲ': {0x111E, 0, 0},
+	'ㅳ': {0x1120, 0, 0xD7E3},
+	'ㅴ': {0x1122, 0, 0},
+	'ㅵ': {0x1123, 0, 0xD7E7},
+	'ㅶ': {0x1127, 0, 0xD7E8},
+	'ㅷ': {0x1129, 0, 0},
+	'ㅸ': {0x112B, 0, 0x11E6},
+	'ㅹ': {0x112C, 0, 0},
+	'ㅺ': {0x112D, 0, 0x11E7},
+	'ㅻ': {0x112E, 0, 0},
+	'ㅼ': {0x112F, 0, 0x11E8},
+	'ㅽ': {0x1132, 0, 0x11EA},
+	'ㅾ': {0x1136, 0, 0xD7EF},
+	'ㅿ': {0x1140, 0, 0x11EB},
+	'ㆀ': {0x1147, 0, 0x11EE},
+	'ㆁ': {0x114C, 0, 0x11F0},
+	'ㆂ': {0, 0, 0x11F1},
+	'ㆃ': {0, 0, 0x11F2},
+	'ㆄ': {0x1157, 0, 0x11F4},
+	'ㆅ': {0x1158, 0, 0},
+	'ㆆ': {0x1159, 0, 0x11F9},
+	'ㆇ': {0, 0x1184, 0},
+	'ㆈ': {0, 0x1185, 0},
+	'ㆉ': {0, 0x1188, 0},
+	'ㆊ': {0, 0x1191, 0},
+	'ㆋ': {0, 0x1192, 0},
+	'ㆌ': {0, 0x1194, 0},
+	'ㆍ': {0, 0x119E, 0},
+	'ㆎ': {0, 0x11A1, 0},
+}
+
+// SetOldHangul enables archaic jamo clusters and conjoining jamo output for
+// syllables that have no precomposed form.
+func (c *HangulComposer) SetOldHangul(enabled bool) {
+	c.oldHangul = enabled
+}
+
+func (c *HangulComposer) combineInitial(first, second rune) (rune, bool) {
+	return c.combine(doubleInitial, oldDoubleInitial, first, second)
+}
+
+func (c *HangulComposer) combineMedial(first, second rune) (rune, bool) {
+	return c.combine(doubleMedial, oldDoubleMedial, first, second)
+}
+
+func (c *HangulComposer) combineFinal(first, second rune) (rune, bool) {
+	return c.combine(doubleFinal, oldDoubleFinal, first, second)
+}
+
+func (c *HangulComposer) combine(modern, old map[[2]rune]rune, first, second rune) (rune, bool) {
+	pair := [2]rune{first, second}
+	if combined, ok := modern[pair]; ok {
+		return combined, true
+	}
+	if c.oldHangul {
+		if combined, ok := old[pair]; ok {
+			return combined, true
+		}
+	}
+	return 0, false
+}
+
+func splitInitial(ch rune) ([2]rune, bool) { return split(initialDecompose, oldInitialDecompose, ch) }
+
+func splitMedial(ch rune) ([2]rune, bool) { return split(medialDecompose, oldMedialDecompose, ch) }
+
+func splitFinal(ch rune) ([2]rune, bool) { return split(finalDecompose, oldFinalDecompose, ch) }
+
+func split(modern, old map[rune][2]rune, ch rune) ([2]rune, bool) {
+	if pair, ok := modern[ch]; ok {
+		return pair, true
+	}
+	pair, ok := old[ch]
+	return pair, ok
+}
+
+// precompose returns the U+AC00 syllable for the given jamo when one exists.
+func precompose(leading, vowel rune, trailing *rune) (rune, bool) {
+	leadIdx, ok := choseongIndex[leading]
+	if !ok {
+		return 0, false
+	}
+	vowelIdx, ok := jungseongIndex[vowel]
+	if !ok {
+		return 0, false
+	}
+	tailIdx := 0
+	if trailing != nil {
+		if tailIdx, ok = jongseongIndex[*trailing]; !ok || tailIdx == 0 {
+			return 0, false
+		}
+	}
+	return rune(0xAC00 + ((leadIdx*21)+vowelIdx)*28 + tailIdx), true
+}
+
+// conjoin spells a syllable as a sequence of conjoining jamo.
+func conjoin(leading, vowel rune, trailing *rune) ([]rune, bool) {
+	lead := conjoiningJamo[leading][0]
+	medial := conjoiningJamo[vowel][1]
+	if lead == 0 || medial == 0 {
+		return nil, false
+	}
+	out := []rune{lead, medial}
+	if trailing != nil {
+		final := conjoiningJamo[*trailing][2]
+		if final == 0 {
+			return nil, false
+		}
+		out = append(out, final)
+	}
+	return out, true
+}
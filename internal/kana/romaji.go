@@ -0,0 +1,233 @@
+package kana
+
+import "strings"
+
+type CompositionResult struct {
+	Commit  string
+	Preedit string
+}
+
+// RomajiComposer converts Hepburn and kunrei romaji into kana. Completed
+// kana are committed right away; letters that may still start a longer
+// sequence ("k", "ky", a lone "n") stay in the preedit.
+type RomajiComposer struct {
+	pending  []rune
+	katakana bool
+}
+
+func NewRomajiComposer() *RomajiComposer {
+	return &RomajiComposer{}
+}
+
+var romajiTable = map[string]string{
+	"a": "あ", "i": "い", "u": "う", "e": "え", "o": "お",
+	"ka": "か", "ki": "き", "ku": "く", "ke": "け", "ko": "こ",
+	"kya": "きゃ", "kyi": "きぃ", "kyu": "きゅ", "kye": "きぇ", "kyo": "きょ",
+	"ga": "が", "gi": "ぎ", "gu": "ぐ", "ge": "げ", "go": "ご",
+	"gya": "ぎゃ", "gyi": "ぎぃ", "gyu": "ぎゅ", "gye": "ぎぇ", "gyo": "ぎょ",
+	"sa": "さ", "si": "し", "su": "す", "se": "せ", "so": "そ",
+	"shi": "し", "sha": "しゃ", "shu": "しゅ", "she": "しぇ", "sho": "しょ",
+	"sya": "しゃ", "syi": "しぃ", "syu": "しゅ", "sye": "しぇ", "syo": "しょ",
+	"za": "ざ", "zi": "じ", "zu": "ず", "ze": "ぜ", "zo": "ぞ",
+	"zya": "じゃ", "zyi": "じぃ", "zyu": "じゅ", "zye": "じぇ", "zyo": "じょ",
+	"ja": "じゃ", "ji": "じ", "ju": "じゅ", "je": "じぇ", "jo": "じょ",
+	"jya": "じゃ", "jyi": "じぃ", "jyu": "じゅ", "jye": "じぇ", "jyo": "じょ",
+	"ta": "た", "ti": "ち", "tu": "つ", "te": "て", "to": "と",
+	"chi": "ち", "cha": "ちゃ", "chu": "ちゅ", "che": "ちぇ", "cho": "ちょ",
+	"tya": "ちゃ", "tyi": "ちぃ", "tyu": "ちゅ", "tye": "ちぇ", "tyo": "ちょ",
+	"cya": "ちゃ", "cyi": "ちぃ", "cyu": "ちゅ", "cye": "ちぇ", "cyo": "ちょ",
+	"tsu": "つ", "tsa": "つぁ", "tsi": "つぃ", "tse": "つぇ", "tso": "つぉ",
+	"tha": "てゃ", "thi": "てぃ", "thu": "てゅ", "the": "てぇ", "tho": "てょ",
+	"twu": "とぅ",
+	"da":  "だ", "di": "ぢ", "du": "づ", "de": "で", "do": "ど",
+	"dya": "ぢゃ", "dyi": "ぢぃ", "dyu": "ぢゅ", "dye": "ぢぇ", "dyo": "ぢょ",
+	"dha": "でゃ", "dhi": "でぃ", "dhu": "でゅ", "dhe": "でぇ", "dho": "でょ",
+	"dwu": "どぅ",
+	"na":  "な", "ni": "に", "nu": "ぬ", "ne": "ね", "no": "の",
+	"nya": "にゃ", "nyi": "にぃ", "nyu": "にゅ", "nye": "にぇ", "nyo": "にょ",
+	"nn": "ん", "n'": "ん", "xn": "ん",
+	"ha": "は", "hi": "ひ", "hu": "ふ", "he": "へ", "ho": "ほ",
+	"hya": "ひゃ", "hyi": "ひぃ", "hyu": "ひゅ", "hye": "ひぇ", "hyo": "ひょ",
+	"fa": "ふぁ", "fi": "ふぃ", "fu": "ふ", "fe": "ふぇ", "fo": "ふぉ",
+	"fya": "ふゃ", "fyu": "ふゅ", "fyo": "ふょ",
+	"ba": "ば", "bi": "び", "bu": "ぶ", "be": "べ", "bo": "ぼ",
+	"bya": "びゃ", "byi": "びぃ", "byu": "びゅ", "bye": "びぇ", "byo": "びょ",
+	"pa": "ぱ", "pi": "ぴ", "pu": "ぷ", "pe": "ぺ", "po": "ぽ",
+	"pya": "ぴゃ", "pyi": "ぴぃ", "pyu": "ぴゅ", "pye": "ぴぇ", "pyo": "ぴょ",
+	"ma": "ま", "mi": "み", "mu": "む", "me": "め", "mo": "も",
+	"mya": "みゃ", "myi": "みぃ", "myu": "みゅ", "mye": "みぇ", "myo": "みょ",
+	"ya": "や", "yi": "い", "yu": "ゆ", "ye": "いぇ", "yo": "よ",
+	"ra": "ら", "ri": "り", "ru": "る", "re": "れ", "ro": "ろ",
+	"rya": "りゃ", "ryi": "りぃ", "ryu": "りゅ", "rye": "りぇ", "ryo": "りょ",
+	"wa": "わ", "wi": "うぃ", "wu": "う", "we": "うぇ", "wo": "を",
+	"wyi": "ゐ", "wye": "ゑ",
+	"va": "ゔぁ", "vi": "ゔぃ", "vu": "ゔ", "ve": "ゔぇ", "vo": "ゔぉ",
+	"xa": "ぁ", "xi": "ぃ", "xu": "ぅ", "xe": "ぇ", "xo": "ぉ",
+	"la": "ぁ", "li": "ぃ", "lu": "ぅ", "le": "ぇ", "lo": "ぉ",
+	"xya": "ゃ", "xyu": "ゅ", "xyo": "ょ", "lya": "ゃ", "lyu": "ゅ", "lyo": "ょ",
+	"xtu": "っ", "xtsu": "っ", "ltu": "っ", "ltsu": "っ",
+	"xwa": "ゎ", "lwa": "ゎ", "xka": "ゕ", "xke": "ゖ",
+}
+
+// symbolTable maps punctuation typed in romaji mode to its Japanese form.
+var symbolTable = map[rune]string{
+	'-': "ー",
+	',': "、",
+	'.': "。",
+	'[': "「",
+	']': "」",
+	'~': "〜",
+	'/': "・",
+}
+
+var romajiPrefixes = buildPrefixes(romajiTable)
+
+func buildPrefixes(table map[string]string) map[string]struct{} {
+	prefixes := make(map[string]struct{})
+	for key := range table {
+		for i := 1; i < len(key); i++ {
+			prefixes[key[:i]] = struct{}{}
+		}
+	}
+	return prefixes
+}
+
+// Accepts reports whether ch is handled by the composer: ASCII letters, the
+// apostrophe after "n", and the punctuation in symbolTable.
+func (c *RomajiComposer) Accepts(ch rune) bool {
+	ch = toLower(ch)
+	if ch >= 'a' && ch <= 'z' {
+		return true
+	}
+	if ch == '\'' {
+		return len(c.pending) > 0
+	}
+	_, ok := symbolTable[ch]
+	return ok
+}
+
+func (c *RomajiComposer) Feed(ch rune) CompositionResult {
+	ch = toLower(ch)
+	if symbol, ok := symbolTable[ch]; ok {
+		commit := c.Flush() + c.convert(symbol)
+		return CompositionResult{Commit: commit}
+	}
+
+	var commit strings.Builder
+	buf := string(append(c.pending, ch))
+	c.pending = nil
+	for buf != "" {
+		if kana, ok := romajiTable[buf]; ok {
+			commit.WriteString(c.convert(kana))
+			buf = ""
+			break
+		}
+		if _, ok := romajiPrefixes[buf]; ok {
+			c.pending = []rune(buf)
+			break
+		}
+		switch {
+		case buf[0] == 'n' && len(buf) > 1:
+			// A lone n before a consonant is the syllabic nasal.
+			commit.WriteString(c.convert("ん"))
+		case len(buf) > 1 && buf[0] == buf[1] && isConsonant(buf[0]):
+			// Doubled consonants become a small tsu: "tta" -> "った".
+			commit.WriteString(c.convert("っ"))
+		case buf[0] == 't' && len(buf) > 1 && buf[1] == 'c':
+			// "tch" is the Hepburn spelling of a geminated "ch".
+			commit.WriteString(c.convert("っ"))
+		default:
+			commit.WriteByte(buf[0])
+		}
+		buf = buf[1:]
+	}
+	return CompositionResult{Commit: commit.String(), Preedit: c.Preedit()}
+}
+
+// Backspace drops the last pending letter. It returns false when nothing
+// is pending so the caller can delete committed text instead.
+func (c *RomajiComposer) Backspace() (string, bool) {
+	if len(c.pending) == 0 {
+		return "", false
+	}
+	c.pending = c.pending[:len(c.pending)-1]
+	return c.Preedit(), true
+}
+
+// Flush commits whatever is pending; a trailing "n" becomes ん.
+func (c *RomajiComposer) Flush() string {
+	if len(c.pending) == 0 {
+		return ""
+	}
+	pending := string(c.pending)
+	c.pending = nil
+	if pending == "n" {
+		return c.convert("ん")
+	}
+	return pending
+}
+
+func (c *RomajiComposer) Preedit() string {
+	return string(c.pending)
+}
+
+func (c *RomajiComposer) Katakana() bool {
+	return c.katakana
+}
+
+func (c *RomajiComposer) SetKatakana(katakana bool) {
+	c.katakana = katakana
+}
+
+func (c *RomajiComposer) ToggleKatakana() bool {
+	c.katakana = !c.katakana
+	return c.katakana
+}
+
+func (c *RomajiComposer) convert(text string) string {
+	if !c.katakana {
+		return text
+	}
+	return ToKatakana(text)
+}
+
+// ToKatakana converts hiragana in text to katakana and leaves every other
+// character untouched.
+func ToKatakana(text string) string {
+	runes := []rune(text)
+	for i, r := range runes {
+		if r >= 'ぁ' && r <= 'ゖ' || r == 'ゝ' || r == 'ゞ' {
+			runes[i] = r + ('ァ' - 'ぁ')
+		}
+	}
+	return string(runes)
+}
+
+// ToHiragana is the inverse of ToKatakana.
+func ToHiragana(text string) string {
+	runes := []rune(text)
+	for i, r := range runes {
+		if r >= 'ァ' && r <= 'ヶ' || r == 'ヽ' || r == 'ヾ' {
+			runes[i] = r - ('ァ' - 'ぁ')
+		}
+	}
+	return string(runes)
+}
+
+func isConsonant(b byte) bool {
+	if b < 'a' || b > 'z' {
+		return false
+	}
+	switch b {
+	case 'a', 'i', 'u', 'e', 'o', 'n':
+		return false
+	}
+	return true
+}
+
+func toLower(ch rune) rune {
+	if ch >= 'A' && ch <= 'Z' {
+		return ch + ('a' - 'A')
+	}
+	return ch
+}
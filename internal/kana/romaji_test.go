@@ -0,0 +1,72 @@
+package kana
+
+import "testing"
+
+func typeRomaji(c *RomajiComposer, input string) (string, string) {
+	var committed string
+	preedit := ""
+	for _, ch := range input {
+		result := c.Feed(ch)
+		committed += result.Commit
+		preedit = result.Preedit
+	}
+	return committed, preedit
+}
+
+func TestRomajiComposerConvertsSequences(t *testing.T) {
+	cases := []struct {
+		input   string
+		commit  string
+		preedit string
+	}{
+		{"ka", "か", ""},
+		{"kya", "きゃ", ""},
+		{"shinbun", "しんぶ", "n"},
+		{"kitte", "きって", ""},
+		{"matcha", "まっちゃ", ""},
+		{"konnnichiha", "こんにちは", ""},
+		{"kanji", "かんじ", ""},
+		{"n'a", "んあ", ""},
+		{"ky", "", "ky"},
+		{"ra-men", "らーめ", "n"},
+		{"xtu", "っ", ""},
+	}
+	for _, tc := range cases {
+		composer := NewRomajiComposer()
+		commit, preedit := typeRomaji(composer, tc.input)
+		if commit != tc.commit || preedit != tc.preedit {
+			t.Errorf("%q: expected commit %q preedit %q, got %q %q", tc.input, tc.commit, tc.preedit, commit, preedit)
+		}
+	}
+}
+
+func TestRomajiComposerFlushAndBackspace(t *testing.T) {
+	composer := NewRomajiComposer()
+	typeRomaji(composer, "hon")
+	if got := composer.Flush(); got != "ん" {
+		t.Fatalf("expected trailing n to flush as ん, got %q", got)
+	}
+
+	typeRomaji(composer, "ky")
+	if preedit, ok := composer.Backspace(); !ok || preedit != "k" {
+		t.Fatalf("expected backspace to leave 'k', got %q (ok=%v)", preedit, ok)
+	}
+	composer.Backspace()
+	if _, ok := composer.Backspace(); ok {
+		t.Fatalf("expected backspace on empty composer to report false")
+	}
+}
+
+func TestRomajiComposerKatakana(t *testing.T) {
+	composer := NewRomajiComposer()
+	composer.ToggleKatakana()
+	if commit, _ := typeRomaji(composer, "ko-hi-"); commit != "コーヒー" {
+		t.Fatalf("expected katakana output, got %q", commit)
+	}
+	if commit, _ := typeRomaji(composer, "vu"); commit != "ヴ" {
+		t.Fatalf("expected ヴ, got %q", commit)
+	}
+	if got := ToHiragana("コーヒー"); got != "こーひー" {
+		t.Fatalf("unexpected hiragana conversion %q", got)
+	}
+}
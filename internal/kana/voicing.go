@@ -0,0 +1,144 @@
+package kana
+
+const (
+	Dakuten    = '゛'
+	Handakuten = '゜'
+
+	combiningDakuten    = '゙'
+	combiningHandakuten = '゚'
+)
+
+// VoicingComposer holds the last kana typed on a JIS kana layout in the
+// preedit so that a following dakuten or handakuten can merge with it:
+// か + ゛ → が, は + ゜ → ぱ.
+type VoicingComposer struct {
+	held   []rune
+	base   rune
+	marked bool
+}
+
+func NewVoicingComposer() *VoicingComposer {
+	return &VoicingComposer{}
+}
+
+// Feed commits the previously held kana and holds text in its place.
+func (c *VoicingComposer) Feed(text string) CompositionResult {
+	commit := c.Flush()
+	c.held = []rune(text)
+	return CompositionResult{Commit: commit, Preedit: text}
+}
+
+// Mark applies a voicing mark to the held kana. Marks that cannot combine
+// are committed as standalone characters after the held kana.
+func (c *VoicingComposer) Mark(mark rune) CompositionResult {
+	if len(c.held) > 0 {
+		last := len(c.held) - 1
+		base := c.held[last]
+		if c.marked {
+			base = c.base
+		}
+		if voiced, ok := ApplyMark(base, mark); ok {
+			c.held[last] = voiced
+			c.base = base
+			c.marked = true
+			return CompositionResult{Preedit: string(c.held)}
+		}
+	}
+	commit := c.Flush() + string(spacingMark(mark))
+	return CompositionResult{Commit: commit}
+}
+
+// Backspace removes the voicing mark first and then the held kana. It
+// returns false when nothing is held.
+func (c *VoicingComposer) Backspace() (string, bool) {
+	if len(c.held) == 0 {
+		return "", false
+	}
+	if c.marked {
+		c.held[len(c.held)-1] = c.base
+		c.marked = false
+		return string(c.held), true
+	}
+	c.held = nil
+	return "", true
+}
+
+func (c *VoicingComposer) Flush() string {
+	text := string(c.held)
+	c.held = nil
+	c.marked = false
+	return text
+}
+
+// ApplyMark returns the voiced form of kana for a dakuten or handakuten
+// mark (spacing or combining).
+func ApplyMark(kana, mark rune) (rune, bool) {
+	hira := kana
+	katakana := false
+	if kana >= 'ァ' && kana <= 'ヶ' || kana == 'ヽ' {
+		hira = kana - ('ァ' - 'ぁ')
+		katakana = true
+	}
+	voiced, ok := voiceHiragana(hira, spacingMark(mark))
+	if !ok {
+		if katakana {
+			return voiceKatakanaOnly(kana, spacingMark(mark))
+		}
+		return 0, false
+	}
+	if katakana {
+		return voiced + ('ァ' - 'ぁ'), true
+	}
+	return voiced, true
+}
+
+func voiceHiragana(r, mark rune) (rune, bool) {
+	switch mark {
+	case Dakuten:
+		switch {
+		case r >= 'か' && r <= 'ぢ' && (r-'か')%2 == 0:
+			return r + 1, true
+		case r == 'つ' || r == 'て' || r == 'と':
+			return r + 1, true
+		case r >= 'は' && r <= 'ほ' && (r-'は')%3 == 0:
+			return r + 1, true
+		case r == 'う':
+			return 'ゔ', true
+		case r == 'ゝ':
+			return 'ゞ', true
+		}
+	case Handakuten:
+		if r >= 'は' && r <= 'ほ' && (r-'は')%3 == 0 {
+			return r + 2, true
+		}
+	}
+	return 0, false
+}
+
+// voiceKatakanaOnly covers the voiced forms that only exist in katakana.
+func voiceKatakanaOnly(r, mark rune) (rune, bool) {
+	if mark != Dakuten {
+		return 0, false
+	}
+	switch r {
+	case 'ワ':
+		return 'ヷ', true
+	case 'ヰ':
+		return 'ヸ', true
+	case 'ヱ':
+		return 'ヹ', true
+	case 'ヲ':
+		return 'ヺ', true
+	}
+	return 0, false
+}
+
+func spacingMark(mark rune) rune {
+	switch mark {
+	case combiningDakuten:
+		return Dakuten
+	case combiningHandakuten:
+		return Handakuten
+	}
+	return mark
+}
@@ -0,0 +1,61 @@
+package kana
+
+import "testing"
+
+func TestApplyMark(t *testing.T) {
+	cases := []struct {
+		kana, mark, want rune
+	}{
+		{'か', Dakuten, 'が'},
+		{'ち', Dakuten, 'ぢ'},
+		{'つ', Dakuten, 'づ'},
+		{'は', Dakuten, 'ば'},
+		{'は', Handakuten, 'ぱ'},
+		{'ほ', Handakuten, 'ぽ'},
+		{'う', Dakuten, 'ゔ'},
+		{'カ', Dakuten, 'ガ'},
+		{'ヘ', Handakuten, 'ペ'},
+		{'ワ', Dakuten, 'ヷ'},
+		{'か', '゙', 'が'},
+	}
+	for _, tc := range cases {
+		got, ok := ApplyMark(tc.kana, tc.mark)
+		if !ok || got != tc.want {
+			t.Errorf("ApplyMark(%q, %q) = %q, %v; want %q", tc.kana, tc.mark, got, ok, tc.want)
+		}
+	}
+	for _, kana := range []rune{'あ', 'か', 'っ', 'ん'} {
+		if _, ok := ApplyMark(kana, Handakuten); ok {
+			t.Errorf("expected %q not to take a handakuten", kana)
+		}
+	}
+}
+
+func TestVoicingComposerHoldsLastKana(t *testing.T) {
+	composer := NewVoicingComposer()
+	if result := composer.Feed("か"); result.Commit != "" || result.Preedit != "か" {
+		t.Fatalf("expected か to be held, got %+v", result)
+	}
+	if result := composer.Mark(Dakuten); result.Commit != "" || result.Preedit != "が" {
+		t.Fatalf("expected が in preedit, got %+v", result)
+	}
+	if preedit, ok := composer.Backspace(); !ok || preedit != "か" {
+		t.Fatalf("expected backspace to remove the mark, got %q (ok=%v)", preedit, ok)
+	}
+	if result := composer.Feed("は"); result.Commit != "か" || result.Preedit != "は" {
+		t.Fatalf("expected か committed and は held, got %+v", result)
+	}
+	composer.Mark(Dakuten)
+	if result := composer.Mark(Handakuten); result.Preedit != "ぱ" {
+		t.Fatalf("expected handakuten to replace dakuten, got %+v", result)
+	}
+	if result := composer.Feed("あ"); result.Commit != "ぱ" {
+		t.Fatalf("expected ぱ to be committed, got %+v", result)
+	}
+	if result := composer.Mark(Dakuten); result.Commit != "あ゛" || result.Preedit != "" {
+		t.Fatalf("expected standalone mark after あ, got %+v", result)
+	}
+	if _, ok := composer.Backspace(); ok {
+		t.Fatalf("expected nothing held after a standalone mark")
+	}
+}
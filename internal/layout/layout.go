@@ -14,6 +14,9 @@ const (
 	SymbolPassthrough SymbolKind = iota
 	SymbolText
 	SymbolJamo
+	// SymbolKanaMark is a dakuten or handakuten that merges with the
+	// preceding kana.
+	SymbolKanaMark
 )
 
 type LayoutSymbol struct {
@@ -40,12 +43,30 @@ type Layout struct {
 	name     string
 	category Category
 	mapping  map[uint16]LayoutEntry
+	// oldHangul layouts emit archaic jamo and need a composer in Old
+	// Hangul mode.
+	oldHangul bool
 }
 
 func (l Layout) Name() string { return l.name }
 
 func (l Layout) Category() Category { return l.category }
 
+func (l Layout) OldHangul() bool { return l.oldHangul }
+
+// HasTrailing reports whether any key types a final consonant with an
+// explicit RoleTrailing, which moachigi needs to place finals.
+func (l Layout) HasTrailing() bool {
+	for _, entry := range l.mapping {
+		for _, symbol := range []*LayoutSymbol{entry.Normal, entry.Shifted} {
+			if symbol != nil && symbol.Kind == SymbolJamo && symbol.Role == hangul.RoleTrailing {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func (l Layout) Translate(code uint16, shift bool) *LayoutSymbol {
 	entry, ok := l.mapping[code]
 	if !ok {
@@ -197,10 +218,100 @@ func buildSebeolsik390() Layout {
 	return Layout{name: "sebeolsik-390", category: CategoryHangul, mapping: mapping}
 }
 
+// buildSebeolsikFinal builds the 3-91 (final) layout: initial consonants on
+// the right hand, vowels in the middle and final consonants, including the
+// compound finals on the shifted layer, on the left hand. Digits and most
+// symbols move to the shifted right hand.
+func buildSebeolsikFinal() Layout {
+	mapping := make(map[uint16]LayoutEntry)
+	passthrough := makePassthroughSymbol(true)
+
+	addEntry(mapping, linux.KeyGrave, makeTextSymbol("*", true), passthrough)
+	addEntry(mapping, linux.Key1, makeJamoSymbol('ㅎ', hangul.RoleTrailing), makeJamoSymbol('ㄲ', hangul.RoleTrailing))
+	addEntry(mapping, linux.Key2, makeJamoSymbol('ㅆ', hangul.RoleTrailing), makeJamoSymbol('ㄺ', hangul.RoleTrailing))
+	addEntry(mapping, linux.Key3, makeJamoSymbol('ㅂ', hangul.RoleTrailing), makeJamoSymbol('ㅈ', hangul.RoleTrailing))
+	addEntry(mapping, linux.Key4, makeJamo('ㅛ'), makeJamoSymbol('ㄿ', hangul.RoleTrailing))
+	addEntry(mapping, linux.Key5, makeJamo('ㅠ'), makeJamoSymbol('ㄾ', hangul.RoleTrailing))
+	addEntry(mapping, linux.Key6, makeJamo('ㅑ'), makeTextSymbol("=", true))
+	addEntry(mapping, linux.Key7, makeJamo('ㅖ'), passthrough)
+	addEntry(mapping, linux.Key8, makeJamo('ㅢ'), passthrough)
+	addEntry(mapping, linux.Key9, makeJamo('ㅜ'), makeTextSymbol("'", true))
+	addEntry(mapping, linux.Key0, makeJamoSymbol('ㅋ', hangul.RoleLeading), makeTextSymbol("~", true))
+	addEntry(mapping, linux.KeyMinus, makeTextSymbol(")", true), makeTextSymbol(";", true))
+	addEntry(mapping, linux.KeyEqual, makeTextSymbol(">", true), passthrough)
+	addEntry(mapping, linux.KeyQ, makeJamoSymbol('ㅅ', hangul.RoleTrailing), makeJamoSymbol('ㅍ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyW, makeJamoSymbol('ㄹ', hangul.RoleTrailing), makeJamoSymbol('ㅌ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyE, makeJamo('ㅕ'), makeJamoSymbol('ㄵ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyR, makeJamo('ㅐ'), makeJamoSymbol('ㅀ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyT, makeJamo('ㅓ'), makeJamoSymbol('ㄽ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyY, makeJamoSymbol('ㄹ', hangul.RoleLeading), makeTextSymbol("5", true))
+	addEntry(mapping, linux.KeyU, makeJamoSymbol('ㄷ', hangul.RoleLeading), makeTextSymbol("6", true))
+	addEntry(mapping, linux.KeyI, makeJamoSymbol('ㅁ', hangul.RoleLeading), makeTextSymbol("7", true))
+	addEntry(mapping, linux.KeyO, makeJamoSymbol('ㅊ', hangul.RoleLeading), makeTextSymbol("8", true))
+	addEntry(mapping, linux.KeyP, makeJamoSymbol('ㅍ', hangul.RoleLeading), makeTextSymbol("9", true))
+	addEntry(mapping, linux.KeyLeftBrace, makeTextSymbol("(", true), makeTextSymbol("%", true))
+	addEntry(mapping, linux.KeyRightBrace, makeTextSymbol("<", true), makeTextSymbol("/", true))
+	addEntry(mapping, linux.KeyBackslash, makeTextSymbol(":", true), makeTextSymbol("\\", true))
+	addEntry(mapping, linux.KeyA, makeJamoSymbol('ㅇ', hangul.RoleTrailing), makeJamoSymbol('ㄷ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyS, makeJamoSymbol('ㄴ', hangul.RoleTrailing), makeJamoSymbol('ㄶ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyD, makeJamo('ㅣ'), makeJamoSymbol('ㄼ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyF, makeJamo('ㅏ'), makeJamoSymbol('ㄻ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyG, makeJamo('ㅡ'), makeJamo('ㅒ'))
+	addEntry(mapping, linux.KeyH, makeJamoSymbol('ㄴ', hangul.RoleLeading), makeTextSymbol("0", true))
+	addEntry(mapping, linux.KeyJ, makeJamoSymbol('ㅇ', hangul.RoleLeading), makeTextSymbol("1", true))
+	addEntry(mapping, linux.KeyK, makeJamoSymbol('ㄱ', hangul.RoleLeading), makeTextSymbol("2", true))
+	addEntry(mapping, linux.KeyL, makeJamoSymbol('ㅈ', hangul.RoleLeading), makeTextSymbol("3", true))
+	addEntry(mapping, linux.KeySemicolon, makeJamoSymbol('ㅂ', hangul.RoleLeading), makeTextSymbol("4", true))
+	addEntry(mapping, linux.KeyApostrophe, makeJamoSymbol('ㅌ', hangul.RoleLeading), passthrough)
+	addEntry(mapping, linux.KeyZ, makeJamoSymbol('ㅁ', hangul.RoleTrailing), makeJamoSymbol('ㅊ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyX, makeJamoSymbol('ㄱ', hangul.RoleTrailing), makeJamoSymbol('ㅄ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyC, makeJamo('ㅔ'), makeJamoSymbol('ㅋ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyV, makeJamo('ㅗ'), makeJamoSymbol('ㄳ', hangul.RoleTrailing))
+	addEntry(mapping, linux.KeyB, makeJamo('ㅜ'), makeTextSymbol("?", true))
+	addEntry(mapping, linux.KeyN, makeJamoSymbol('ㅅ', hangul.RoleLeading), makeTextSymbol("-", true))
+	addEntry(mapping, linux.KeyM, makeJamoSymbol('ㅎ', hangul.RoleLeading), makeTextSymbol("\"", true))
+	addEntry(mapping, linux.KeyComma, passthrough, makeTextSymbol(",", true))
+	addEntry(mapping, linux.KeyDot, passthrough, makeTextSymbol(".", true))
+	addEntry(mapping, linux.KeySlash, makeJamo('ㅗ'), makeTextSymbol("!", true))
+
+	addEntry(mapping, linux.KeySpace, makePassthroughSymbol(true), nil)
+
+	specialKeys := []int{linux.KeyEnter, linux.KeyTab, linux.KeyEsc, linux.KeyBackspace}
+	for _, key := range specialKeys {
+		addEntry(mapping, key, makePassthroughSymbol(true), nil)
+	}
+
+	return Layout{name: "sebeolsik-final", category: CategoryHangul, mapping: mapping}
+}
+
+// buildOldHangul extends dubeolsik with archaic jamo on the shifted layer:
+// ㅿ on A, ㆁ on D, ㆆ on G and ㆍ on K. Other archaic letters are typed as
+// clusters (ㅂ+ㅇ → ㅸ, ㅅ+ㄱ → ㅺ, ㆍ+ㅣ → ㆎ).
+func buildOldHangul() Layout {
+	base := buildDubeolsik()
+	mapping := base.mapping
+	shifted := map[int]rune{
+		linux.KeyA: 'ㅿ',
+		linux.KeyD: 'ㆁ',
+		linux.KeyG: 'ㆆ',
+		linux.KeyK: 'ㆍ',
+	}
+	for key, jamo := range shifted {
+		entry := mapping[uint16(key)]
+		entry.Shifted = makeJamo(jamo)
+		mapping[uint16(key)] = entry
+	}
+	return Layout{name: "old-hangul", category: CategoryHangul, mapping: mapping, oldHangul: true}
+}
+
 func makeTextSymbol(value string, commitBefore bool) *LayoutSymbol {
 	return &LayoutSymbol{Kind: SymbolText, Text: value, CommitBefore: commitBefore}
 }
 
+func makeKanaMarkSymbol(mark rune) *LayoutSymbol {
+	return &LayoutSymbol{Kind: SymbolKanaMark, Text: string(mark)}
+}
+
 func hiraganaToKatakana(r rune) rune {
 	// Hiragana and Katakana blocks are offset by a constant value.
 	const hiraganaStart = rune(0x3041)
@@ -256,8 +367,8 @@ func buildKana86() Layout {
 	addKana(linux.KeyI, "に")
 	addKana(linux.KeyO, "ら")
 	addKana(linux.KeyP, "せ")
-	addKana(linux.KeyLeftBrace, "゛")
-	addKana(linux.KeyRightBrace, "゜")
+	addEntry(mapping, linux.KeyLeftBrace, makeKanaMarkSymbol('゛'), makeKanaMarkSymbol('゛'))
+	addEntry(mapping, linux.KeyRightBrace, makeKanaMarkSymbol('゜'), makeKanaMarkSymbol('゜'))
 
 	addKana(linux.KeyA, "ち")
 	addKana(linux.KeyS, "と")
@@ -295,7 +406,7 @@ func buildKana86() Layout {
 }
 
 func AvailableLayouts() []string {
-	names := []string{"dubeolsik", "kana86", "sebeolsik-390"}
+	names := []string{"dubeolsik", "kana86", "old-hangul", "sebeolsik-390", "sebeolsik-final"}
 	sort.Strings(names)
 	return names
 }
@@ -306,6 +417,10 @@ func Load(name string) (Layout, error) {
 		return buildDubeolsik(), nil
 	case "sebeolsik-390":
 		return buildSebeolsik390(), nil
+	case "sebeolsik-final", "sebeolsik-391":
+		return buildSebeolsikFinal(), nil
+	case "old-hangul":
+		return buildOldHangul(), nil
 	case "kana86":
 		return buildKana86(), nil
 	default:
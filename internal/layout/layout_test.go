@@ -10,7 +10,7 @@ import (
 func TestAvailableLayouts(t *testing.T) {
 	names := AvailableLayouts()
 
-	expected := []string{"dubeolsik", "kana86", "sebeolsik-390"}
+	expected := []string{"dubeolsik", "kana86", "old-hangul", "sebeolsik-390", "sebeolsik-final"}
 	if len(names) != len(expected) {
 		t.Fatalf("expected %d layouts, got %d", len(expected), len(names))
 	}
@@ -62,6 +62,53 @@ func TestLoadSebeolsikTrailingRole(t *testing.T) {
 	}
 }
 
+func TestLoadSebeolsikFinal(t *testing.T) {
+	layout, err := Load("sebeolsik-final")
+	if err != nil {
+		t.Fatalf("unexpected error loading sebeolsik-final: %v", err)
+	}
+
+	initial := layout.Translate(uint16(linux.KeyK), false)
+	if initial == nil || initial.Kind != SymbolJamo || initial.Jamo != 'ㄱ' || initial.Role != hangul.RoleLeading {
+		t.Fatalf("expected leading ㄱ for KeyK, got %#v", initial)
+	}
+
+	final := layout.Translate(uint16(linux.KeyX), false)
+	if final == nil || final.Jamo != 'ㄱ' || final.Role != hangul.RoleTrailing {
+		t.Fatalf("expected trailing ㄱ for KeyX, got %#v", final)
+	}
+
+	compound := layout.Translate(uint16(linux.KeyF), true)
+	if compound == nil || compound.Jamo != 'ㄻ' || compound.Role != hangul.RoleTrailing {
+		t.Fatalf("expected trailing ㄻ for shifted KeyF, got %#v", compound)
+	}
+
+	digit := layout.Translate(uint16(linux.KeyJ), true)
+	if digit == nil || digit.Kind != SymbolText || digit.Text != "1" {
+		t.Fatalf("expected '1' for shifted KeyJ, got %#v", digit)
+	}
+}
+
+func TestLoadOldHangul(t *testing.T) {
+	layout, err := Load("old-hangul")
+	if err != nil {
+		t.Fatalf("unexpected error loading old-hangul: %v", err)
+	}
+	if !layout.OldHangul() {
+		t.Fatalf("expected old-hangul to require Old Hangul composition")
+	}
+
+	araea := layout.Translate(uint16(linux.KeyK), true)
+	if araea == nil || araea.Kind != SymbolJamo || araea.Jamo != 'ㆍ' {
+		t.Fatalf("expected ㆍ for shifted KeyK, got %#v", araea)
+	}
+
+	modern := layout.Translate(uint16(linux.KeyK), false)
+	if modern == nil || modern.Jamo != 'ㅏ' {
+		t.Fatalf("expected ㅏ for KeyK, got %#v", modern)
+	}
+}
+
 func TestLoadKana86(t *testing.T) {
 	layout, err := Load("kana86")
 	if err != nil {
@@ -77,6 +124,11 @@ func TestLoadKana86(t *testing.T) {
 	if shifted == nil || shifted.Kind != SymbolText || shifted.Text != "タ" {
 		t.Fatalf("expected katakana for shifted KeyQ, got %#v", shifted)
 	}
+
+	mark := layout.Translate(uint16(linux.KeyLeftBrace), false)
+	if mark == nil || mark.Kind != SymbolKanaMark || mark.Text != "゛" {
+		t.Fatalf("expected dakuten mark for KeyLeftBrace, got %#v", mark)
+	}
 }
 
 func TestLoadUnknownLayout(t *testing.T) {
@@ -0,0 +1,78 @@
+package layout
+
+import "github.com/gg582/hanfe/internal/linux"
+
+type qwertyEntry struct {
+	normal  rune
+	shifted rune
+}
+
+var qwertyKeys = map[uint16]qwertyEntry{
+	uint16(linux.KeyGrave):      {'`', '~'},
+	uint16(linux.Key1):          {'1', '!'},
+	uint16(linux.Key2):          {'2', '@'},
+	uint16(linux.Key3):          {'3', '#'},
+	uint16(linux.Key4):          {'4', '$'},
+	uint16(linux.Key5):          {'5', '%'},
+	uint16(linux.Key6):          {'6', '^'},
+	uint16(linux.Key7):          {'7', '&'},
+	uint16(linux.Key8):          {'8', '*'},
+	uint16(linux.Key9):          {'9', '('},
+	uint16(linux.Key0):          {'0', ')'},
+	uint16(linux.KeyMinus):      {'-', '_'},
+	uint16(linux.KeyEqual):      {'=', '+'},
+	uint16(linux.KeyQ):          {'q', 'Q'},
+	uint16(linux.KeyW):          {'w', 'W'},
+	uint16(linux.KeyE):          {'e', 'E'},
+	uint16(linux.KeyR):          {'r', 'R'},
+	uint16(linux.KeyT):          {'t', 'T'},
+	uint16(linux.KeyY):          {'y', 'Y'},
+	uint16(linux.KeyU):          {'u', 'U'},
+	uint16(linux.KeyI):          {'i', 'I'},
+	uint16(linux.KeyO):          {'o', 'O'},
+	uint16(linux.KeyP):          {'p', 'P'},
+	uint16(linux.KeyLeftBrace):  {'[', '{'},
+	uint16(linux.KeyRightBrace): {']', '}'},
+	uint16(linux.KeyBackslash):  {'\\', '|'},
+	uint16(linux.KeyA):          {'a', 'A'},
+	uint16(linux.KeyS):          {'s', 'S'},
+	uint16(linux.KeyD):          {'d', 'D'},
+	uint16(linux.KeyF):          {'f', 'F'},
+	uint16(linux.KeyG):          {'g', 'G'},
+	uint16(linux.KeyH):          {'h', 'H'},
+	uint16(linux.KeyJ):          {'j', 'J'},
+	uint16(linux.KeyK):          {'k', 'K'},
+	uint16(linux.KeyL):          {'l', 'L'},
+	uint16(linux.KeySemicolon):  {';', ':'},
+	uint16(linux.KeyApostrophe): {'\'', '"'},
+	uint16(linux.KeyZ):          {'z', 'Z'},
+	uint16(linux.KeyX):          {'x', 'X'},
+	uint16(linux.KeyC):          {'c', 'C'},
+	uint16(linux.KeyV):          {'v', 'V'},
+	uint16(linux.KeyB):          {'b', 'B'},
+	uint16(linux.KeyN):          {'n', 'N'},
+	uint16(linux.KeyM):          {'m', 'M'},
+	uint16(linux.KeyComma):      {',', '<'},
+	uint16(linux.KeyDot):        {'.', '>'},
+	uint16(linux.KeySlash):      {'/', '?'},
+	uint16(linux.KeySpace):      {' ', ' '},
+}
+
+// QwertyRune reports the character a US QWERTY keyboard produces for the
+// given evdev key code.
+func QwertyRune(code uint16, shift bool) (rune, bool) {
+	entry, ok := qwertyKeys[code]
+	if !ok {
+		return 0, false
+	}
+	if shift {
+		return entry.shifted, true
+	}
+	return entry.normal, true
+}
+
+// IsLetterKey reports whether code is one of the 26 Latin letter keys.
+func IsLetterKey(code uint16) bool {
+	r, ok := QwertyRune(code, false)
+	return ok && r >= 'a' && r <= 'z'
+}
@@ -5,9 +5,16 @@ import "unsafe"
 const (
 	EvSyn = 0x00
 	EvKey = 0x01
+	EvLed = 0x11
 
 	SynReport = 0
 
+	LedNumL    = 0x00
+	LedCapsL   = 0x01
+	LedScrollL = 0x02
+	LedCompose = 0x03
+	LedKana    = 0x04
+
 	KeyEsc        = 1
 	Key1          = 2
 	Key2          = 3
@@ -79,6 +86,18 @@ const (
 	KeyRightAlt   = 100
 	KeyF11        = 87
 	KeyF12        = 88
+	KeyUp         = 103
+	KeyPageUp     = 104
+	KeyLeft       = 105
+	KeyRight      = 106
+	KeyDown       = 108
+	KeyPageDown   = 109
+	KeyInsert     = 110
+	KeyKatakana   = 90
+	KeyHiragana   = 91
+	KeyHenkan     = 92
+	KeyKataHira   = 93
+	KeyMuhenkan   = 94
 	KeyLeftMeta   = 125
 	KeyRightMeta  = 126
 	KeyHangeul    = 122
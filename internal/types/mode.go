@@ -7,6 +7,7 @@ const (
 	ModeLatin
 	ModeKana
 	ModeDatabase
+	ModeRomaji
 )
 
 func (m InputMode) String() string {
@@ -19,6 +20,8 @@ func (m InputMode) String() string {
 		return "kana"
 	case ModeDatabase:
 		return "database"
+	case ModeRomaji:
+		return "romaji"
 	default:
 		return "unknown"
 	}
@@ -0,0 +1,230 @@
+package wayland
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// DisplayID is the object id of wl_display.
+const DisplayID = 1
+
+// wl_display requests and events.
+const (
+	displaySync        = 0
+	displayGetRegistry = 1
+	displayError       = 0
+	displayDeleteID    = 1
+	registryBind       = 0
+	registryGlobal     = 0
+	callbackDone       = 0
+)
+
+// Global is an interface the compositor advertises.
+type Global struct {
+	Name      uint32
+	Interface string
+	Version   uint32
+}
+
+// Handler receives the events of one object.
+type Handler func(*Message)
+
+// Client is a connection to a compositor. Events are read on a separate
+// goroutine and passed to the handler of their object.
+type Client struct {
+	conn     *Conn
+	registry uint32
+
+	mu       sync.Mutex
+	nextID   uint32
+	handlers map[uint32]Handler
+	globals  []Global
+	err      error
+	closed   chan struct{}
+}
+
+// SocketPath resolves $WAYLAND_DISPLAY, relative to $XDG_RUNTIME_DIR
+// unless it is absolute.
+func SocketPath() (string, error) {
+	display := os.Getenv("WAYLAND_DISPLAY")
+	if display == "" {
+		return "", errors.New("WAYLAND_DISPLAY not set")
+	}
+	if filepath.IsAbs(display) {
+		return display, nil
+	}
+	dir := os.Getenv("XDG_RUNTIME_DIR")
+	if dir == "" {
+		return "", errors.New("XDG_RUNTIME_DIR not set")
+	}
+	return filepath.Join(dir, display), nil
+}
+
+// Dial connects to the compositor socket at path and waits for the
+// initial list of globals.
+func Dial(path string) (*Client, error) {
+	raw, err := net.DialUnix("unix", nil, &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		return nil, fmt.Errorf("connect to %s: %w", path, err)
+	}
+	c := &Client{
+		conn:     NewConn(raw),
+		nextID:   DisplayID + 1,
+		handlers: make(map[uint32]Handler),
+		closed:   make(chan struct{}),
+	}
+	go c.readLoop()
+
+	c.registry = c.NewObject(c.handleRegistry)
+	if err := c.Send(NewMessage(DisplayID, displayGetRegistry).PutUint(c.registry)); err != nil {
+		c.Close()
+		return nil, err
+	}
+	if err := c.Roundtrip(); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewObject allocates an object id whose events go to handler.
+func (c *Client) NewObject(handler Handler) uint32 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	id := c.nextID
+	c.nextID++
+	if handler != nil {
+		c.handlers[id] = handler
+	}
+	return id
+}
+
+// Send writes a request.
+func (c *Client) Send(m *Message) error {
+	if err := c.Err(); err != nil {
+		return err
+	}
+	return c.conn.WriteMessage(m)
+}
+
+// Roundtrip waits until the compositor has handled every request sent so
+// far.
+func (c *Client) Roundtrip() error {
+	done := make(chan struct{})
+	callback := c.NewObject(func(m *Message) {
+		if m.Opcode == callbackDone {
+			close(done)
+		}
+	})
+	if err := c.Send(NewMessage(DisplayID, displaySync).PutUint(callback)); err != nil {
+		return err
+	}
+	select {
+	case <-done:
+		return nil
+	case <-c.closed:
+		return c.Err()
+	}
+}
+
+// Global returns the first advertised global implementing iface.
+func (c *Client) Global(iface string) (Global, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, global := range c.globals {
+		if global.Interface == iface {
+			return global, true
+		}
+	}
+	return Global{}, false
+}
+
+// Bind creates an object for global at version, which must not exceed
+// what the compositor advertised.
+func (c *Client) Bind(global Global, version uint32, handler Handler) (uint32, error) {
+	if version > global.Version {
+		return 0, fmt.Errorf("%s version %d not supported (compositor has %d)", global.Interface, version, global.Version)
+	}
+	id := c.NewObject(handler)
+	m := NewMessage(c.registry, registryBind).
+		PutUint(global.Name).
+		PutString(global.Interface).
+		PutUint(version).
+		PutUint(id)
+	return id, c.Send(m)
+}
+
+// Err returns the error that ended the connection, if any.
+func (c *Client) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *Client) Close() error {
+	c.fail(errors.New("wayland: connection closed"))
+	return c.conn.Close()
+}
+
+func (c *Client) fail(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return
+	}
+	c.err = err
+	close(c.closed)
+}
+
+func (c *Client) readLoop() {
+	for {
+		m, err := c.conn.ReadMessage()
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if m.Object == DisplayID {
+			c.handleDisplay(m)
+			continue
+		}
+		c.mu.Lock()
+		handler := c.handlers[m.Object]
+		c.mu.Unlock()
+		if handler != nil {
+			handler(m)
+		}
+	}
+}
+
+func (c *Client) handleDisplay(m *Message) {
+	d := m.Decode()
+	switch m.Opcode {
+	case displayError:
+		object, code, message := d.Uint(), d.Uint(), d.String()
+		c.fail(fmt.Errorf("wayland: protocol error on object %d (code %d): %s", object, code, message))
+		c.conn.Close()
+	case displayDeleteID:
+		id := d.Uint()
+		c.mu.Lock()
+		delete(c.handlers, id)
+		c.mu.Unlock()
+	}
+}
+
+func (c *Client) handleRegistry(m *Message) {
+	if m.Opcode != registryGlobal {
+		return
+	}
+	d := m.Decode()
+	global := Global{Name: d.Uint(), Interface: d.String(), Version: d.Uint()}
+	if d.Err() != nil {
+		return
+	}
+	c.mu.Lock()
+	c.globals = append(c.globals, global)
+	c.mu.Unlock()
+}
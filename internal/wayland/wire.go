@@ -0,0 +1,249 @@
+// Package wayland implements the parts of the Wayland wire protocol hanfe
+// needs to talk to a compositor: message framing, file descriptor passing
+// and a small client with a registry.
+package wayland
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+)
+
+const (
+	headerSize = 8
+	// maxFDs is the most descriptors the reference implementation passes
+	// with a single sendmsg.
+	maxFDs = 28
+)
+
+var order = binary.LittleEndian
+
+// Message is one request or event. Args holds the encoded arguments; file
+// descriptors travel next to them.
+type Message struct {
+	Object uint32
+	Opcode uint16
+	Args   []byte
+	FDs    []int
+
+	conn *Conn
+}
+
+// NewMessage starts a message for opcode on object.
+func NewMessage(object uint32, opcode uint16) *Message {
+	return &Message{Object: object, Opcode: opcode}
+}
+
+// PutUint appends a uint, object or new_id argument.
+func (m *Message) PutUint(v uint32) *Message {
+	m.Args = order.AppendUint32(m.Args, v)
+	return m
+}
+
+// PutInt appends an int argument.
+func (m *Message) PutInt(v int32) *Message {
+	return m.PutUint(uint32(v))
+}
+
+// PutString appends a string argument.
+func (m *Message) PutString(s string) *Message {
+	m.Args = order.AppendUint32(m.Args, uint32(len(s)+1))
+	m.Args = append(m.Args, s...)
+	m.Args = append(m.Args, 0)
+	return m.pad()
+}
+
+// PutArray appends an array argument.
+func (m *Message) PutArray(data []byte) *Message {
+	m.Args = order.AppendUint32(m.Args, uint32(len(data)))
+	m.Args = append(m.Args, data...)
+	return m.pad()
+}
+
+// PutFD attaches a file descriptor argument.
+func (m *Message) PutFD(fd int) *Message {
+	m.FDs = append(m.FDs, fd)
+	return m
+}
+
+func (m *Message) pad() *Message {
+	for len(m.Args)%4 != 0 {
+		m.Args = append(m.Args, 0)
+	}
+	return m
+}
+
+// Decoder reads the arguments of a message in order. The first error is
+// kept and reported by Err; later reads return zero values.
+type Decoder struct {
+	msg *Message
+	off int
+	err error
+}
+
+// Decode starts reading the arguments of m.
+func (m *Message) Decode() *Decoder {
+	return &Decoder{msg: m}
+}
+
+func (d *Decoder) Err() error {
+	return d.err
+}
+
+func (d *Decoder) Uint() uint32 {
+	if d.err != nil {
+		return 0
+	}
+	if d.off+4 > len(d.msg.Args) {
+		d.err = fmt.Errorf("wayland: message %d/%d truncated", d.msg.Object, d.msg.Opcode)
+		return 0
+	}
+	v := order.Uint32(d.msg.Args[d.off:])
+	d.off += 4
+	return v
+}
+
+func (d *Decoder) Int() int32 {
+	return int32(d.Uint())
+}
+
+func (d *Decoder) String() string {
+	data := d.Array()
+	if len(data) == 0 {
+		return ""
+	}
+	return string(data[:len(data)-1])
+}
+
+func (d *Decoder) Array() []byte {
+	size := int(d.Uint())
+	if d.err != nil {
+		return nil
+	}
+	padded := (size + 3) &^ 3
+	if d.off+padded > len(d.msg.Args) {
+		d.err = fmt.Errorf("wayland: message %d/%d truncated", d.msg.Object, d.msg.Opcode)
+		return nil
+	}
+	data := d.msg.Args[d.off : d.off+size]
+	d.off += padded
+	return data
+}
+
+// FD takes the next file descriptor received on the connection. The
+// caller owns it.
+func (d *Decoder) FD() int {
+	if d.err != nil {
+		return -1
+	}
+	fd, ok := d.msg.conn.takeFD()
+	if !ok {
+		d.err = fmt.Errorf("wayland: message %d/%d expects a file descriptor", d.msg.Object, d.msg.Opcode)
+		return -1
+	}
+	return fd
+}
+
+// Conn frames messages on a Wayland socket. It is used by the client and
+// works the same way for a server.
+type Conn struct {
+	conn *net.UnixConn
+	wmu  sync.Mutex
+	buf  []byte
+	fds  []int
+}
+
+func NewConn(conn *net.UnixConn) *Conn {
+	return &Conn{conn: conn}
+}
+
+// WriteMessage sends m and its file descriptors.
+func (c *Conn) WriteMessage(m *Message) error {
+	size := headerSize + len(m.Args)
+	if size > 0xffff {
+		return fmt.Errorf("wayland: message of %d bytes is too large", size)
+	}
+	if len(m.FDs) > maxFDs {
+		return fmt.Errorf("wayland: too many file descriptors")
+	}
+	data := make([]byte, 0, size)
+	data = order.AppendUint32(data, m.Object)
+	data = order.AppendUint32(data, uint32(size)<<16|uint32(m.Opcode))
+	data = append(data, m.Args...)
+	var oob []byte
+	if len(m.FDs) > 0 {
+		oob = syscall.UnixRights(m.FDs...)
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, _, err := c.conn.WriteMsgUnix(data, oob, nil)
+	return err
+}
+
+// ReadMessage returns the next message. Only one goroutine may read.
+func (c *Conn) ReadMessage() (*Message, error) {
+	for {
+		if len(c.buf) >= headerSize {
+			word := order.Uint32(c.buf[4:])
+			size := int(word >> 16)
+			if size < headerSize {
+				return nil, fmt.Errorf("wayland: invalid message size %d", size)
+			}
+			if len(c.buf) >= size {
+				m := &Message{
+					Object: order.Uint32(c.buf),
+					Opcode: uint16(word),
+					Args:   append([]byte(nil), c.buf[headerSize:size]...),
+					conn:   c,
+				}
+				c.buf = c.buf[size:]
+				return m, nil
+			}
+		}
+		if err := c.fill(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (c *Conn) fill() error {
+	data := make([]byte, 4096)
+	oob := make([]byte, syscall.CmsgSpace(maxFDs*4))
+	n, oobn, _, _, err := c.conn.ReadMsgUnix(data, oob)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("wayland: connection closed")
+	}
+	if oobn > 0 {
+		messages, err := syscall.ParseSocketControlMessage(oob[:oobn])
+		if err != nil {
+			return fmt.Errorf("wayland: parse control message: %w", err)
+		}
+		for _, msg := range messages {
+			fds, err := syscall.ParseUnixRights(&msg)
+			if err == nil {
+				c.fds = append(c.fds, fds...)
+			}
+		}
+	}
+	c.buf = append(c.buf, data[:n]...)
+	return nil
+}
+
+func (c *Conn) takeFD() (int, bool) {
+	if len(c.fds) == 0 {
+		return -1, false
+	}
+	fd := c.fds[0]
+	c.fds = c.fds[1:]
+	return fd, true
+}
+
+// Close closes the socket. A blocked ReadMessage returns an error.
+func (c *Conn) Close() error {
+	return c.conn.Close()
+}